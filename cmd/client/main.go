@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/robinmin/xally/cmd/client/service"
+	"github.com/robinmin/xally/cmd/client/tui"
 	"github.com/robinmin/xally/config"
 	"github.com/robinmin/xally/shared/utility"
 	log "github.com/sirupsen/logrus"
@@ -20,6 +21,11 @@ var (
 	command           string
 	role              string
 	verbose           bool
+	check_i18n        bool
+	full_screen       bool
+	record_dir        string
+	replay_dir        string
+	no_cache          bool
 )
 
 func init() {
@@ -27,10 +33,15 @@ func init() {
 	flag.BoolVar(&help, "h", false, "show the help message")
 	flag.StringVar(&config_file, "f", "", "config file")
 	flag.StringVar(&chat_history_path, "d", "", "specify chat history path")
-	flag.StringVar(&language, "p", "", "language preference, so far only support CN, JP and EN")
+	flag.StringVar(&language, "p", "", "language preference, CN, JP, EN or any language tag like zh-TW")
 	flag.StringVar(&command, "c", "", "command for single line instruction")
 	flag.StringVar(&role, "r", "", "default role for command")
 	flag.BoolVar(&verbose, "v", false, "show detail information")
+	flag.BoolVar(&full_screen, "tui", false, "full screen interface with the transcript, roles and sessions")
+	flag.StringVar(&record_dir, "record", "", "record the API requests and responses as fixtures into the folder")
+	flag.StringVar(&replay_dir, "replay", "", "answer the API requests with the fixtures in the folder, no live key needed")
+	flag.BoolVar(&no_cache, "no-cache", false, "ask the API even if the answer is cached")
+	flag.BoolVar(&check_i18n, "check-i18n", false, "report the missing keys of each language and quit")
 
 	// change the default useage
 	flag.Usage = usage
@@ -38,7 +49,7 @@ func init() {
 
 func usage() {
 	fmt.Fprintf(os.Stderr, `xally version: xally/%s
-Usage: xally [-hv] [-f config_file] [-r role] [-d history_path] [-p language_preference] [-c command]
+Usage: xally [-hv] [-tui] [-record dir | -replay dir] [-f config_file] [-r role] [-d history_path] [-p language_preference] [-c command]
 
 Options:
 `, config.Version)
@@ -55,21 +66,45 @@ func main() {
 
 	// load configuration
 	var err error
+	config.SecretPassphrase = utility.AskSecretKey
 	if _, err = config.LoadClientConfig(config_file, verbose); err != nil {
 		fmt.Println(err)
 	}
 
-	// update configuration by specified arguments
-	if len(role) > 0 {
-		config.MyConfig.System.DefaultRole = role
-	}
+	// update configuration by specified arguments, they are kept across the reloads
+	config.SetFlagOverrides(func(cfg *config.SysConfig) {
+		if len(role) > 0 {
+			cfg.System.DefaultRole = role
+		}
 
-	if len(chat_history_path) > 0 {
-		config.MyConfig.System.ChatHistoryPath = chat_history_path
-	}
+		if len(chat_history_path) > 0 {
+			cfg.System.ChatHistoryPath = chat_history_path
+		}
 
+		if len(language) > 0 {
+			cfg.System.PeferenceLanguage = language
+		}
+
+		if no_cache {
+			cfg.System.ResponseCache = false
+		}
+	})
 	if len(language) > 0 {
-		config.MyConfig.System.PeferenceLanguage = strings.ToUpper(language)
+		config.SetupPeferenceLanguage(language)
+	}
+	if err = service.SetupNetwork(config.MyConfig); err != nil {
+		fmt.Println(err)
+	}
+	if err = setupReplay(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if check_i18n {
+		if !checkI18n() {
+			os.Exit(1)
+		}
+		return
 	}
 
 	// output before the log mechanism works
@@ -101,7 +136,18 @@ func main() {
 			verbose,
 		)
 		defer bot.Close(true)
+		if full_screen || len(command) == 0 {
+			bot.WatchConfig()
+		}
 
+		if full_screen {
+			if err := tui.Run(bot); err != nil {
+				log.Error("Failed to run the full screen interface: ", err)
+			}
+			return
+		}
+
+		bot.Greet()
 		if len(command) == 0 {
 			bot.Run()
 		} else {
@@ -122,3 +168,34 @@ func main() {
 		utility.ReportEvent(utility.EVT_CLIENT_CLOSE, "Exit CLient", nil)
 	}
 }
+
+// setupReplay records or replays the API interactions as asked by -record or -replay
+func setupReplay() error {
+	switch {
+	case len(record_dir) > 0 && len(replay_dir) > 0:
+		return fmt.Errorf("-record and -replay can't be used together")
+	case len(record_dir) > 0:
+		return utility.SetupReplay(utility.REPLAY_RECORD, record_dir)
+	case len(replay_dir) > 0:
+		return utility.SetupReplay(utility.REPLAY_SERVE, replay_dir)
+	}
+	return nil
+}
+
+// checkI18n prints the keys missing in each language, including the locale files of the user
+func checkI18n() bool {
+	missing := config.MissingKeys()
+	complete := true
+	for _, tag := range config.Languages() {
+		if len(missing[tag]) == 0 {
+			fmt.Printf("%s : OK\n", tag)
+			continue
+		}
+		complete = false
+		fmt.Printf("%s : %d missing\n", tag, len(missing[tag]))
+		for _, key := range missing[tag] {
+			fmt.Println("  - " + key)
+		}
+	}
+	return complete
+}
@@ -0,0 +1,276 @@
+package service
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/robinmin/xally/config"
+	"github.com/robinmin/xally/shared/utility"
+)
+
+const PLUGIN_NAME_AUDIO_TRANSCRIBE = "audio-transcribe"
+const PLUGIN_NAME_AUDIO_TRANSLATE = "audio-translate"
+
+// runes of the text so far passed as the prompt of the next segment
+const AUDIO_PROMPT_RUNES = 200
+
+var errInvalidWAV = errors.New("invalid WAV file")
+
+// cmdAudio runs `audio-transcribe|audio-translate <file> [--summary | -- <question>]`. The
+// transcript is saved beside the Markdown history, then shown, summarised or asked about.
+func (bot *ChatBot) cmdAudio(original_msg string, arr_cmd []string) (*PluginResult, error) {
+	log.Debug("Execute [", arr_cmd[0], "] command on : ", original_msg)
+
+	fields, question := splitQuestion(original_msg, arr_cmd[1:])
+	summary := false
+	if len(fields) > 0 && fields[len(fields)-1] == "--summary" {
+		summary = true
+		fields = fields[:len(fields)-1]
+	}
+	if len(fields) == 0 {
+		return &PluginResult{Output: config.Text("tips_audio_usage")}, nil
+	}
+	file_name := strings.Join(fields, " ")
+	translate := arr_cmd[0] == PLUGIN_NAME_AUDIO_TRANSLATE
+
+	data, err := os.ReadFile(file_name)
+	if err != nil {
+		return nil, fmt.Errorf(config.Text("error_file_not_found"), file_name)
+	}
+	segments, err := splitAudio(file_name, data, config.MyConfig.System.AudioSegmentSize*1024*1024)
+	if err != nil {
+		return nil, err
+	}
+
+	ext := filepath.Ext(file_name)
+	stem := strings.TrimSuffix(filepath.Base(file_name), ext)
+	texts := []string{}
+	for idx, segment := range segments {
+		if len(segments) > 1 {
+			bot.Say(fmt.Sprintf(config.Text("tips_audio_segment"), idx+1, len(segments)), false)
+		}
+		text, err := bot.client.CreateAudioText(fmt.Sprintf("%s_%03d%s", stem, idx+1, ext), segment, translate, lastRunes(strings.Join(texts, " "), AUDIO_PROMPT_RUNES))
+		if err != nil {
+			return nil, err
+		}
+		texts = append(texts, strings.TrimSpace(text))
+	}
+	transcript := strings.Join(texts, "\n\n")
+	if len(strings.TrimSpace(transcript)) == 0 {
+		return &PluginResult{Output: config.Text("tips_audio_empty")}, nil
+	}
+
+	saved := ""
+	if path, err := bot.saveTranscript(stem, transcript, translate); err != nil {
+		log.Error("Failed to save the transcript : ", err)
+	} else {
+		saved = fmt.Sprintf(config.Text("tips_audio_saved"), path)
+	}
+
+	if !summary && len(question) == 0 {
+		return &PluginResult{Output: transcript + "\n\n" + saved}, nil
+	}
+
+	bot.Say(saved, false)
+	content, err := bot.condenseTranscript(texts, config.MyConfig.System.FileContextBudget)
+	if err != nil {
+		return nil, err
+	}
+	if summary {
+		question = config.Text("prompt_content_summary")
+	}
+	return &PluginResult{Question: question + "\n\n-------------------------\n" + content}, nil
+}
+
+// condenseTranscript returns the transcript as it is when it fits in the token budget, otherwise
+// summarises it part by part and returns the summaries instead
+func (bot *ChatBot) condenseTranscript(texts []string, budget int) (string, error) {
+	transcript := strings.Join(texts, "\n\n")
+	tokens := utility.EstimateTokens(len(transcript))
+	if budget <= 0 || tokens <= budget {
+		return transcript, nil
+	}
+
+	limit := budget * utility.BYTES_PER_TOKEN
+	sections := []string{}
+	for _, text := range texts {
+		sections = append(sections, cutText(text+"\n\n", limit)...)
+	}
+	chunks := packChunks(sections, limit)
+	bot.Say(fmt.Sprintf(config.Text("tips_audio_condensed"), tokens, budget, len(chunks)), false)
+
+	summaries := []string{}
+	for idx, chunk := range chunks {
+		role := &config.SysRole{
+			Name:   bot.role.Name,
+			Model:  bot.role.Model,
+			Prompt: config.Text("prompt_content_summary") + fmt.Sprintf(config.Text("tips_git_part"), idx+1, len(chunks)),
+		}
+		answer, _, err := bot.askOneShot(role, chunk)
+		if err != nil {
+			return "", err
+		}
+		summaries = append(summaries, strings.TrimSpace(answer))
+	}
+	return strings.Join(summaries, "\n\n"), nil
+}
+
+// cutText cuts the text into pieces no larger than limit bytes, after a space or a punctuation
+// where possible and never inside a character
+func cutText(text string, limit int) []string {
+	pieces := []string{}
+	for len(text) > limit {
+		cut := strings.LastIndexAny(text[:limit], " \n.!?,。！？，")
+		if cut > 0 {
+			_, size := utf8.DecodeRuneInString(text[cut:])
+			cut += size
+		} else {
+			cut = limit
+			for cut > 1 && !utf8.RuneStart(text[cut]) {
+				cut--
+			}
+		}
+		pieces = append(pieces, text[:cut])
+		text = text[cut:]
+	}
+	return append(pieces, text)
+}
+
+// saveTranscript writes the transcript into the folder of the Markdown history
+func (bot *ChatBot) saveTranscript(stem string, transcript string, translate bool) (string, error) {
+	if err := os.MkdirAll(bot.chat_history_path, 0755); err != nil {
+		return "", err
+	}
+	suffix := "_transcript.md"
+	if translate {
+		suffix = "_translation.md"
+	}
+	path := filepath.Join(bot.chat_history_path, stem+suffix)
+	return path, os.WriteFile(path, []byte("# "+stem+"\n\n"+transcript+"\n"), 0644)
+}
+
+func lastRunes(text string, count int) string {
+	runes := []rune(text)
+	if len(runes) <= count {
+		return text
+	}
+	return string(runes[len(runes)-count:])
+}
+
+// splitAudio cuts the audio into segments no larger than limit bytes. WAV is cut on the
+// samples with a header for each segment, MP3 on the frame boundaries, and the other
+// formats can only be sent whole.
+func splitAudio(file_name string, data []byte, limit int) ([][]byte, error) {
+	if limit <= 0 || len(data) <= limit {
+		return [][]byte{data}, nil
+	}
+	switch strings.ToLower(filepath.Ext(file_name)) {
+	case ".wav", ".wave":
+		return splitWAV(data, limit)
+	case ".mp3", ".mpga", ".mpeg":
+		return splitMP3(data, limit), nil
+	}
+	return nil, fmt.Errorf(config.Text("tips_audio_too_large"), file_name, limit/1024/1024)
+}
+
+func splitWAV(data []byte, limit int) ([][]byte, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, errInvalidWAV
+	}
+
+	var fmt_chunk, samples []byte
+	for pos := 12; pos+8 <= len(data); {
+		size := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		end := pos + 8 + size
+		if end > len(data) || end < pos {
+			// the recorders writing as they go leave the size of the last chunk wrong
+			end = len(data)
+		}
+		switch string(data[pos : pos+4]) {
+		case "fmt ":
+			fmt_chunk = data[pos:end]
+		case "data":
+			samples = data[pos+8 : end]
+		}
+		// the chunks are word aligned
+		pos = end + size%2
+	}
+	if len(fmt_chunk) < 8+14 || samples == nil {
+		return nil, errInvalidWAV
+	}
+
+	block_align := int(binary.LittleEndian.Uint16(fmt_chunk[8+12 : 8+14]))
+	if block_align <= 0 {
+		block_align = 1
+	}
+	header_len := 12 + len(fmt_chunk) + 8
+	per_segment := (limit - header_len) / block_align * block_align
+	if per_segment <= 0 {
+		return nil, errInvalidWAV
+	}
+
+	segments := [][]byte{}
+	for start := 0; start < len(samples); start += per_segment {
+		end := minInt(start+per_segment, len(samples))
+		segment := make([]byte, 0, header_len+end-start)
+		segment = append(segment, "RIFF"...)
+		segment = binary.LittleEndian.AppendUint32(segment, uint32(header_len-8+end-start))
+		segment = append(segment, "WAVE"...)
+		segment = append(segment, fmt_chunk...)
+		segment = append(segment, "data"...)
+		segment = binary.LittleEndian.AppendUint32(segment, uint32(end-start))
+		segment = append(segment, samples[start:end]...)
+		segments = append(segments, segment)
+	}
+	return segments, nil
+}
+
+func splitMP3(data []byte, limit int) [][]byte {
+	// the ID3v2 tag at the beginning is not audio
+	start := 0
+	if len(data) >= 10 && string(data[:3]) == "ID3" {
+		start = 10 + (int(data[6]&0x7f)<<21 | int(data[7]&0x7f)<<14 | int(data[8]&0x7f)<<7 | int(data[9]&0x7f))
+		if data[5]&0x10 != 0 {
+			start += 10
+		}
+		start = minInt(start, len(data))
+	}
+
+	segments := [][]byte{}
+	for start < len(data) {
+		end := start + limit
+		if end >= len(data) {
+			segments = append(segments, data[start:])
+			break
+		}
+		cut := end
+		for pos := end; pos > start; pos-- {
+			if isMP3FrameHeader(data[pos:]) {
+				cut = pos
+				break
+			}
+		}
+		segments = append(segments, data[start:cut])
+		start = cut
+	}
+	return segments
+}
+
+// isMP3FrameHeader checks the sync word and the reserved values of the MPEG audio frame header
+func isMP3FrameHeader(header []byte) bool {
+	if len(header) < 4 || header[0] != 0xFF || header[1]&0xE0 != 0xE0 {
+		return false
+	}
+	version := (header[1] >> 3) & 0x03
+	layer := (header[1] >> 1) & 0x03
+	bitrate := header[2] >> 4
+	sample_rate := (header[2] >> 2) & 0x03
+	return version != 0x01 && layer != 0x00 && bitrate != 0x0F && bitrate != 0x00 && sample_rate != 0x03
+}
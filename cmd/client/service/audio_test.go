@@ -0,0 +1,180 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	gpt3 "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/require"
+
+	"github.com/robinmin/xally/config"
+	"github.com/robinmin/xally/shared/clientdb"
+)
+
+// sampleWAV makes a 16-bit mono WAV with the given number of samples
+func sampleWAV(samples int) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(36+samples*2))
+	buf.WriteString("WAVEfmt ")
+	binary.Write(&buf, binary.LittleEndian, uint32(16))
+	binary.Write(&buf, binary.LittleEndian, []uint16{1, 1})
+	binary.Write(&buf, binary.LittleEndian, []uint32{16000, 32000})
+	binary.Write(&buf, binary.LittleEndian, []uint16{2, 16})
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(samples*2))
+	for idx := 0; idx < samples; idx++ {
+		binary.Write(&buf, binary.LittleEndian, int16(idx))
+	}
+	return buf.Bytes()
+}
+
+func TestSplitWAV(t *testing.T) {
+	assertions := require.New(t)
+
+	data := sampleWAV(1000)
+	segments, err := splitAudio("meeting.wav", data, 1001)
+	assertions.NoError(err)
+	assertions.Len(segments, 3)
+
+	total := 0
+	for _, segment := range segments {
+		assertions.LessOrEqual(len(segment), 1001)
+		assertions.Equal("RIFF", string(segment[:4]))
+		assertions.Equal(uint32(len(segment)-8), binary.LittleEndian.Uint32(segment[4:8]))
+		size := int(binary.LittleEndian.Uint32(segment[40:44]))
+		assertions.Equal(len(segment)-44, size)
+		// whole samples only
+		assertions.Equal(0, size%2)
+		total += size
+	}
+	assertions.Equal(2000, total)
+
+	segments, err = splitAudio("meeting.wav", data, 0)
+	assertions.NoError(err)
+	assertions.Len(segments, 1)
+
+	_, err = splitAudio("meeting.m4a", data, 1001)
+	assertions.ErrorContains(err, "meeting.m4a")
+}
+
+func TestSplitMP3(t *testing.T) {
+	assertions := require.New(t)
+
+	// an ID3 tag, then frames of 100 bytes headed by MPEG-1 Layer III 128kbps 44.1kHz
+	data := []byte{'I', 'D', '3', 4, 0, 0, 0, 0, 0, 5, 1, 2, 3, 4, 5}
+	for idx := 0; idx < 10; idx++ {
+		frame := make([]byte, 100)
+		copy(frame, []byte{0xFF, 0xFB, 0x90, 0x64})
+		data = append(data, frame...)
+	}
+
+	segments, err := splitAudio("meeting.mp3", data, 250)
+	assertions.NoError(err)
+	assertions.Len(segments, 5)
+	for _, segment := range segments {
+		assertions.Len(segment, 200)
+		assertions.True(isMP3FrameHeader(segment))
+	}
+}
+
+func TestAudioTranscribe(t *testing.T) {
+	assertions := require.New(t)
+
+	uploads := []string{}
+	summarised := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/models" {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"object":"list","data":[{"id":"gpt-3.5-turbo","object":"model"}]}`)
+			return
+		}
+		if r.URL.Path == "/chat/completions" {
+			var request gpt3.ChatCompletionRequest
+			if json.NewDecoder(r.Body).Decode(&request) != nil || len(request.Messages) != 2 {
+				http.Error(w, "bad request", http.StatusBadRequest)
+				return
+			}
+			summarised = append(summarised, request.Messages[1].Content)
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"choices":[{"message":{"role":"assistant","content":"summary %d"}}]}`, len(summarised))
+			return
+		}
+		file, header, err := r.FormFile("file")
+		if r.URL.Path != "/audio/transcriptions" || err != nil || r.FormValue("model") != "whisper-1" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		uploads = append(uploads, header.Filename)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"text":"part %d"}`, len(uploads))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	config.UseTestConfig(t)
+	config.MyConfig.System.APIEndpointOpenai = server.URL
+	// 1MB segments
+	config.MyConfig.System.AudioSegmentSize = 1
+	audio_file := filepath.Join(dir, "standup.wav")
+	assertions.NoError(os.WriteFile(audio_file, sampleWAV(600*1024), 0644))
+
+	cdb, err := clientdb.InitClientDB(filepath.Join(dir, "xally.db"), false)
+	assertions.NoError(err)
+	bot := &ChatBot{
+		client:            NewChatBotClient("", server.URL),
+		clientdb:          cdb,
+		role:              &config.SysRole{Name: "default", Model: "gpt-3.5-turbo"},
+		connected:         true,
+		chat_history_path: dir,
+		console:           &terminalConsole{},
+	}
+	msg := "audio-transcribe " + audio_file
+	result, err := bot.cmdAudio(msg, strings.Fields(msg))
+	assertions.NoError(err)
+	assertions.Equal([]string{"standup_001.wav", "standup_002.wav"}, uploads)
+	assertions.Contains(result.Output, "part 1\n\npart 2")
+
+	data, err := os.ReadFile(filepath.Join(dir, "standup_transcript.md"))
+	assertions.NoError(err)
+	assertions.Equal("# standup\n\npart 1\n\npart 2\n", string(data))
+
+	// the transcript goes to the summary instead
+	msg = "audio-transcribe " + audio_file + " --summary"
+	result, err = bot.cmdAudio(msg, strings.Fields(msg))
+	assertions.NoError(err)
+	assertions.True(strings.HasPrefix(result.Question, config.Text("prompt_content_summary")))
+	assertions.Contains(result.Question, "part 3\n\npart 4")
+	assertions.Empty(summarised)
+
+	// a transcript beyond the token budget is summarised part by part first
+	config.MyConfig.System.FileContextBudget = 2
+	msg = "audio-transcribe " + audio_file + " -- what was decided?"
+	result, err = bot.cmdAudio(msg, strings.Fields(msg))
+	assertions.NoError(err)
+	assertions.Equal([]string{"part 5\n\n", "part 6\n\n"}, summarised)
+	assertions.Equal("what was decided?\n\n-------------------------\nsummary 1\n\nsummary 2", result.Question)
+}
+
+func TestCutText(t *testing.T) {
+	assertions := require.New(t)
+
+	assertions.Equal([]string{"short"}, cutText("short", 10))
+	assertions.Equal([]string{"one two ", "three"}, cutText("one two three", 10))
+	// never inside a character
+	for _, piece := range cutText("一二三四五六七八", 10) {
+		assertions.LessOrEqual(len(piece), 10)
+		assertions.True(utf8.ValidString(piece))
+	}
+	assertions.Equal("一二三四五六七八", strings.Join(cutText("一二三四五六七八", 10), ""))
+}
@@ -0,0 +1,644 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	strftime "github.com/itchyny/timefmt-go"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/exp/slices"
+
+	"github.com/robinmin/xally/config"
+	"github.com/robinmin/xally/shared/clientdb"
+	"github.com/robinmin/xally/shared/secretstore"
+	"github.com/robinmin/xally/shared/translator"
+)
+
+// BuiltinPlugin wraps the commands implemented by the chatbot itself
+type BuiltinPlugin struct {
+	meta    PluginMeta
+	handler func(original_msg string, arr_cmd []string) (*PluginResult, error)
+	// tells if the arguments are meant for the command, any are taken if nil
+	accept func(arr_cmd []string) bool
+}
+
+func (plugin *BuiltinPlugin) GetMeta() *PluginMeta {
+	return &plugin.meta
+}
+
+func (*BuiltinPlugin) Open() error {
+	return nil
+}
+
+func (*BuiltinPlugin) Close() error {
+	return nil
+}
+
+func (plugin *BuiltinPlugin) Execute(original_msg string, arr_cmd []string) (*PluginResult, error) {
+	return plugin.handler(original_msg, arr_cmd)
+}
+
+func (plugin *BuiltinPlugin) AcceptArgs(original_msg string, arr_cmd []string) bool {
+	return plugin.accept == nil || plugin.accept(arr_cmd)
+}
+
+func (bot *ChatBot) registerBuiltins() {
+	builtins := []*BuiltinPlugin{
+		{
+			meta: PluginMeta{
+				Name:        "ask",
+				Description: "tips_suggestion_ask",
+				Args:        []PluginArg{{Name: "question", Repeated: true}},
+			},
+			handler: bot.cmdAsk,
+		},
+		{
+			meta: PluginMeta{
+				Name:        "reset",
+				Description: "tips_suggestion_reset_role",
+				Args:        []PluginArg{{Name: "role", Optional: true}},
+				Completion:  CompleteRole,
+			},
+			handler: bot.cmdReset,
+			accept:  acceptReset,
+		},
+		{
+			meta: PluginMeta{
+				Name:        "clear",
+				Aliases:     []string{"cls"},
+				Description: "tips_suggestion_clear",
+				Standalone:  true,
+			},
+			handler: bot.cmdClear,
+		},
+		{
+			meta: PluginMeta{
+				Name:        "translate",
+				Description: "tips_suggestion_translate",
+				Args:        []PluginArg{{Name: "text", Repeated: true}},
+			},
+			handler: bot.cmdTranslate,
+		},
+		{
+			meta: PluginMeta{
+				Name:        "lookup",
+				Description: "tips_suggestion_translate",
+				Args:        []PluginArg{{Name: "word"}, {Name: "-- sentence", Optional: true}},
+			},
+			handler: bot.cmdLookup,
+		},
+		{
+			meta: PluginMeta{
+				Name:        PLUGIN_NAME_VOCAB,
+				Description: "tips_suggestion_vocab",
+				Args:        []PluginArg{{Name: "list|review|export"}, {Name: "n|--anki", Optional: true}},
+				Hints: []PluginHint{
+					{Text: "list", Description: "tips_suggestion_vocab_list"},
+					{Text: "review", Description: "tips_suggestion_vocab_review"},
+					{Text: "export --anki", Description: "tips_suggestion_vocab_export", Completion: CompleteFile},
+				},
+			},
+			handler: bot.cmdVocab,
+			accept:  acceptVocab,
+		},
+		{
+			meta: PluginMeta{
+				Name:        "cmd",
+				Description: "tips_suggestion_cmd",
+				Args:        []PluginArg{{Name: "command"}, {Name: "args", Optional: true, Repeated: true}},
+			},
+			handler: bot.cmdExec,
+		},
+		{
+			meta: PluginMeta{
+				Name:        PLUGIN_NAME_CMD_ASK,
+				Aliases:     []string{"!!"},
+				Description: "tips_suggestion_cmd_ask",
+				Args:        []PluginArg{{Name: "command"}, {Name: "args", Optional: true, Repeated: true}, {Name: "-- question", Optional: true}},
+			},
+			handler: bot.cmdCaptureAsk,
+		},
+		{
+			meta: PluginMeta{
+				Name:        PLUGIN_NAME_IMAGE,
+				Description: "tips_suggestion_image",
+				Args:        []PluginArg{{Name: "path", Repeated: true}, {Name: "-- question"}},
+				Completion:  CompleteFile,
+			},
+			handler: bot.cmdImage,
+			accept:  acceptImage,
+		},
+		{
+			meta: PluginMeta{
+				Name:        PLUGIN_NAME_AUDIO_TRANSCRIBE,
+				Description: "tips_suggestion_audio_transcribe",
+				Args:        []PluginArg{{Name: "file"}, {Name: "--summary", Optional: true}, {Name: "-- question", Optional: true}},
+				Completion:  CompleteFile,
+				Hints: []PluginHint{
+					{Text: "--summary", Description: "tips_suggestion_audio_summary"},
+				},
+			},
+			handler: bot.cmdAudio,
+		},
+		{
+			meta: PluginMeta{
+				Name:        PLUGIN_NAME_AUDIO_TRANSLATE,
+				Description: "tips_suggestion_audio_translate",
+				Args:        []PluginArg{{Name: "file"}, {Name: "--summary", Optional: true}, {Name: "-- question", Optional: true}},
+				Completion:  CompleteFile,
+				Hints: []PluginHint{
+					{Text: "--summary", Description: "tips_suggestion_audio_summary"},
+				},
+			},
+			handler: bot.cmdAudio,
+		},
+		{
+			meta: PluginMeta{
+				Name:        PLUGIN_NAME_IMAGINE,
+				Description: "tips_suggestion_imagine",
+				Args:        []PluginArg{{Name: "prompt", Repeated: true}, {Name: "--size WxH", Optional: true}, {Name: "--n count", Optional: true}},
+				Hints: []PluginHint{
+					{Text: "--size", Description: "tips_suggestion_imagine_size"},
+					{Text: "--n", Description: "tips_suggestion_imagine_n"},
+				},
+			},
+			handler: bot.cmdImagine,
+		},
+		{
+			meta: PluginMeta{
+				Name:        PLUGIN_NAME_SHELL,
+				Description: "tips_suggestion_shell",
+				Args:        []PluginArg{{Name: "what you want", Repeated: true}},
+			},
+			handler: bot.cmdShell,
+			accept:  acceptShell,
+		},
+		{
+			meta: PluginMeta{
+				Name:        "config-email",
+				Description: "tips_suggestion_config_email",
+				Args:        []PluginArg{{Name: "email"}, {Name: "endpoint"}},
+			},
+			handler: bot.cmdConfigEmail,
+		},
+		{
+			meta: PluginMeta{
+				Name:        "config",
+				Description: "tips_suggestion_config",
+				Args:        []PluginArg{{Name: "show|validate"}, {Name: "--effective", Optional: true}},
+				Hints: []PluginHint{
+					{Text: "show", Description: "tips_suggestion_config_show"},
+					{Text: "show --effective", Description: "tips_suggestion_config_effective"},
+					{Text: "validate", Description: "tips_suggestion_config_validate"},
+				},
+			},
+			handler: bot.cmdConfig,
+			accept:  acceptConfig,
+		},
+		{
+			meta: PluginMeta{
+				Name:        "secret",
+				Description: "tips_suggestion_secret",
+				Args:        []PluginArg{{Name: "set|get|rm"}, {Name: "name"}, {Name: "value", Optional: true}},
+				Hints: []PluginHint{
+					{Text: "set", Description: "tips_suggestion_secret_set"},
+					{Text: "get", Description: "tips_suggestion_secret_get"},
+					{Text: "rm", Description: "tips_suggestion_secret_rm"},
+				},
+			},
+			handler: bot.cmdSecret,
+		},
+		{
+			meta: PluginMeta{
+				Name:        "set",
+				Description: "tips_suggestion_set",
+				Args:        []PluginArg{{Name: "model"}, {Name: "value"}},
+				Hints: []PluginHint{
+					{Text: "model", Description: "tips_suggestion_set_model", Completion: CompleteModel},
+				},
+			},
+			handler: bot.cmdSet,
+			accept:  acceptSet,
+		},
+		{
+			meta: PluginMeta{
+				Name:        "history",
+				Description: "tips_suggestion_history",
+				Args:        []PluginArg{{Name: "prune"}, {Name: "n", Optional: true}},
+				Hints: []PluginHint{
+					{Text: "prune", Description: "tips_suggestion_history_prune"},
+				},
+			},
+			handler: bot.cmdHistory,
+			accept:  acceptHistory,
+		},
+		{
+			meta: PluginMeta{
+				Name:        "models",
+				Description: "tips_suggestion_models",
+				Standalone:  true,
+			},
+			handler: bot.cmdModels,
+		},
+		{
+			meta: PluginMeta{
+				Name:        PLUGIN_NAME_GIT_REVIEW,
+				Description: "tips_suggestion_git_review",
+				Args:        []PluginArg{{Name: "ref", Optional: true}},
+			},
+			handler: bot.cmdGitReview,
+		},
+		{
+			meta: PluginMeta{
+				Name:        PLUGIN_NAME_GIT_COMMIT_MSG,
+				Description: "tips_suggestion_git_commit_msg",
+			},
+			handler: bot.cmdGitCommitMsg,
+		},
+		{
+			meta: PluginMeta{
+				Name:        "cache",
+				Description: "tips_suggestion_cache",
+				Args:        []PluginArg{{Name: "list|clear"}, {Name: "web|file|answer", Optional: true}},
+				Hints: []PluginHint{
+					{Text: "list", Description: "tips_suggestion_cache_list"},
+					{Text: "clear", Description: "tips_suggestion_cache_clear"},
+				},
+			},
+			handler: bot.cmdCache,
+			accept:  acceptCache,
+		},
+		{
+			meta: PluginMeta{
+				Name:        "help",
+				Description: "tips_suggestion_help",
+				Args:        []PluginArg{{Name: "command", Optional: true}},
+			},
+			handler: bot.cmdHelp,
+			accept:  bot.acceptHelp,
+		},
+		{
+			meta: PluginMeta{
+				Name:        "quit",
+				Aliases:     []string{"exit", "bye", "886", "88", "q"},
+				Description: "tips_suggestion_quit",
+				Standalone:  true,
+			},
+			handler: bot.cmdQuit,
+		},
+	}
+
+	for _, plugin := range builtins {
+		if err := bot.plugin_mgr.AddPlugin(plugin); err != nil {
+			log.Error("Failed to register builtin command : ", err)
+		}
+	}
+}
+
+func (bot *ChatBot) cmdAsk(original_msg string, arr_cmd []string) (*PluginResult, error) {
+	result := &PluginResult{}
+	if len(original_msg) > len(arr_cmd[0]) {
+		log.Debug("Execute [ask] command on : ", original_msg)
+
+		result.Question = original_msg[len(arr_cmd[0]):]
+	}
+	return result, nil
+}
+
+func (bot *ChatBot) cmdReset(original_msg string, arr_cmd []string) (*PluginResult, error) {
+	log.Debug("Execute [reset] command on : ", original_msg)
+
+	var role string
+	if len(arr_cmd) > 1 {
+		role = strings.ToLower(arr_cmd[1])
+	} else {
+		role = config.MyConfig.System.DefaultRole
+	}
+	bot.resetRole(role, false)
+	return nil, nil
+}
+
+// acceptReset takes `reset` and `reset <role>` only
+func acceptReset(arr_cmd []string) bool {
+	if len(arr_cmd) == 1 {
+		return true
+	}
+	_, ok := config.MyConfig.Roles[strings.ToLower(arr_cmd[1])]
+	return len(arr_cmd) == 2 && ok
+}
+
+func (bot *ChatBot) cmdClear(original_msg string, arr_cmd []string) (*PluginResult, error) {
+	log.Debug("Execute [clear / cls] command")
+
+	bot.resetRole(config.MyConfig.System.DefaultRole, true)
+	return nil, nil
+}
+
+func (bot *ChatBot) cmdLookup(original_msg string, arr_cmd []string) (*PluginResult, error) {
+	log.Debug("Execute [lookup] command on : ", original_msg)
+
+	// `lookup word -- sentence` keeps the sentence the word comes from
+	question := strings.TrimSpace(original_msg[len(arr_cmd[0]):])
+	var sentence string
+	if pos := strings.Index(question, " -- "); pos >= 0 {
+		sentence = strings.TrimSpace(question[pos+4:])
+		question = strings.TrimSpace(question[:pos])
+	}
+
+	msg, err := bot.translator.Lookup(question, config.MyConfig.System.PeferenceLanguage)
+	if err == nil && len(strings.TrimSpace(msg)) > 0 {
+		bot.clientdb.SaveVocabEntry(&clientdb.VocabEntry{
+			Word:     question,
+			Language: detectLanguage(question, sentence, config.MyConfig.System.PeferenceLanguage),
+			Senses:   msg,
+			Sentence: sentence,
+		})
+	}
+	return translatorResult(msg, err)
+}
+
+func (bot *ChatBot) cmdTranslate(original_msg string, arr_cmd []string) (*PluginResult, error) {
+	log.Debug("Execute [translate] command on : ", original_msg)
+
+	question := strings.TrimSpace(original_msg[len(arr_cmd[0]):])
+	glossary, err := translator.LoadGlossary(config.MyConfig.System.GlossaryPath, PROJECT_GLOSSARY_FILE)
+	if err != nil {
+		log.Error("Failed to load the glossary : ", err)
+	}
+	msg, err := bot.translator.Translate(question, config.MyConfig.System.PeferenceLanguage, glossary)
+	return translatorResult(msg, err)
+}
+
+func translatorResult(msg string, err error) (*PluginResult, error) {
+	if errors.Is(err, translator.ErrNotConfigured) {
+		return &PluginResult{Output: config.Text("error_no_translator")}, nil
+	}
+	return &PluginResult{Output: msg, NeedDump: err == nil}, err
+}
+
+func (bot *ChatBot) cmdExec(original_msg string, arr_cmd []string) (*PluginResult, error) {
+	log.Debug("Execute [cmd] command on : ", original_msg)
+
+	if len(arr_cmd) <= 1 {
+		return &PluginResult{NeedDump: true}, errors.New(config.Text("sys_not_enough_cmd"))
+	}
+
+	var cmd_args []string
+	cmd_real := strings.ToLower(arr_cmd[1])
+	if len(arr_cmd) > 2 {
+		cmd_args = arr_cmd[2:]
+	}
+	log.Debug("cmd_real = ", cmd_real)
+	log.Debug("cmd_args = ", cmd_args)
+
+	if len(cmd_real) == 0 || cmd_real == "exit" {
+		msg := config.Text("sys_invalid_cmd")
+		return &PluginResult{Output: msg, NeedDump: true}, errors.New(msg)
+	}
+
+	//	Run the command
+	if err := runLocalCommand(bot.getConsole(), cmd_real, cmd_args, nil); err != nil {
+		return &PluginResult{Output: err.Error(), NeedDump: true}, err
+	}
+	return nil, nil
+}
+
+func (bot *ChatBot) cmdConfigEmail(original_msg string, arr_cmd []string) (*PluginResult, error) {
+	log.Debug("Execute [cmd] command on : ", original_msg)
+
+	if len(arr_cmd) < 3 {
+		return &PluginResult{Output: config.Text("tips_config_email_usage")}, nil
+	}
+	msg, err := bot.client.UserRegistration(arr_cmd[1], arr_cmd[2])
+	return &PluginResult{Output: msg}, err
+}
+
+// acceptConfig takes `config`, `config show [--effective]` and `config validate` only
+func acceptConfig(arr_cmd []string) bool {
+	args := strings.Join(arr_cmd[1:], " ")
+	return args == "" || args == "show" || args == "show --effective" || args == "validate"
+}
+
+// cmdConfig handles `config show [--effective]` and `config validate`
+func (bot *ChatBot) cmdConfig(original_msg string, arr_cmd []string) (*PluginResult, error) {
+	log.Debug("Execute [config] command on : ", original_msg)
+
+	args := arr_cmd[1:]
+	switch {
+	case len(args) == 1 && args[0] == "show":
+		var sb strings.Builder
+		sb.WriteString(config.Text("tips_config_layers_header") + "\n|----|----|\n")
+		for _, layer := range config.MyConfig.Layers {
+			sb.WriteString(fmt.Sprintf("| %s | %s |\n", layer.Name, layer.Source))
+		}
+		return &PluginResult{Output: sb.String()}, nil
+	case len(args) == 2 && args[0] == "show" && args[1] == "--effective":
+		yaml_data, err := config.MyConfig.EffectiveYAML()
+		if err != nil {
+			return nil, err
+		}
+		return &PluginResult{Output: "```yaml\n" + yaml_data + "```"}, nil
+	case len(args) == 1 && args[0] == "validate":
+		cfg_errors := config.MyConfig.ValidateLayers()
+		if len(cfg_errors) == 0 {
+			return &PluginResult{Output: config.Text("tips_config_valid")}, nil
+		}
+
+		var sb strings.Builder
+		sb.WriteString(config.Text("tips_config_invalid") + "\n")
+		for _, cfg_err := range cfg_errors {
+			sb.WriteString("- `" + cfg_err.Error() + "`\n")
+		}
+		return &PluginResult{Output: sb.String()}, nil
+	default:
+		return &PluginResult{Output: config.Text("tips_config_usage")}, nil
+	}
+}
+
+// cmdSecret handles `secret set <name> [value]`, `secret get <name>` and `secret rm <name>`
+func (bot *ChatBot) cmdSecret(original_msg string, arr_cmd []string) (*PluginResult, error) {
+	log.Debug("Execute [secret] command on : ", redactSecret(original_msg))
+
+	args := arr_cmd[1:]
+	if config.MySecrets == nil || len(args) < 2 {
+		return &PluginResult{Output: config.Text("tips_secret_usage")}, nil
+	}
+
+	name := args[1]
+	switch args[0] {
+	case "set":
+		var value string
+		if len(args) > 2 {
+			value = strings.Join(args[2:], " ")
+		} else {
+			var err error
+			if value, err = bot.getConsole().ReadPassword(config.Text("tips_secret_value")); err != nil {
+				return nil, err
+			}
+		}
+		// the line recalled from an older history carries the placeholder instead of the value
+		if value == SECRET_PLACEHOLDER {
+			return &PluginResult{Output: fmt.Sprintf(config.Text("tips_secret_placeholder"), SECRET_PLACEHOLDER)}, nil
+		}
+		if err := config.MySecrets.Set(name, value); err != nil {
+			return nil, err
+		}
+		config.MyConfig.RefreshSecret(name, value)
+		return &PluginResult{Output: fmt.Sprintf(config.Text("tips_secret_saved"), name, secretstore.Ref(name))}, nil
+	case "get":
+		value, found, err := config.MySecrets.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return &PluginResult{Output: fmt.Sprintf(config.Text("tips_secret_not_found"), name)}, nil
+		}
+		return &PluginResult{Output: "`" + value + "`"}, nil
+	case "rm":
+		removed, err := config.MySecrets.Remove(name)
+		if err != nil {
+			return nil, err
+		}
+		if !removed {
+			return &PluginResult{Output: fmt.Sprintf(config.Text("tips_secret_not_found"), name)}, nil
+		}
+		config.MyConfig.RefreshSecret(name, "")
+		return &PluginResult{Output: fmt.Sprintf(config.Text("tips_secret_removed"), name)}, nil
+	default:
+		return &PluginResult{Output: config.Text("tips_secret_usage")}, nil
+	}
+}
+
+// shown in place of the value of `secret set <name> <value>`
+const SECRET_PLACEHOLDER = "****"
+
+// redactSecret hides the value of `secret set <name> <value>` from the logs
+func redactSecret(original_msg string) string {
+	fields := strings.Fields(original_msg)
+	if len(fields) > 3 && fields[0] == "secret" && fields[1] == "set" {
+		return strings.Join(fields[:3], " ") + " " + SECRET_PLACEHOLDER
+	}
+	return original_msg
+}
+
+// acceptSet takes `set` and `set model <model>` only
+func acceptSet(arr_cmd []string) bool {
+	return len(arr_cmd) == 1 || (len(arr_cmd) == 3 && arr_cmd[1] == "model")
+}
+
+// cmdSet handles `set model <model>`, which changes the model of the active role for this session
+func (bot *ChatBot) cmdSet(original_msg string, arr_cmd []string) (*PluginResult, error) {
+	log.Debug("Execute [set] command on : ", original_msg)
+
+	if len(arr_cmd) < 3 || arr_cmd[1] != "model" {
+		return &PluginResult{Output: config.Text("tips_set_usage")}, nil
+	}
+	bot.role.Model = arr_cmd[2]
+	return &PluginResult{Output: fmt.Sprintf(config.Text("tips_set_model"), bot.role.Name, bot.role.Model)}, nil
+}
+
+func (bot *ChatBot) cmdModels(original_msg string, arr_cmd []string) (*PluginResult, error) {
+	log.Debug("Execute [models] command on : ", original_msg)
+
+	var msg string
+	if config.MyConfig.IsSharedMode() {
+		msg = config.Text("tips_models_shared_limited")
+	} else {
+		models := bot.client.ListAllModels()
+		if models == nil {
+			msg = config.Text("tips_models_failed_fetch")
+		} else {
+			sort.Strings(models)
+			msg = config.Text("tips_models_now_support") + " : \n- " + strings.Join(models, "\n- ")
+		}
+	}
+	return &PluginResult{Output: msg}, nil
+}
+
+// acceptCache takes `cache`, `cache list` and `cache clear [kind]` only
+func acceptCache(arr_cmd []string) bool {
+	switch {
+	case len(arr_cmd) == 1:
+		return true
+	case arr_cmd[1] == "list" || arr_cmd[1] == "ls":
+		return len(arr_cmd) == 2
+	case arr_cmd[1] == "clear":
+		return len(arr_cmd) == 2 || (len(arr_cmd) == 3 && slices.Contains([]string{clientdb.CACHE_KIND_WEB, clientdb.CACHE_KIND_FILE, clientdb.CACHE_KIND_ANSWER}, arr_cmd[2]))
+	}
+	return false
+}
+
+// cmdCache handles `cache list` and `cache clear [web|file]`
+func (bot *ChatBot) cmdCache(original_msg string, arr_cmd []string) (*PluginResult, error) {
+	log.Debug("Execute [cache] command on : ", original_msg)
+
+	args := arr_cmd[1:]
+	if bot.clientdb == nil || len(args) == 0 {
+		return &PluginResult{Output: config.Text("tips_cache_usage")}, nil
+	}
+
+	switch args[0] {
+	case "list", "ls":
+		records, err := bot.clientdb.ListContentCache()
+		if err != nil {
+			return nil, err
+		}
+		if len(records) == 0 {
+			return &PluginResult{Output: config.Text("tips_cache_empty")}, nil
+		}
+
+		var sb strings.Builder
+		sb.WriteString(config.Text("tips_cache_list_header") + "\n|----|----|----|----|----|\n")
+		for _, record := range records {
+			expires := "-"
+			if !record.ExpiresAt.IsZero() {
+				expires = strftime.Format(record.ExpiresAt, "%Y-%m-%d %H:%M")
+			}
+			sb.WriteString(fmt.Sprintf(
+				"| %s | %s | %d | %s | %s |\n",
+				record.Kind,
+				record.Key,
+				record.Size,
+				strftime.Format(record.UpdatedAt, "%Y-%m-%d %H:%M"),
+				expires,
+			))
+		}
+		return &PluginResult{Output: sb.String()}, nil
+	case "clear":
+		var kind string
+		if len(args) > 1 {
+			kind = args[1]
+		}
+		if len(kind) > 0 && kind != clientdb.CACHE_KIND_WEB && kind != clientdb.CACHE_KIND_FILE && kind != clientdb.CACHE_KIND_ANSWER {
+			return &PluginResult{Output: config.Text("tips_cache_usage")}, nil
+		}
+
+		count, err := bot.clientdb.ClearContentCache(kind)
+		if err != nil {
+			return nil, err
+		}
+		return &PluginResult{Output: fmt.Sprintf(config.Text("tips_cache_cleared"), count)}, nil
+	default:
+		return &PluginResult{Output: config.Text("tips_cache_usage")}, nil
+	}
+}
+
+// acceptHelp takes `help` and `help <command>` only
+func (bot *ChatBot) acceptHelp(arr_cmd []string) bool {
+	return len(arr_cmd) == 1 || (len(arr_cmd) == 2 && bot.plugin_mgr.GetPlugin(arr_cmd[1]) != nil)
+}
+
+func (bot *ChatBot) cmdHelp(original_msg string, arr_cmd []string) (*PluginResult, error) {
+	var name string
+	if len(arr_cmd) > 1 {
+		name = arr_cmd[1]
+	}
+	return &PluginResult{Output: bot.plugin_mgr.Help(name)}, nil
+}
+
+func (bot *ChatBot) cmdQuit(original_msg string, arr_cmd []string) (*PluginResult, error) {
+	bot.Close(true)
+	return nil, nil
+}
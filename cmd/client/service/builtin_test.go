@@ -0,0 +1,99 @@
+package service
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/robinmin/xally/config"
+	"github.com/robinmin/xally/shared/clientdb"
+	"github.com/robinmin/xally/shared/secretstore"
+)
+
+func TestSecretNotRecalled(t *testing.T) {
+	assertions := require.New(t)
+
+	dir := t.TempDir()
+	config.UseTestConfig(t)
+	t.Setenv(secretstore.ENV_SECRET_KEY, "passphrase")
+	saved_secrets := config.MySecrets
+	defer func() { config.MySecrets = saved_secrets }()
+	config.MySecrets = secretstore.New(filepath.Join(dir, "secrets.age"), nil)
+	config.MySecrets.WorkFactor = 10
+
+	cdb, err := clientdb.InitClientDB(filepath.Join(dir, "xally.db"), false)
+	assertions.NoError(err)
+	bot := &ChatBot{
+		clientdb: cdb,
+		role:     &config.SysRole{Name: "default"},
+		console:  &terminalConsole{},
+	}
+	bot.plugin_mgr = NewPluginManager(cdb)
+	bot.registerBuiltins()
+
+	_, _, err = bot.CommandProcessor("secret set jira_token abc123", []string{"secret", "set", "jira_token", "abc123"})
+	assertions.NoError(err)
+	_, _, err = bot.CommandProcessor("secret get jira_token", []string{"secret", "get", "jira_token"})
+	assertions.NoError(err)
+	history, err := cdb.LoadOptionHistory("default", 10)
+	assertions.NoError(err)
+	assertions.Equal([]string{"secret get jira_token"}, history)
+
+	// the placeholder recalled from an older history never overwrites the secret
+	msg, _, err := bot.CommandProcessor("secret set jira_token "+SECRET_PLACEHOLDER, []string{"secret", "set", "jira_token", SECRET_PLACEHOLDER})
+	assertions.NoError(err)
+	assertions.Contains(msg, SECRET_PLACEHOLDER)
+	value, found, err := config.MySecrets.Get("jira_token")
+	assertions.NoError(err)
+	assertions.True(found)
+	assertions.Equal("abc123", value)
+}
+
+func TestBuiltinArgs(t *testing.T) {
+	assertions := require.New(t)
+	config.UseTestConfig(t)
+
+	bot := &ChatBot{plugin_mgr: NewPluginManager(nil)}
+	bot.registerBuiltins()
+
+	cases := map[string]bool{
+		"help":                        true,
+		"help vocab":                  true,
+		"help me write a poem":        false,
+		"history":                     true,
+		"history prune 100":           true,
+		"history of rome":             false,
+		"set model gpt-4":             true,
+		"set up nginx on ubuntu":      false,
+		"config show --effective":     true,
+		"config validate":             true,
+		"config files of nginx":       false,
+		"cache clear web":             true,
+		"cache invalidation is hard":  false,
+		"vocab review 10":             true,
+		"vocab export --anki a.csv":   true,
+		"vocab for the GRE":           false,
+		"image":                       true,
+		"image a.png -- what is it?":  true,
+		"image of a cat":              false,
+		"shell find the largest file": true,
+		"shell vs terminal?":          false,
+		"reset fullstack":             true,
+		"reset my password":           false,
+	}
+	for msg, accepted := range cases {
+		fields := strings.Fields(msg)
+		checker, ok := bot.plugin_mgr.GetPlugin(fields[0]).(PluginArgsChecker)
+		assertions.True(ok, msg)
+		assertions.Equal(accepted, checker.AcceptArgs(msg, fields), msg)
+	}
+
+	// the questions fall through to be asked
+	for _, msg := range []string{"history of rome", "models of the atom", "clear the cache of nginx"} {
+		processed, _, err := bot.plugin_mgr.Execute(msg, strings.Fields(msg))
+		assertions.NoError(err)
+		assertions.False(processed, msg)
+	}
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/robinmin/xally/config"
+)
+
+const PLUGIN_NAME_CMD_ASK = "cmd-ask"
+
+// limitedBuffer keeps the first limit bytes written into it and counts the rest
+type limitedBuffer struct {
+	sb      strings.Builder
+	limit   int
+	dropped int
+}
+
+func (buf *limitedBuffer) Write(data []byte) (int, error) {
+	if buf.limit > 0 && buf.sb.Len()+len(data) > buf.limit {
+		keep := buf.limit - buf.sb.Len()
+		if keep < 0 {
+			keep = 0
+		}
+		buf.sb.Write(data[:keep])
+		buf.dropped += len(data) - keep
+	} else {
+		buf.sb.Write(data)
+	}
+	return len(data), nil
+}
+
+func (buf *limitedBuffer) String() string {
+	content := strings.ToValidUTF8(buf.sb.String(), "")
+	if buf.dropped > 0 {
+		content = content + "\n" + fmt.Sprintf(config.Text("tips_cmd_output_truncated"), buf.dropped)
+	}
+	return content
+}
+
+// cmdCaptureAsk runs `cmd-ask <command> [-- <question>]`. The captured output
+// is asked together with the question, or kept for the next question.
+func (bot *ChatBot) cmdCaptureAsk(original_msg string, arr_cmd []string) (*PluginResult, error) {
+	log.Debug("Execute [cmd-ask] command on : ", original_msg)
+
+	cmd_fields, question := splitQuestion(original_msg, arr_cmd[1:])
+	if len(cmd_fields) == 0 {
+		return &PluginResult{Output: config.Text("tips_cmd_ask_usage")}, nil
+	}
+
+	captured, err := runCapture(cmd_fields, config.MyConfig.System.CmdOutputLimit)
+	if err != nil {
+		return &PluginResult{Output: err.Error(), NeedDump: true}, err
+	}
+	bot.Say(captured, true)
+
+	// attached to the question right now, or the next one
+	bot.pending_context = captured
+	if len(question) == 0 {
+		return &PluginResult{Output: config.Text("tips_cmd_output_pending")}, nil
+	}
+	return &PluginResult{Question: question}, nil
+}
+
+// runCapture runs the command and renders its stdout, stderr and exit code in Markdown
+func runCapture(cmd_fields []string, limit int) (string, error) {
+	stdout := &limitedBuffer{limit: limit}
+	stderr := &limitedBuffer{limit: limit}
+
+	cmd := exec.Command(cmd_fields[0], cmd_fields[1:]...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	exit_code := 0
+	if err := cmd.Run(); err != nil {
+		var exit_err *exec.ExitError
+		if !errors.As(err, &exit_err) {
+			return "", err
+		}
+		exit_code = exit_err.ExitCode()
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("```shell\n$ %s\n```\n", strings.Join(cmd_fields, " ")))
+	sb.WriteString(fmt.Sprintf(config.Text("tips_cmd_exit_code"), exit_code) + "\n\n")
+	if out := stdout.String(); len(strings.TrimSpace(out)) > 0 {
+		sb.WriteString("stdout:\n```\n" + strings.TrimRight(out, "\n") + "\n```\n")
+	}
+	if out := stderr.String(); len(strings.TrimSpace(out)) > 0 {
+		sb.WriteString("stderr:\n```\n" + strings.TrimRight(out, "\n") + "\n```\n")
+	}
+	return sb.String(), nil
+}
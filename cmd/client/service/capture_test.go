@@ -0,0 +1,26 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunCapture(t *testing.T) {
+	assertions := require.New(t)
+
+	captured, err := runCapture([]string{"sh", "-c", "echo hello; echo oops >&2; exit 3"}, 0)
+	assertions.NoError(err)
+	assertions.Contains(captured, "$ sh -c echo hello; echo oops >&2; exit 3")
+	assertions.Contains(captured, "stdout:\n```\nhello\n```")
+	assertions.Contains(captured, "stderr:\n```\noops\n```")
+	assertions.Contains(captured, "3")
+
+	captured, err = runCapture([]string{"sh", "-c", "printf 0123456789"}, 4)
+	assertions.NoError(err)
+	assertions.Contains(captured, "```\n0123\n")
+	assertions.NotContains(captured, "```\n01234")
+
+	_, err = runCapture([]string{"xally-no-such-command"}, 0)
+	assertions.Error(err)
+}
@@ -3,17 +3,16 @@ package service
 import (
 	"errors"
 	"fmt"
+	"math"
 	"os"
-	"os/exec"
 	"os/user"
 	"path"
 	"path/filepath"
-	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/c-bata/go-prompt"
-	"github.com/fatih/color"
 	strftime "github.com/itchyny/timefmt-go"
 
 	log "github.com/sirupsen/logrus"
@@ -21,106 +20,15 @@ import (
 	"github.com/robinmin/xally/config"
 	"github.com/robinmin/xally/shared/clientdb"
 	"github.com/robinmin/xally/shared/model"
+	"github.com/robinmin/xally/shared/translator"
 	"github.com/robinmin/xally/shared/utility"
 )
 
 const default_user_avatar = "🧑"
 const prompt_tip_flag = " ▶ "
 
-type suggestionType int
-
-const (
-	// execute host command on local machine
-	Ask suggestionType = iota
-
-	// translate text
-	Translate
-
-	// data from web page contents
-	Web
-
-	// data from file contents
-	File
-
-	// execute host command on local machine
-	Cmd
-
-	// clear all conversation history
-	Clear
-
-	// Config system setting
-	Config
-
-	// show all supported models
-	Models
-
-	// Reset suggestion
-	Reset
-
-	// Quit suggestion
-	Quit
-
-	// Others is key for various arbitrary suggestions
-	Others
-)
-
-func get_suggestion_map(role_name string) *map[suggestionType][]prompt.Suggest {
-	// culmulate role list
-	reset_rolese := []prompt.Suggest{}
-	for _, tmp_role := range config.MyConfig.Roles {
-		reset_rolese = append(reset_rolese, prompt.Suggest{
-			Text:        "reset " + tmp_role.Name,
-			Description: config.Text("tips_suggestion_reset") + tmp_role.Name + tmp_role.Avatar,
-		})
-	}
-
-	suggestionsMap := &map[suggestionType][]prompt.Suggest{
-		Ask: {
-			{Text: "ask", Description: config.Text("tips_suggestion_ask")},
-		},
-		Translate: {
-			{Text: "translate", Description: config.Text("tips_suggestion_translate")},
-			{Text: "lookup", Description: config.Text("tips_suggestion_translate")},
-		},
-		Web: {
-			{Text: PLUGIN_NAME_WEB_CONTENT, Description: config.Text("tips_suggestion_web_content")},
-			{Text: PLUGIN_NAME_WEB_SUMMARY, Description: config.Text("tips_suggestion_web_summary")},
-			{Text: PLUGIN_NAME_WEB_TRANSLATE_CN, Description: config.Text("tips_suggestion_web_translate_cn")},
-			{Text: PLUGIN_NAME_WEB_TRANSLATE_EN, Description: config.Text("tips_suggestion_web_translate_en")},
-			{Text: PLUGIN_NAME_WEB_TRANSLATE_JP, Description: config.Text("tips_suggestion_web_translate_jp")},
-		},
-		File: {
-			{Text: PLUGIN_NAME_FILE_CONTENT, Description: config.Text("tips_suggestion_file_content")},
-			{Text: PLUGIN_NAME_FILE_SUMMARY, Description: config.Text("tips_suggestion_file_summary")},
-			{Text: PLUGIN_NAME_FILE_TRANSLATE_CN, Description: config.Text("tips_suggestion_file_translate_cn")},
-			{Text: PLUGIN_NAME_FILE_TRANSLATE_EN, Description: config.Text("tips_suggestion_file_translate_en")},
-			{Text: PLUGIN_NAME_FILE_TRANSLATE_JP, Description: config.Text("tips_suggestion_file_translate_jp")},
-		},
-		Cmd: {
-			{Text: "cmd", Description: config.Text("tips_suggestion_cmd")},
-		},
-		Clear: {
-			{Text: "clear", Description: config.Text("tips_suggestion_clear")},
-		},
-		Config: {
-			{Text: "config-email", Description: config.Text("tips_suggestion_config_email")},
-		},
-		Models: {
-			{Text: "models", Description: config.Text("tips_suggestion_models")},
-		},
-		Reset: reset_rolese,
-		Quit: {
-			{Text: "q、88", Description: config.Text("tips_suggestion_quit")},
-			// {Text: "88", Description: config.Text("tips_suggestion_quit")},
-			// {Text: "886", Description: config.Text("tips_suggestion_quit")},
-			// {Text: "bye", Description: config.Text("tips_suggestion_quit")},
-			// {Text: "quit", Description: config.Text("tips_suggestion_quit")},
-			{Text: "exit、quit", Description: config.Text("tips_suggestion_quit")},
-		},
-		Others: {},
-	}
-	return suggestionsMap
-}
+// glossary of the current project, on top of the global one
+const PROJECT_GLOSSARY_FILE = ".xally/glossary.csv"
 
 type LivePrefixState struct {
 	LivePrefix string
@@ -172,9 +80,26 @@ type ChatBot struct {
 	prompt                   *prompt.Prompt
 	clientdb                 *clientdb.ClientDB
 
-	plugin_mgr *PluginManager
-	kb_padding *LivePrefixState
-	connected  bool
+	plugin_mgr     *PluginManager
+	translator     *translator.Chain
+	kb_padding     *LivePrefixState
+	config_watcher *config.Watcher
+	watch_stop     chan struct{}
+	// held by the running command, so the configuration is not reloaded under it
+	exec_mutex sync.Mutex
+	// held while the configuration is reloaded, against the completer and Status
+	state_mutex    sync.RWMutex
+	service_models []string // models of the service to complete, fetched in the background
+	history_search *historySearch
+	console        Console
+	usage          UsageStats // of the last answer
+	connected      bool
+	last_answer    string
+
+	// captured command output waiting for the next question
+	pending_context string
+	// images attached to the next question
+	pending_images []*imageAttachment
 }
 
 func NewChatbot(chat_history_path string, name string, role_name string, log_history bool, verbose bool) *ChatBot {
@@ -189,6 +114,7 @@ func NewChatbot(chat_history_path string, name string, role_name string, log_his
 		token_counter_completion: 0,
 		token_counter_prompt:     0,
 		prompt:                   nil,
+		console:                  terminalConsole{},
 	}
 	if role_name == "" {
 		bot.resetRole(config.MyConfig.System.DefaultRole, true)
@@ -196,39 +122,40 @@ func NewChatbot(chat_history_path string, name string, role_name string, log_his
 		bot.resetRole(role_name, true)
 	}
 
-	// initialize all plugins and plugin manager
-	bot.plugin_mgr = NewPluginManager()
-	bot.plugin_mgr.Open()
-
 	bot.clientdb, _ = clientdb.InitClientDB(path.Join(config.MyConfig.System.ChatHistoryPath, "xally.db"), verbose)
+	bot.setupResponseCache()
 
-	var option_history []string
-	var err error
-	if bot.clientdb != nil {
-		if option_history, err = bot.clientdb.LoadOptionHistory(bot.role.Name); err != nil {
-			log.Error("Failed to load option history: ", err)
+	// initialize all plugins and plugin manager
+	bot.plugin_mgr = NewPluginManager(bot.clientdb)
+	bot.registerBuiltins()
+	bot.setupTranslator()
+	for _, plugin := range LoadExternalPlugins(
+		config.MyConfig.System.PluginPath,
+		time.Duration(config.MyConfig.System.PluginTimeout)*time.Second,
+		func() string { return bot.role.Name },
+	) {
+		if err := bot.plugin_mgr.AddPlugin(plugin); err != nil {
+			log.Error("Failed to register external plugin : ", err)
+		}
+	}
+	for _, plugin := range LoadScriptPlugins(config.MyConfig.System.ScriptPath, bot) {
+		if err := bot.plugin_mgr.AddPlugin(plugin); err != nil {
+			log.Error("Failed to register script : ", err)
 		}
 	}
+	bot.plugin_mgr.Open()
+	utility.DefaultRetryPolicy.OnRetry = bot.retryNotice
+	bot.config_watcher = config.NewWatcher(config.MyConfig.WatchedFiles()...)
 
 	// add keyboard padding to support multiple lines when inputting
 	bot.kb_padding = &LivePrefixState{}
 	bot.kb_padding.ResetInputMode()
 
-	bot.prompt = prompt.New(
-		bot.getExecutor(""),
-		bot.completer,
-		prompt.OptionTitle(bot.name+" / "+config.Version),
-		// prompt.OptionPrefix(default_user_avatar+prompt_tip_flag),
-		prompt.OptionPrefix("... "),
-		prompt.OptionPrefixTextColor(prompt.Yellow),
-		prompt.OptionLivePrefix(bot.kb_padding.ChangeLivePrefix),
-		prompt.OptionHistory(option_history),
-		prompt.OptionPreviewSuggestionTextColor(prompt.Blue),
-		prompt.OptionSelectedSuggestionBGColor(prompt.LightGray),
-		prompt.OptionSuggestionBGColor(prompt.DarkGray),
-	)
+	return bot
+}
 
-	// greetings once everything is ready
+// Greet checks the connectivity and says hello once everything is ready
+func (bot *ChatBot) Greet() {
 	bot.dumpChatHistory("\n")
 
 	flags := strftime.Format(time.Now(), "%m-%d %H:%M ") + config.MyConfig.GetCurrentMode(bot.CheckConnectivity())
@@ -242,35 +169,39 @@ func NewChatbot(chat_history_path string, name string, role_name string, log_his
 		flags,
 	)
 	bot.Say(greeting_msg, false)
-
-	return bot
 }
 
+// Run starts the REPL on the terminal
 func (bot *ChatBot) Run() {
-	if bot.prompt != nil {
-		bot.prompt.Run()
+	var option_history []string
+	var err error
+	if bot.clientdb != nil {
+		if option_history, err = bot.clientdb.LoadOptionHistory(bot.role.Name, config.MyConfig.System.HistoryLimit); err != nil {
+			log.Error("Failed to load option history: ", err)
+		}
 	}
-}
 
-func (bot *ChatBot) completer(doc prompt.Document) []prompt.Suggest {
-	suggestions := []prompt.Suggest{}
-	word := strings.ToLower(doc.TextBeforeCursor())
-
-	suggestionsMap := get_suggestion_map(bot.role.Name)
-	switch word {
-	case "":
-		return suggestions
-	default:
-		for _, s := range *suggestionsMap {
-			suggestions = append(suggestions, s...)
-		}
-		return prompt.FilterHasPrefix(suggestions, doc.TextBeforeCursor(), true)
+	bot.history_search = &historySearch{load: bot.fullHistory}
+
+	options := []prompt.Option{
+		prompt.OptionTitle(bot.name + " / " + config.Version),
+		// prompt.OptionPrefix(default_user_avatar+prompt_tip_flag),
+		prompt.OptionPrefix("... "),
+		prompt.OptionPrefixTextColor(prompt.Yellow),
+		prompt.OptionLivePrefix(bot.livePrefix),
+		prompt.OptionHistory(option_history),
+		prompt.OptionPreviewSuggestionTextColor(prompt.Blue),
+		prompt.OptionSelectedSuggestionBGColor(prompt.LightGray),
+		prompt.OptionSuggestionBGColor(prompt.DarkGray),
 	}
+	bot.prompt = prompt.New(bot.getExecutor(""), bot.completer, append(options, bot.historyOptions()...)...)
+	bot.prompt.Run()
 }
 
 func (bot *ChatBot) getExecutor(dir string) func(string) {
 	return func(cmds string) {
-		log.Debug("Executor running on :" + cmds)
+		log.Debug("Executor running on :" + redactSecret(cmds))
+		bot.history_search.Stop()
 		if cmds == "" {
 			log.Debug("Blank command!")
 			return
@@ -281,230 +212,106 @@ func (bot *ChatBot) getExecutor(dir string) func(string) {
 			log.Debug("Enter into multiple line mo")
 			return
 		}
+		bot.Execute(cmds)
+	}
+}
 
-		switch cmds {
-		case "":
-			return
-		case "quit", "exit", "bye", "886", "88", "q":
-			bot.Close(true)
-		default:
-			commandFields := strings.Fields(cmds)
-			msg, need_dump, err := bot.CommandProcessor(cmds, commandFields)
-			if err != nil {
-				log.Error(err.Error())
-				if config.MyConfig.DebugMode() {
-					bot.Say(err.Error(), false)
-				}
-				if len(msg) > 0 {
-					bot.Say(msg, need_dump)
-				}
-			} else {
-				if len(msg) > 0 {
-					bot.Say(msg, need_dump)
-				}
-			}
+// Execute runs the input as a command, or asks it if it is not a command
+func (bot *ChatBot) Execute(cmds string) {
+	bot.exec_mutex.Lock()
+	defer bot.exec_mutex.Unlock()
+
+	commandFields := strings.Fields(cmds)
+	msg, need_dump, err := bot.CommandProcessor(cmds, commandFields)
+	if err != nil {
+		log.Error(err.Error())
+		if config.MyConfig.DebugMode() {
+			bot.Say(err.Error(), false)
 		}
 	}
+	if len(msg) > 0 {
+		bot.Say(msg, need_dump)
+	}
 }
 
 func (bot *ChatBot) CommandProcessor(original_msg string, arr_cmd []string) (string, bool, error) {
 	msg := ""
 	need_dump := false
-	var err error
 
 	if original_msg == "" {
 		return msg, need_dump, errors.New("Invalid parameters for commandProcessor")
 	}
 
-	log.Debug("Executor dispatching to commander :" + original_msg)
-	if bot.clientdb != nil {
+	log.Debug("Executor dispatching to commander :" + redactSecret(original_msg))
+	// a secret given inline is not recorded at all, the line would be useless to recall
+	if bot.clientdb != nil && redactSecret(original_msg) == original_msg {
 		bot.clientdb.AddOptionHistory(&clientdb.OptionHistory{
 			Role:   bot.role.Name,
 			Option: original_msg,
 		})
 	}
 
-	// switch to plugin manager to translate the command and content
-	tmp_processed, tmp_replaced_msg, tmp_replaced_cmd, tmp_err := bot.plugin_mgr.Execute(original_msg, arr_cmd)
-	if tmp_processed {
-		if tmp_err == nil {
-			original_msg = tmp_replaced_msg
-			arr_cmd = tmp_replaced_cmd
-		} else {
-			msg = "[ERROR]" + tmp_err.Error()
-			bot.Say("[ERROR]"+tmp_err.Error(), true)
-			return msg, need_dump, tmp_err
-		}
-	}
-
-	if arr_cmd == nil || len(arr_cmd) <= 0 {
-		return msg, need_dump, errors.New("Invalid updated parameters for commandProcessor")
-	}
-
-	switch arr_cmd[0] {
-	case "reset":
-		log.Debug("Execute [reset] command on : ", original_msg)
-
-		var role string
-		if len(arr_cmd) > 1 {
-			role = strings.ToLower(arr_cmd[1])
-		} else {
-			role = config.MyConfig.System.DefaultRole
-		}
-		bot.resetRole(role, false)
-	case "clear", "cls":
-		log.Debug("Execute [clear / cls] command")
-
-		bot.resetRole(config.MyConfig.System.DefaultRole, true)
-	case "ask":
-		if len(original_msg) > len(arr_cmd[0]) {
-			log.Debug("Execute [ask] command on : ", original_msg)
-
-			question := original_msg[len(arr_cmd[0]):]
-			if need_quit := bot.Ask(question); need_quit {
-				bot.Close(true)
-			}
-		}
-
-	case PLUGIN_NAME_FILE_CONTENT:
-		if len(original_msg) > 3 {
-			log.Debug("Execute [file-content] command on : ", original_msg)
-
-			bot.Say("> "+strings.ReplaceAll(original_msg, "\n", "\n> ")+"\n", true)
-			if need_quit := bot.Ask(original_msg); need_quit {
-				bot.Close(true)
-			}
-		}
-	case PLUGIN_NAME_FILE_SUMMARY:
-		fallthrough
-	case PLUGIN_NAME_FILE_TRANSLATE_CN:
-		fallthrough
-	case PLUGIN_NAME_FILE_TRANSLATE_EN:
-		fallthrough
-	case PLUGIN_NAME_FILE_TRANSLATE_JP:
-		if len(original_msg) > len(arr_cmd[0]) {
-			log.Debugf("Execute [%s] command on : %s", arr_cmd[0], original_msg)
-
-			bot.Say("> "+strings.ReplaceAll(original_msg, "\n", "\n> ")+"\n", true)
-			if need_quit := bot.Ask(original_msg); need_quit {
-				bot.Close(true)
-			}
-		}
-
-	case PLUGIN_NAME_WEB_CONTENT:
-		if len(original_msg) > len(arr_cmd[0]) {
-			log.Debug("Execute [web-content] command on : ", original_msg)
+	// dispatch to the registered command or plugin, fallback to ask chatGPT
+	processed, result, err := bot.plugin_mgr.Execute(original_msg, arr_cmd)
+	if !processed {
+		log.Debug("Execute fallback command on : ", original_msg)
 
-			bot.Say("> "+strings.ReplaceAll(original_msg, "\n", "\n> ")+"\n", true)
+		if len(original_msg) <= 1 {
+			msg = config.Text("sys_not_enough_cmd")
+			return msg, true, errors.New(msg)
 		}
-	case PLUGIN_NAME_WEB_SUMMARY:
-		fallthrough
-	case PLUGIN_NAME_WEB_TRANSLATE_CN:
-		fallthrough
-	case PLUGIN_NAME_WEB_TRANSLATE_EN:
-		fallthrough
-	case PLUGIN_NAME_WEB_TRANSLATE_JP:
-		if len(original_msg) > len(arr_cmd[0]) {
-			log.Debug("Execute [%] command on : ", arr_cmd[0], original_msg)
-
-			bot.Say("> "+strings.ReplaceAll(original_msg, "\n", "\n> ")+"\n", true)
-			if need_quit := bot.Ask(original_msg); need_quit {
-				bot.Close(true)
-			}
+		if need_quit := bot.Ask(original_msg); need_quit {
+			bot.Close(true)
 		}
+		return msg, need_dump, nil
+	}
 
-	case "lookup":
-		log.Debug("Execute [lookup] command on : ", original_msg)
-
-		question := original_msg[len(arr_cmd[0]):]
-		msg, err = utility.Lookup(question, config.MyConfig.System.PeferenceLanguage)
-		if err == nil {
-			need_dump = true
+	if err != nil {
+		msg = "[ERROR]" + err.Error()
+		if result != nil && len(result.Output) > 0 {
+			msg = result.Output
 		}
-	case "translate":
-		log.Debug("Execute [translate] command on : ", original_msg)
+		return msg, true, err
+	}
+	if result == nil {
+		return msg, need_dump, nil
+	}
 
-		question := original_msg[len(arr_cmd[0]):]
-		msg, err = utility.Translate(question, config.MyConfig.System.PeferenceLanguage)
-		if err == nil {
-			need_dump = true
+	if len(result.Quote) > 0 {
+		bot.Say(quoteMessage(result.Quote), true)
+	}
+	if len(result.Question) > 0 {
+		if need_quit := bot.Ask(result.Question); need_quit {
+			bot.Close(true)
 		}
-	case "cmd":
-		log.Debug("Execute [cmd] command on : ", original_msg)
-
-		if len(arr_cmd) > 1 {
-			var cmd_args []string
+	}
+	return result.Output, result.NeedDump, nil
+}
 
-			cmd_real := strings.ToLower(arr_cmd[1])
-			if len(arr_cmd) > 2 {
-				cmd_args = arr_cmd[2:]
-			}
-			log.Debug("cmd_real = ", cmd_real)
-			log.Debug("cmd_args = ", cmd_args)
-
-			if len(cmd_real) > 0 && cmd_real != "exit" {
-				obj_cmd := exec.Command(cmd_real, cmd_args...)
-				obj_cmd.Stdout = os.Stdout
-				obj_cmd.Stderr = os.Stderr
-
-				//	Run the command
-				if err = obj_cmd.Run(); err != nil {
-					msg = err.Error()
-					need_dump = true
-				}
-			} else {
-				msg = config.Text("sys_invalid_cmd")
-				need_dump = true
-				err = errors.New(msg)
-			}
-		} else {
-			msg = ""
-			need_dump = true
-			err = errors.New(config.Text("sys_not_enough_cmd"))
-		}
-	case "config-email":
-		log.Debug("Execute [cmd] command on : ", original_msg)
+////////////////////////////////////////////////////////////////
 
-		if len(arr_cmd) >= 3 {
-			msg, err = bot.client.UserRegistration(arr_cmd[1], arr_cmd[2])
-		} else {
-			msg = config.Text("tips_config_email_usage")
-			need_dump = false
-		}
-	case "models":
-		log.Debug("Execute [models] command on : ", original_msg)
-		if config.MyConfig.IsSharedMode() {
-			msg = config.Text("tips_models_shared_limited")
-		} else {
-			models := bot.client.ListAllModels()
-			if models == nil {
-				msg = config.Text("tips_models_failed_fetch")
-			} else {
-				sort.Strings(models)
-				msg = config.Text("tips_models_now_support") + " : \n- " + strings.Join(models, "\n- ")
-			}
-		}
-		need_dump = false
-	default:
-		log.Debug("Execute fallback command on : ", original_msg)
+func (bot *ChatBot) setupTranslator() {
+	bot.translator = translator.NewChain(config.MyConfig.System.Translators, &translator.Options{
+		DeepLAPIKey:        config.MyConfig.System.DeeplApiKey,
+		DeepLEndpoint:      config.MyConfig.System.APIEndpointDeepl,
+		DictionaryPath:     config.MyConfig.System.DictionaryPath,
+		GlossarySourceLang: config.MyConfig.System.GlossarySourceLang,
+		Ask: func(system_prompt string, text string) (string, error) {
+			answer, _, err := bot.askOneShot(&config.SysRole{Name: bot.role.Name, Model: bot.role.Model, Prompt: system_prompt}, text)
+			return answer, err
+		},
+	})
+}
 
-		// treat empty commands as ask chatGPT
-		if len(original_msg) > 1 {
-			if need_quit := bot.Ask(original_msg); need_quit {
-				bot.Close(true)
-			}
-		} else {
-			msg = config.Text("sys_not_enough_cmd")
-			need_dump = true
-			err = errors.New(msg)
-		}
+// setupResponseCache turns the response cache on or off as configured
+func (bot *ChatBot) setupResponseCache() {
+	if config.MyConfig.System.ResponseCache {
+		bot.client.SetResponseCache(bot.clientdb)
+	} else {
+		bot.client.SetResponseCache(nil)
 	}
-
-	return msg, need_dump, err
 }
 
-////////////////////////////////////////////////////////////////
-
 func (bot *ChatBot) resetRole(role_name string, keep_silent bool) {
 	if role, err := config.MyConfig.FindRole(role_name); err != nil {
 		bot.Say(fmt.Sprintf(config.Text("error_invalid_role"), role_name), true)
@@ -537,6 +344,7 @@ func (bot *ChatBot) resetRole(role_name string, keep_silent bool) {
 }
 
 func (bot *ChatBot) Close(exit bool) {
+	bot.stopWatchConfig()
 	bot.plugin_mgr.Close()
 
 	if bot.chat_history_file != nil {
@@ -554,17 +362,22 @@ func (bot *ChatBot) Close(exit bool) {
 	}
 
 	if exit {
-		os.Exit(0)
+		bot.getConsole().Quit()
 	}
 }
 
 func (bot *ChatBot) Say(msg string, need_dump bool) {
-	utility.EchoInfo(msg)
+	bot.getConsole().Say(msg)
 	if need_dump {
 		bot.dumpChatHistory(msg)
 	}
 }
 
+// retryNotice tells the user a request is sent again after waiting
+func (bot *ChatBot) retryNotice(delay time.Duration, reason string) {
+	bot.Say(fmt.Sprintf(config.Text("tips_retrying"), int(math.Ceil(delay.Seconds())), reason), false)
+}
+
 func (bot *ChatBot) Ask(question string) bool {
 	if !bot.connected {
 		bot.Say(config.Text("tips_not_connected"), false)
@@ -573,14 +386,39 @@ func (bot *ChatBot) Ask(question string) bool {
 
 	need_quit := false
 
+	question, err := bot.attachImageRefs(question)
+	if err != nil {
+		bot.pending_images = nil
+		bot.Say(err.Error(), true)
+		log.Error(err)
+		return need_quit
+	}
 	if len(question) <= 2 {
+		// the images are dropped with the question, not sent with the next one
+		bot.pending_images = nil
 		msg := config.Text("sys_not_enough_cmd")
 		bot.Say(msg, true)
 		log.Error(msg)
 		return need_quit
 	}
-	// add question into the conversation history
-	bot.updateHistory("user", question)
+	// add question into the conversation history, the captured command output attached as
+	// its context and the images count toward the token budget
+	question_len := len(question)
+	if len(bot.pending_context) > 0 {
+		cmd_context := config.Text("prompt_cmd_context") + "\n\n" + bot.pending_context
+		bot.client.AddMsgHistory("user", cmd_context)
+		bot.pending_context = ""
+		question_len += len(cmd_context)
+	}
+	if images := bot.pending_images; len(images) > 0 {
+		bot.pending_images = nil
+		for _, img := range images {
+			question_len += img.tokens
+		}
+		bot.addImageQuestion(question, images)
+	} else {
+		bot.updateHistory("user", question)
+	}
 
 	start := time.Now()
 
@@ -591,7 +429,7 @@ func (bot *ChatBot) Ask(question string) bool {
 	} else {
 		init_msg_len = 1
 	}
-	need_reset, token_len := bot.client.AdjustMsgHistory(init_msg_len, len(question), bot.role.Model)
+	need_reset, token_len := bot.client.AdjustMsgHistory(init_msg_len, question_len, bot.role.Model)
 	if need_reset {
 		// we assume the default configuration is fine
 		bot.resetRole(bot.role.Name, true)
@@ -608,7 +446,7 @@ func (bot *ChatBot) Ask(question string) bool {
 		username = ""
 	}
 
-	resp, err := bot.client.CreateChatCompletionEx(bot.role.Model, token_len, bot.role.Temperature, bot.role.Name, username, chat_history)
+	resp, cached, err := bot.client.CreateChatCompletionEx(bot.role.Model, token_len, bot.role.Temperature, bot.role.Name, username, chat_history, bot.role.IsCacheable())
 	if err != nil {
 		msg := err.Error()
 		bot.Say(msg, true)
@@ -641,21 +479,19 @@ func (bot *ChatBot) Ask(question string) bool {
 			message = "Invalid response from server."
 		}
 
-		fmt.Println(bot.role.Avatar + prompt_tip_flag)
-		bot.Say(message, false)
-
-		gray := color.New(color.FgHiBlack).PrintfFunc()
-		gray(
-			"%40s ( %d + %d = %d ) %ds       %s : %d\n\n",
-			strftime.Format(time.Now(), "%Y-%m-%d %H:%M:%S"),
-			bot.token_counter_prompt,
-			bot.token_counter_completion,
-			bot.token_counter_total,
-			elapsed/100000000,
-			strings.Repeat("░", bot.client.GetMsgHistoryLength()),
-			bot.client.EstimateAvailableTokenNumber(bot.role.Model, len(question)),
-		)
+		bot.getConsole().Answer(bot.role.Avatar, message)
+		bot.usage = UsageStats{
+			Prompt:        bot.token_counter_prompt,
+			Completion:    bot.token_counter_completion,
+			Total:         bot.token_counter_total,
+			Elapsed:       elapsed,
+			HistoryLength: bot.client.GetMsgHistoryLength(),
+			Available:     bot.client.EstimateAvailableTokenNumber(bot.role.Model, question_len),
+			Cached:        cached,
+		}
+		bot.getConsole().Usage(&bot.usage)
 		bot.updateHistory("assistant", message)
+		bot.last_answer = message
 
 		bot.kb_padding.ResetInputMode()
 	}
@@ -663,6 +499,64 @@ func (bot *ChatBot) Ask(question string) bool {
 	return need_quit
 }
 
+// askForAnswer asks within the current conversation and returns the answer
+func (bot *ChatBot) askForAnswer(question string) (string, error) {
+	bot.last_answer = ""
+	if need_quit := bot.Ask(question); need_quit {
+		bot.Close(true)
+	}
+	if len(bot.last_answer) == 0 {
+		return "", errors.New("no answer from chatGPT")
+	}
+	return bot.last_answer, nil
+}
+
+// AskAs asks the question on behalf of another role in a one-off conversation,
+// the current conversation is left untouched
+func (bot *ChatBot) AskAs(role_name string, question string) (string, error) {
+	role, err := config.MyConfig.FindRole(role_name)
+	if err != nil {
+		return "", err
+	}
+
+	message, cached, err := bot.askOneShot(role, question)
+	if err != nil {
+		return "", err
+	}
+	bot.getConsole().Answer(role.Avatar, message)
+	if cached {
+		bot.Say(config.Text("tips_answer_cached"), false)
+	}
+	bot.dumpChatHistory(role.Avatar + prompt_tip_flag + "\n" + message + "\n\n")
+	return message, nil
+}
+
+// askOneShot asks the question with the prompt of the role only and returns the answer silently,
+// and whether it comes from the response cache
+func (bot *ChatBot) askOneShot(role *config.SysRole, question string) (string, bool, error) {
+	if !bot.connected {
+		return "", false, errors.New(config.Text("tips_not_connected"))
+	}
+
+	var username string
+	if current_user, err := user.Current(); err == nil {
+		username = current_user.Username
+	}
+
+	chat_history := &model.ConversationHistory{}
+	resp, cached, err := bot.client.CreateOneShotCompletion(role, question, username, chat_history)
+	if err != nil {
+		return "", false, err
+	}
+	if !bot.clientdb.AddChatHistory(chat_history) {
+		log.Error("Failed to write chat history into local database.")
+	}
+	if len(resp.Choices) == 0 {
+		return "", false, errors.New("Invalid response from server.")
+	}
+	return resp.Choices[0].Message.Content, cached, nil
+}
+
 func (bot *ChatBot) updateHistory(role string, content string) {
 	// update conversation history
 	bot.client.AddMsgHistory(role, content)
@@ -730,6 +624,7 @@ func (bot *ChatBot) CheckConnectivity() bool {
 			bot.connected = false
 		} else {
 			bot.connected = true
+			bot.fetchModels()
 		}
 		return bot.connected
 	}
@@ -758,6 +653,21 @@ func (bot *ChatBot) CheckConnectivity() bool {
 	// return false
 }
 
+// fetchModels lists the models of the service for the completer in the background, as
+// it goes over the network. The list is dropped if the client is replaced meanwhile.
+func (bot *ChatBot) fetchModels() {
+	client := bot.client
+	go func() {
+		models := client.ListAllModels()
+
+		bot.state_mutex.Lock()
+		defer bot.state_mutex.Unlock()
+		if bot.client == client {
+			bot.service_models = models
+		}
+	}()
+}
+
 func (bot *ChatBot) ShakeHands() (string, error) {
 	// avoid to contact with the server if non-relay server case
 	if config.MyConfig.System.UseSharedMode == 0 {
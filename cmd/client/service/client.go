@@ -3,12 +3,17 @@ package service
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"mime/multipart"
 	"net/http"
-	"path"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	gpt3 "github.com/sashabaranov/go-openai"
@@ -17,6 +22,7 @@ import (
 
 	"github.com/robinmin/xally/cmd/server/controller"
 	"github.com/robinmin/xally/config"
+	"github.com/robinmin/xally/shared/clientdb"
 	"github.com/robinmin/xally/shared/model"
 	"github.com/robinmin/xally/shared/utility"
 )
@@ -27,6 +33,10 @@ type ChatGPTCLient struct {
 	HTTPClient     *http.Client
 	msg_history    []gpt3.ChatCompletionMessage
 	support_models map[string]ModelData
+	// the models are also listed in the background for the completer
+	models_mutex sync.Mutex
+	// answers of the identical requests, no cache if nil
+	response_cache *clientdb.ClientDB
 }
 
 type ObjectType string
@@ -79,11 +89,13 @@ func NewChatBotClient(api_key string, api_endpoint string) *ChatGPTCLient {
 	if len(api_endpoint) > 0 {
 		api_cfg.BaseURL = api_endpoint
 	}
+	http_client := utility.NewHTTPClient(0)
+	api_cfg.HTTPClient = http_client
 
 	log.Debug("api_cfg.BaseURL  = " + api_cfg.BaseURL)
 	client := &ChatGPTCLient{
 		Client:         *gpt3.NewClientWithConfig(api_cfg),
-		HTTPClient:     api_cfg.HTTPClient,
+		HTTPClient:     http_client,
 		support_models: map[string]ModelData{},
 	}
 	client.ResetMsgHistory("system", "")
@@ -91,8 +103,61 @@ func NewChatBotClient(api_key string, api_endpoint string) *ChatGPTCLient {
 	return client
 }
 
+// SetupNetwork routes all outbound requests through the proxy and the CA bundle of the configuration
+func SetupNetwork(cfg *config.SysConfig) error {
+	return utility.SetupNetwork(utility.NetworkSettings{
+		ProxyURL: cfg.System.ProxyURL,
+		NoProxy:  cfg.System.NoProxy,
+		CABundle: cfg.System.CABundle,
+	})
+}
+
+// SetResponseCache reuses the answers kept in the database for the identical requests, nil to turn it off
+func (c *ChatGPTCLient) SetResponseCache(cdb *clientdb.ClientDB) {
+	c.response_cache = cdb
+}
+
+// responseCacheKey hashes everything deciding the answer, i.e. the model, the messages and the sampling parameters
+func responseCacheKey(request *gpt3.ChatCompletionRequest) string {
+	data, _ := json.Marshal(struct {
+		Model       string                       `json:"model"`
+		Messages    []gpt3.ChatCompletionMessage `json:"messages"`
+		MaxTokens   int                          `json:"max_tokens"`
+		Temperature float32                      `json:"temperature"`
+		TopP        float32                      `json:"top_p"`
+		N           int                          `json:"n"`
+	}{request.Model, request.Messages, request.MaxTokens, request.Temperature, request.TopP, request.N})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// requestModel is the model the request goes to, only gpt-3.5-turbo is allowed in shared mode
+func requestModel(model string) string {
+	if config.MyConfig.IsSharedMode() || model == "" {
+		return gpt3.GPT3Dot5Turbo
+	}
+	return model
+}
+
+// SupportsImages tells whether the model reads the images attached to the messages. The
+// models known to be text only are refused, the newer or custom ones are left to the API.
+func SupportsImages(model string) bool {
+	model = requestModel(model)
+	if strings.HasPrefix(model, "gpt-3.5") || strings.HasPrefix(model, "text-") || strings.HasPrefix(model, "code-") {
+		return false
+	}
+	switch model {
+	case gpt3.GPT4, gpt3.GPT40314, gpt3.GPT40613, gpt3.GPT432K, gpt3.GPT432K0314, gpt3.GPT432K0613:
+		return false
+	}
+	return true
+}
+
 // check if the model is available
 func (c *ChatGPTCLient) IsAvailable(model string) bool {
+	c.models_mutex.Lock()
+	defer c.models_mutex.Unlock()
+
 	// fetch support models at the first time
 	err := c.getSupportModels()
 	if err != nil {
@@ -113,20 +178,14 @@ func (c *ChatGPTCLient) CreateChatCompletionEx(
 	role_name string,
 	username string,
 	chat_history *model.ConversationHistory,
+	cacheable bool,
 	// ctx context.Context,
 	// request gpt3.ChatCompletionRequest,
-) (response gpt3.ChatCompletionResponse, err error) {
-	if config.MyConfig.IsSharedMode() {
-		// only allow gpt-3.5-turbo for shared mode
-		model = gpt3.GPT3Dot5Turbo
-	} else {
-		if model == "" {
-			model = gpt3.GPT3Dot5Turbo
-		}
-		if !c.IsAvailable(model) {
-			err = gpt3.ErrChatCompletionInvalidModel
-			return
-		}
+) (response gpt3.ChatCompletionResponse, cached bool, err error) {
+	model = requestModel(model)
+	if !config.MyConfig.IsSharedMode() && !c.IsAvailable(model) {
+		err = gpt3.ErrChatCompletionInvalidModel
+		return
 	}
 
 	request := gpt3.ChatCompletionRequest{
@@ -138,6 +197,22 @@ func (c *ChatGPTCLient) CreateChatCompletionEx(
 		N:           1,
 	}
 
+	// an answer from the cache costs no token
+	cache_key := ""
+	if cacheable && c.response_cache != nil {
+		cache_key = responseCacheKey(&request)
+		entry := c.response_cache.GetContentCache(clientdb.CACHE_KIND_ANSWER, cache_key)
+		if entry != nil && time.Now().Before(entry.ExpiresAt) && json.Unmarshal(entry.Content, &response) == nil {
+			log.Debug("Answer from the response cache : ", cache_key)
+			c.response_cache.TouchContentCache(entry)
+			response.Usage = gpt3.Usage{}
+			loadRequest(chat_history, role_name, username, &request)
+			loadResponse(chat_history, &response)
+			cached = true
+			return
+		}
+	}
+
 	var reqBytes []byte
 	reqBytes, err = json.Marshal(request)
 	if err != nil {
@@ -156,9 +231,136 @@ func (c *ChatGPTCLient) CreateChatCompletionEx(
 	loadRequest(chat_history, role_name, username, &request)
 	loadResponse(chat_history, &response)
 
+	if err == nil && len(cache_key) > 0 && len(response.Choices) > 0 {
+		c.saveResponseCache(cache_key, &response)
+	}
 	return
 }
 
+func (c *ChatGPTCLient) saveResponseCache(cache_key string, response *gpt3.ChatCompletionResponse) {
+	content, err := json.Marshal(response)
+	if err != nil {
+		log.Error("Failed to encode the answer for the response cache : ", err)
+		return
+	}
+	c.response_cache.SaveContentCache(&clientdb.ContentCache{
+		Kind:        clientdb.CACHE_KIND_ANSWER,
+		Key:         cache_key,
+		ContentType: "application/json",
+		Content:     content,
+		ExpiresAt:   time.Now().Add(time.Duration(config.MyConfig.System.ResponseCacheTTL) * time.Second),
+	})
+	if _, err := c.response_cache.TrimContentCache(clientdb.CACHE_KIND_ANSWER, config.MyConfig.System.ResponseCacheLimit); err != nil {
+		log.Error("Failed to trim the response cache : ", err)
+	}
+}
+
+// CreateImages asks the image model for n images of the prompt, in base64 if the model
+// allows to choose. dall-e-3 draws one image for each request, so it is asked n times.
+func (c *ChatGPTCLient) CreateImages(prompt string, size string, n int) ([]gpt3.ImageResponseDataInner, error) {
+	image_model := config.MyConfig.System.ImageModel
+	batch := n
+	if image_model == gpt3.CreateImageModelDallE3 {
+		batch = 1
+	}
+
+	images := []gpt3.ImageResponseDataInner{}
+	for len(images) < n {
+		request := gpt3.ImageRequest{
+			Prompt: prompt,
+			Model:  image_model,
+			N:      batch,
+			Size:   size,
+		}
+		if left := n - len(images); left < batch {
+			request.N = left
+		}
+		if strings.HasPrefix(image_model, "dall-e") {
+			request.ResponseFormat = gpt3.CreateImageResponseFormatB64JSON
+		}
+
+		reqBytes, err := json.Marshal(request)
+		if err != nil {
+			return images, err
+		}
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, c.fullURL("/images/generations"), bytes.NewBuffer(reqBytes))
+		if err != nil {
+			return images, err
+		}
+
+		var response gpt3.ImageResponse
+		if err = c.sendRequest(req, &response); err != nil {
+			return images, err
+		}
+		if len(response.Data) == 0 {
+			return images, errors.New("no image in the response")
+		}
+		images = append(images, response.Data...)
+	}
+	return images, nil
+}
+
+// CreateAudioText transcribes the audio, or translates it into English. prompt is the text
+// before the audio, keeping the segments of a long recording coherent.
+func (c *ChatGPTCLient) CreateAudioText(file_name string, data []byte, translate bool, prompt string) (string, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("model", config.MyConfig.System.AudioModel)
+	writer.WriteField("response_format", "json")
+	if len(prompt) > 0 {
+		writer.WriteField("prompt", prompt)
+	}
+	part, err := writer.CreateFormFile("file", file_name)
+	if err != nil {
+		return "", err
+	}
+	if _, err = part.Write(data); err != nil {
+		return "", err
+	}
+	if err = writer.Close(); err != nil {
+		return "", err
+	}
+
+	urlSuffix := "/audio/transcriptions"
+	if translate {
+		urlSuffix = "/audio/translations"
+	}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, c.fullURL(urlSuffix), bytes.NewReader(body.Bytes()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	var response gpt3.AudioResponse
+	if err = c.sendRequest(req, &response); err != nil {
+		return "", err
+	}
+	return response.Text, nil
+}
+
+// CreateOneShotCompletion asks the question with the prompt of the role only, the
+// conversation history is restored afterwards
+func (c *ChatGPTCLient) CreateOneShotCompletion(
+	role *config.SysRole,
+	question string,
+	username string,
+	chat_history *model.ConversationHistory,
+) (gpt3.ChatCompletionResponse, bool, error) {
+	saved_history := c.msg_history
+	defer func() {
+		c.msg_history = saved_history
+	}()
+
+	c.ResetMsgHistory(role.Prompt, role.Opening)
+	c.AddMsgHistory("user", question)
+
+	token_len := c.EstimateAvailableTokenNumber(role.Model, len(question))
+	if token_len <= 0 {
+		return gpt3.ChatCompletionResponse{}, false, errors.New("the question is too long for model " + role.Model)
+	}
+	return c.CreateChatCompletionEx(role.Model, token_len, role.Temperature, role.Name, username, chat_history, role.IsCacheable())
+}
+
 func (c *ChatGPTCLient) getSupportModels() error {
 	if len(c.support_models) > 0 {
 		return nil
@@ -189,6 +391,9 @@ func (c *ChatGPTCLient) getSupportModels() error {
 }
 
 func (c *ChatGPTCLient) ListAllModels() []string {
+	c.models_mutex.Lock()
+	defer c.models_mutex.Unlock()
+
 	var models []string
 	err := c.getSupportModels()
 	if err != nil {
@@ -239,7 +444,12 @@ func (c *ChatGPTCLient) sendRequest(req *http.Request, val interface{}) error {
 		req.Header.Set("Content-Type", "application/json; charset=utf-8")
 	}
 
-	res, err := c.HTTPClient.Do(req)
+	policy := utility.DefaultRetryPolicy
+	if config.MyConfig.IsSharedMode() {
+		// xally_server retries the declined requests itself
+		policy = policy.ViaRelay()
+	}
+	res, err := policy.Do(c.HTTPClient, req)
 	if err != nil {
 		return err
 	}
@@ -273,18 +483,11 @@ func (c *ChatGPTCLient) sendRequest(req *http.Request, val interface{}) error {
 	if config.MyConfig.IsSharedMode() {
 		new_access_token := res.Header.Get(config.PROXY_TOKEN_NAME)
 		if len(new_access_token) > 0 && new_access_token != config.MyConfig.System.AppToken {
-			config.MyConfig.System.AppToken = new_access_token
-
-			var temp_file string
-			var dir_home string
-			var err error
-
-			if dir_home, err = config.FindHomeDir(false); err != nil {
-				dir_home = "."
-			}
-			temp_file = path.Join(dir_home, "xally.yaml")
-			if _, err = config.MyConfig.DumpIntoYAML(temp_file); err != nil {
-				log.Error("Failed to write YAML data into :" + temp_file)
+			err := config.UpdateUserConfig(func(cfg *config.SysConfig) {
+				cfg.System.AppToken = new_access_token
+			})
+			if err != nil {
+				log.Error("Failed to write YAML data into :" + config.MyConfig.UserFile())
 			}
 		}
 	}
@@ -345,22 +548,15 @@ func (c *ChatGPTCLient) UserRegistration(email string, endpoint_url string) (str
 			if result.Code == controller.ERR_OK && result.Data != nil {
 				access_token, ok := result.Data["access_token"].(string)
 				if ok {
-					var temp_file string
-					var dir_home string
-
 					// update local configuration
-					config.MyConfig.System.Email = email
-					config.MyConfig.System.APIEndpointOpenai = endpoint_url
-					config.MyConfig.System.UseSharedMode = 1
-					config.MyConfig.System.AppToken = access_token
-
-					var err error
-					if dir_home, err = config.FindHomeDir(false); err != nil {
-						dir_home = "."
-					}
-					temp_file = path.Join(dir_home, "xally.yaml")
-					if _, err = config.MyConfig.DumpIntoYAML(temp_file); err != nil {
-						log.Error("Failed to write YAML data into :" + temp_file)
+					err := config.UpdateUserConfig(func(cfg *config.SysConfig) {
+						cfg.System.Email = email
+						cfg.System.APIEndpointOpenai = endpoint_url
+						cfg.System.UseSharedMode = 1
+						cfg.System.AppToken = access_token
+					})
+					if err != nil {
+						log.Error("Failed to write YAML data into :" + config.MyConfig.UserFile())
 					}
 					return result.Msg, nil
 				}
@@ -444,13 +640,53 @@ func (c *ChatGPTCLient) AddMsgHistory(role_name string, content string) {
 	})
 }
 
+// AddMsgHistoryWithImages adds the message with the images as data URLs, for the vision models
+func (c *ChatGPTCLient) AddMsgHistoryWithImages(role_name string, content string, image_urls []string) {
+	parts := []gpt3.ChatMessagePart{{Type: gpt3.ChatMessagePartTypeText, Text: content}}
+	for _, image_url := range image_urls {
+		parts = append(parts, gpt3.ChatMessagePart{
+			Type:     gpt3.ChatMessagePartTypeImageURL,
+			ImageURL: &gpt3.ChatMessageImageURL{URL: image_url, Detail: gpt3.ImageURLDetailAuto},
+		})
+	}
+	c.msg_history = append(c.msg_history, gpt3.ChatCompletionMessage{
+		Role:         role_name,
+		MultiContent: parts,
+	})
+}
+
+// messageText is the text of the message, without the images
+func messageText(msg *gpt3.ChatCompletionMessage) string {
+	if len(msg.MultiContent) == 0 {
+		return msg.Content
+	}
+	texts := []string{}
+	for _, part := range msg.MultiContent {
+		if part.Type == gpt3.ChatMessagePartTypeText {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// messageLength estimates the tokens of the message content, the images by their size
+func messageLength(msg *gpt3.ChatCompletionMessage) int {
+	length := len(messageText(msg)) + len(msg.Name)
+	for _, part := range msg.MultiContent {
+		if part.Type == gpt3.ChatMessagePartTypeImageURL && part.ImageURL != nil {
+			length += imageURLTokens(part.ImageURL.URL)
+		}
+	}
+	return length
+}
+
 func (c *ChatGPTCLient) EstimateAvailableTokenNumber(model string, question_leng int) int {
 	available_len := c.GetMaxTokens(model) - question_leng // - bot.token_counter_total
 
 	for _, msg := range c.msg_history {
 		available_len = available_len - 4 // every message follows <im_start>{role/name}\n{content}<im_end>\n
 		// TODO: need to fine tune going forward, replaced with GPT-index instead of length of contents
-		available_len = available_len - len(msg.Content) - len(msg.Name)
+		available_len = available_len - messageLength(&msg)
 		available_len = available_len - 1 // - len(msg.Role), role is always required and always 1 token
 		available_len = available_len - 2 // every reply is primed with <im_start>assistant
 	}
@@ -508,7 +744,7 @@ func loadRequest(ch *model.ConversationHistory, role string, username string, re
 	ch.MsGSize = len(request.Messages)
 	if len(request.Messages) > 0 {
 		ch.LatestMsgRole = request.Messages[len(request.Messages)-1].Role
-		ch.LatestMsgContent = request.Messages[len(request.Messages)-1].Content
+		ch.LatestMsgContent = messageText(&request.Messages[len(request.Messages)-1])
 	}
 
 	ch.MaxTokens = request.MaxTokens
@@ -533,6 +769,6 @@ func loadResponse(ch *model.ConversationHistory, response *gpt3.ChatCompletionRe
 		ch.LatestChoiceRole = response.Choices[len(response.Choices)-1].Message.Role
 		ch.LatestChoiceContent = response.Choices[len(response.Choices)-1].Message.Content
 		ch.LatestChoiceName = response.Choices[len(response.Choices)-1].Message.Name
-		ch.LatestChoiceFinishReason = response.Choices[len(response.Choices)-1].FinishReason
+		ch.LatestChoiceFinishReason = string(response.Choices[len(response.Choices)-1].FinishReason)
 	}
 }
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/robinmin/xally/config"
+	"github.com/robinmin/xally/shared/clientdb"
+	"github.com/robinmin/xally/shared/model"
+	"github.com/robinmin/xally/shared/utility"
+)
+
+func TestResponseCache(t *testing.T) {
+	assertions := require.New(t)
+
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"chatcmpl-1","object":"chat.completion","model":"gpt-3.5-turbo",`+
+			`"choices":[{"index":0,"message":{"role":"assistant","content":"pong"},"finish_reason":"stop"}],`+
+			`"usage":{"prompt_tokens":9,"completion_tokens":1,"total_tokens":10}}`)
+	}))
+	defer server.Close()
+
+	config.UseTestConfig(t)
+	config.MyConfig.System.APIEndpointOpenai = server.URL
+	// the shared mode skips listing the models
+	config.MyConfig.System.UseSharedMode = 1
+	config.MyConfig.System.AppToken = "test"
+
+	cdb, err := clientdb.InitClientDB(filepath.Join(t.TempDir(), "xally.db"), false)
+	assertions.NoError(err)
+
+	ask := func(cacheable bool) (int, bool) {
+		client := NewChatBotClient("", server.URL)
+		client.SetResponseCache(cdb)
+		client.AddMsgHistory("user", "ping")
+		response, cached, err := client.CreateChatCompletionEx("", 100, 0, "user", "tester", &model.ConversationHistory{}, cacheable)
+		assertions.NoError(err)
+		assertions.Equal("pong", response.Choices[0].Message.Content)
+		return response.Usage.TotalTokens, cached
+	}
+
+	tokens, cached := ask(true)
+	assertions.False(cached)
+	assertions.Equal(10, tokens)
+
+	tokens, cached = ask(true)
+	assertions.True(cached)
+	assertions.Equal(0, tokens)
+	assertions.Equal(int32(1), atomic.LoadInt32(&hits))
+
+	// the roles opting out always ask the API
+	_, cached = ask(false)
+	assertions.False(cached)
+	assertions.Equal(int32(2), atomic.LoadInt32(&hits))
+}
+
+// TestChatReplay replays a chat recorded as sent by go-openai v1.7.0, so the plain text
+// messages still go out the same way after the upgrade for the images (MultiContent)
+func TestChatReplay(t *testing.T) {
+	assertions := require.New(t)
+
+	config.UseTestConfig(t)
+	config.MyConfig.System.APIEndpointOpenai = "http://relay.local/v1"
+	config.MyConfig.System.UseSharedMode = 1
+	config.MyConfig.System.AppToken = "test"
+
+	player, err := utility.NewReplayTransport(utility.REPLAY_SERVE, filepath.Join("testdata", "replay"), nil)
+	assertions.NoError(err)
+	client := NewChatBotClient("", config.MyConfig.System.APIEndpointOpenai)
+	client.HTTPClient.Transport = player
+	client.ResetMsgHistory("You are a helpful assistant.", "")
+	client.AddMsgHistory("user", "hello")
+
+	// the fixture is keyed by the request body, so any change of it finds no fixture
+	chat_history := &model.ConversationHistory{}
+	response, cached, err := client.CreateChatCompletionEx("gpt-3.5-turbo", 1000, 0.7, "user", "tester", chat_history, false)
+	assertions.NoError(err)
+	assertions.False(cached)
+	assertions.Equal("Hello! How can I assist you today?", response.Choices[0].Message.Content)
+	assertions.Equal("stop", string(response.Choices[0].FinishReason))
+	assertions.Equal(28, response.Usage.TotalTokens)
+}
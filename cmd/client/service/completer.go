@@ -0,0 +1,216 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/c-bata/go-prompt"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/robinmin/xally/config"
+	"github.com/robinmin/xally/shared/clientdb"
+)
+
+// max number of the recent URLs and files to suggest
+const COMPLETION_LIMIT = 50
+
+// completer suggests the command names first, then their arguments by the hints and the
+// completion kind of the command. Both of them are matched fuzzily.
+func (bot *ChatBot) completer(doc prompt.Document) []prompt.Suggest {
+	line := doc.TextBeforeCursor()
+	if strings.TrimSpace(line) == "" {
+		return []prompt.Suggest{}
+	}
+
+	// go-prompt replaces the word before the cursor by the suggestion
+	word := doc.GetWordBeforeCursor()
+	args := strings.Fields(line[:len(line)-len(word)])
+	if len(args) == 0 {
+		return fuzzyFilter(bot.plugin_mgr.Suggestions(), word, nil)
+	}
+
+	p := bot.plugin_mgr.GetPlugin(args[0])
+	if p == nil {
+		return []prompt.Suggest{}
+	}
+
+	// the roles and the models may be swapped by reloadConfig meanwhile
+	bot.state_mutex.RLock()
+	defer bot.state_mutex.RUnlock()
+	suggestions, kind := p.GetMeta().ArgSuggestions(args[1:])
+	suggestions = fuzzyFilter(suggestions, word, nil)
+
+	switch kind {
+	case CompleteFile:
+		suggestions = append(suggestions, completeFiles(word)...)
+	case CompleteURL:
+		suggestions = append(suggestions, fuzzyFilter(bot.completeURLs(), word, nil)...)
+	case CompleteRole:
+		suggestions = append(suggestions, fuzzyFilter(completeRoles(), word, nil)...)
+	case CompleteModel:
+		suggestions = append(suggestions, fuzzyFilter(bot.completeModels(), word, nil)...)
+	}
+	return suggestions
+}
+
+func (bot *ChatBot) completeURLs() []prompt.Suggest {
+	suggestions := []prompt.Suggest{}
+	urls, err := bot.clientdb.RecentURLs(COMPLETION_LIMIT)
+	if err != nil {
+		log.Error("Failed to load recent URLs : ", err)
+	}
+	for _, url_str := range urls {
+		suggestions = append(suggestions, prompt.Suggest{Text: url_str})
+	}
+	return suggestions
+}
+
+// completeRoles lists the roles with the beginning of their prompts
+func completeRoles() []prompt.Suggest {
+	role_names := []string{}
+	for role_name := range config.MyConfig.Roles {
+		role_names = append(role_names, role_name)
+	}
+	sort.Strings(role_names)
+
+	suggestions := []prompt.Suggest{}
+	for _, role_name := range role_names {
+		role := config.MyConfig.Roles[role_name]
+		prompt_line := strings.SplitN(strings.TrimSpace(role.Prompt), "\n", 2)[0]
+		suggestions = append(suggestions, prompt.Suggest{
+			Text:        role_name,
+			Description: strings.TrimSpace(role.Avatar + " " + clientdb.TruncateStr(prompt_line, 60)),
+		})
+	}
+	return suggestions
+}
+
+// completeModels lists the models used by the roles, plus the ones of the service in the
+// standalone mode. The latter are fetched in the background by fetchModels, as the
+// completer runs on each key stroke.
+func (bot *ChatBot) completeModels() []prompt.Suggest {
+	models := map[string]bool{}
+	for _, role := range config.MyConfig.Roles {
+		if len(role.Model) > 0 {
+			models[role.Model] = true
+		}
+	}
+	for _, model := range bot.service_models {
+		models[model] = true
+	}
+
+	model_ids := []string{}
+	for model := range models {
+		model_ids = append(model_ids, model)
+	}
+	sort.Strings(model_ids)
+
+	suggestions := []prompt.Suggest{}
+	for _, model := range model_ids {
+		suggestions = append(suggestions, prompt.Suggest{Text: model})
+	}
+	return suggestions
+}
+
+// completeFiles lists the entries of the folder typed so far, matched by their names
+func completeFiles(word string) []prompt.Suggest {
+	dir, base := filepath.Split(word)
+	read_dir := dir
+	if len(read_dir) == 0 {
+		read_dir = "."
+	} else if strings.HasPrefix(read_dir, "~/") {
+		if dir_home, err := os.UserHomeDir(); err == nil {
+			read_dir = filepath.Join(dir_home, read_dir[2:])
+		}
+	}
+
+	entries, err := os.ReadDir(read_dir)
+	if err != nil {
+		return []prompt.Suggest{}
+	}
+	suggestions := []prompt.Suggest{}
+	for _, entry := range entries {
+		// hidden files only when asked for
+		if strings.HasPrefix(entry.Name(), ".") && !strings.HasPrefix(base, ".") {
+			continue
+		}
+		text := dir + entry.Name()
+		if entry.IsDir() {
+			text += "/"
+		}
+		suggestions = append(suggestions, prompt.Suggest{Text: text})
+	}
+
+	suggestions = fuzzyFilter(suggestions, base, func(suggestion prompt.Suggest) string {
+		return strings.TrimPrefix(suggestion.Text, dir)
+	})
+	if len(suggestions) > COMPLETION_LIMIT {
+		suggestions = suggestions[:COMPLETION_LIMIT]
+	}
+	return suggestions
+}
+
+// fuzzyFilter keeps the suggestions matching the pattern, the best matches first.
+// match_text picks the part of the suggestion to match, the whole text if nil.
+func fuzzyFilter(suggestions []prompt.Suggest, pattern string, match_text func(suggestion prompt.Suggest) string) []prompt.Suggest {
+	type scored struct {
+		suggestion prompt.Suggest
+		score      int
+	}
+
+	matched := []scored{}
+	for _, suggestion := range suggestions {
+		text := suggestion.Text
+		if match_text != nil {
+			text = match_text(suggestion)
+		}
+		if score := fuzzyScore(text, pattern); score >= 0 {
+			matched = append(matched, scored{suggestion: suggestion, score: score})
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		return matched[i].score > matched[j].score
+	})
+
+	result := []prompt.Suggest{}
+	for _, item := range matched {
+		result = append(result, item.suggestion)
+	}
+	return result
+}
+
+// fuzzyScore rates how well the text matches the pattern ignoring case. Prefixes rank
+// first, then substrings, then the texts holding the characters of the pattern in order
+// with the fewest gaps. It returns -1 if the text does not match at all.
+func fuzzyScore(text string, pattern string) int {
+	if len(pattern) == 0 {
+		return 0
+	}
+
+	lower_text := []rune(strings.ToLower(text))
+	lower_pattern := strings.ToLower(pattern)
+	switch idx := strings.Index(string(lower_text), lower_pattern); {
+	case idx == 0:
+		return 3000000 - len(lower_text)
+	case idx > 0:
+		return 2000000 - idx*1000 - len(lower_text)
+	}
+
+	pos, last, gaps := 0, -1, 0
+	for _, char := range lower_pattern {
+		for pos < len(lower_text) && lower_text[pos] != char {
+			pos++
+		}
+		if pos >= len(lower_text) {
+			return -1
+		}
+		if last >= 0 {
+			gaps += pos - last - 1
+		}
+		last = pos
+		pos++
+	}
+	return 1000000 - gaps*1000 - len(lower_text)
+}
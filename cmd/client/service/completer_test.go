@@ -0,0 +1,109 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/c-bata/go-prompt"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slices"
+
+	"github.com/robinmin/xally/config"
+)
+
+func suggestionTexts(suggestions []prompt.Suggest) []string {
+	texts := []string{}
+	for _, suggestion := range suggestions {
+		texts = append(texts, suggestion.Text)
+	}
+	return texts
+}
+
+func TestFuzzyFilter(t *testing.T) {
+	assertions := require.New(t)
+
+	suggestions := []prompt.Suggest{{Text: "web-summary"}, {Text: "file-summary"}, {Text: "summary"}, {Text: "reset"}}
+	assertions.Equal([]string{"summary", "web-summary", "file-summary"}, suggestionTexts(fuzzyFilter(suggestions, "sum", nil)))
+	assertions.Equal([]string{"web-summary"}, suggestionTexts(fuzzyFilter(suggestions, "wsm", nil)))
+	assertions.Equal([]string{"reset"}, suggestionTexts(fuzzyFilter(suggestions, "RST", nil)))
+	assertions.Len(fuzzyFilter(suggestions, "", nil), 4)
+	assertions.Equal(-1, fuzzyScore("reset", "rz"))
+}
+
+func TestArgSuggestions(t *testing.T) {
+	assertions := require.New(t)
+
+	meta := &PluginMeta{
+		Name: "vocab",
+		Hints: []PluginHint{
+			{Text: "list"},
+			{Text: "export --anki", Completion: CompleteFile},
+		},
+	}
+	suggestions, kind := meta.ArgSuggestions([]string{})
+	assertions.Equal([]string{"list", "export"}, suggestionTexts(suggestions))
+	assertions.Equal(CompleteNone, kind)
+
+	suggestions, _ = meta.ArgSuggestions([]string{"export"})
+	assertions.Equal([]string{"--anki"}, suggestionTexts(suggestions))
+
+	suggestions, kind = meta.ArgSuggestions([]string{"export", "--anki"})
+	assertions.Empty(suggestions)
+	assertions.Equal(CompleteFile, kind)
+}
+
+func TestCompleteFiles(t *testing.T) {
+	assertions := require.New(t)
+
+	dir := t.TempDir()
+	assertions.NoError(os.Mkdir(filepath.Join(dir, "docs"), 0755))
+	assertions.NoError(os.WriteFile(filepath.Join(dir, "main.go"), []byte(""), 0644))
+	assertions.NoError(os.WriteFile(filepath.Join(dir, "README.md"), []byte(""), 0644))
+	assertions.NoError(os.WriteFile(filepath.Join(dir, ".env"), []byte(""), 0644))
+
+	assertions.Equal([]string{dir + "/main.go"}, suggestionTexts(completeFiles(dir+"/mgo")))
+	assertions.Equal([]string{dir + "/docs/"}, suggestionTexts(completeFiles(dir+"/do")))
+	assertions.Equal([]string{dir + "/.env"}, suggestionTexts(completeFiles(dir+"/.e")))
+	assertions.Len(completeFiles(dir+"/"), 3)
+}
+
+func TestCompleteModels(t *testing.T) {
+	assertions := require.New(t)
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"object":"list","data":[{"id":"ft:custom","object":"model"}]}`)
+	}))
+	defer server.Close()
+	defer close(release)
+
+	cfg := config.UseTestConfig(t)
+	cfg.System.OpenaiApiKey = "test"
+	cfg.System.APIEndpointOpenai = server.URL
+	bot := &ChatBot{
+		client:  NewChatBotClient(cfg.System.OpenaiApiKey, server.URL),
+		console: &terminalConsole{},
+	}
+	assertions.True(bot.CheckConnectivity())
+
+	// the roles are completed while the service is still listing its models
+	role, err := cfg.FindRole(cfg.System.DefaultRole)
+	assertions.NoError(err)
+	texts := suggestionTexts(bot.completeModels())
+	assertions.Contains(texts, role.Model)
+	assertions.NotContains(texts, "ft:custom")
+
+	release <- struct{}{}
+	assertions.Eventually(func() bool {
+		bot.state_mutex.RLock()
+		defer bot.state_mutex.RUnlock()
+		return slices.Contains(suggestionTexts(bot.completeModels()), "ft:custom")
+	}, 5*time.Second, 10*time.Millisecond)
+}
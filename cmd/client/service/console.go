@@ -0,0 +1,185 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/c-bata/go-prompt"
+	"github.com/fatih/color"
+	strftime "github.com/itchyny/timefmt-go"
+
+	"github.com/robinmin/xally/config"
+	"github.com/robinmin/xally/shared/utility"
+)
+
+// UsageStats is the token usage of the last answer
+type UsageStats struct {
+	Prompt     int
+	Completion int
+	Total      int
+	Elapsed    time.Duration
+	// messages in the conversation, and the tokens left for the next question
+	HistoryLength int
+	Available     int
+	// the answer comes from the response cache, no token used
+	Cached bool
+}
+
+// Console is where the chatbot talks with the user, the terminal by default or the
+// full screen interface of --tui
+type Console interface {
+	// Say shows the message in Markdown
+	Say(msg string)
+	// Answer shows the answer of the role
+	Answer(avatar string, msg string)
+	// Usage shows the token usage of the last answer
+	Usage(stats *UsageStats)
+	// ReadLine asks the question and returns the line typed, starting from initial
+	ReadLine(question string, initial string) string
+	// ReadPassword asks the question and reads the line without showing it
+	ReadPassword(question string) (string, error)
+	// Terminal returns the stdin, stdout and stderr for the local commands
+	Terminal() (io.Reader, io.Writer, io.Writer)
+	// Quit ends the session
+	Quit()
+}
+
+// terminalConsole talks on the terminal along with go-prompt
+type terminalConsole struct{}
+
+func (terminalConsole) Say(msg string) {
+	utility.EchoInfo(msg)
+}
+
+func (terminalConsole) Answer(avatar string, msg string) {
+	fmt.Println(avatar + prompt_tip_flag)
+	utility.EchoInfo(msg)
+}
+
+func (terminalConsole) Usage(stats *UsageStats) {
+	gray := color.New(color.FgHiBlack).PrintfFunc()
+	if stats.Cached {
+		gray(
+			"%40s %s       %s : %d\n\n",
+			strftime.Format(time.Now(), "%Y-%m-%d %H:%M:%S"),
+			config.Text("tips_answer_cached"),
+			strings.Repeat("░", stats.HistoryLength),
+			stats.Available,
+		)
+		return
+	}
+	gray(
+		"%40s ( %d + %d = %d ) %ds       %s : %d\n\n",
+		strftime.Format(time.Now(), "%Y-%m-%d %H:%M:%S"),
+		stats.Prompt,
+		stats.Completion,
+		stats.Total,
+		stats.Elapsed/100000000,
+		strings.Repeat("░", stats.HistoryLength),
+		stats.Available,
+	)
+}
+
+func (terminalConsole) ReadLine(question string, initial string) string {
+	if len(initial) == 0 {
+		return utility.ReadLine(question)
+	}
+	return prompt.Input(question, func(prompt.Document) []prompt.Suggest { return nil }, prompt.OptionInitialBufferText(initial))
+}
+
+func (terminalConsole) ReadPassword(question string) (string, error) {
+	return utility.ReadPassword(question)
+}
+
+func (terminalConsole) Terminal() (io.Reader, io.Writer, io.Writer) {
+	return os.Stdin, os.Stdout, os.Stderr
+}
+
+func (terminalConsole) Quit() {
+	os.Exit(0)
+}
+
+// SetConsole changes where the chatbot talks with the user
+func (bot *ChatBot) SetConsole(console Console) {
+	bot.console = console
+}
+
+// getConsole falls back to the terminal when no console is set
+func (bot *ChatBot) getConsole() Console {
+	if bot.console == nil {
+		return terminalConsole{}
+	}
+	return bot.console
+}
+
+// confirm asks a yes/no question, anything but yes means no
+func (bot *ChatBot) confirm(question string) bool {
+	switch strings.ToLower(strings.TrimSpace(bot.getConsole().ReadLine(question+" [y/N] ", ""))) {
+	case "y", "yes":
+		return true
+	default:
+		return false
+	}
+}
+
+// BotStatus is what the full screen interface shows besides the conversation
+type BotStatus struct {
+	Name   string
+	Role   string
+	Avatar string
+	Model  string
+	// flags of GetCurrentMode
+	Mode  string
+	Usage UsageStats
+	Roles []string
+	// chat history files, the latest first
+	Sessions []string
+}
+
+func (bot *ChatBot) Status() *BotStatus {
+	bot.state_mutex.RLock()
+	defer bot.state_mutex.RUnlock()
+
+	status := &BotStatus{
+		Name:   bot.name,
+		Role:   bot.role.Name,
+		Avatar: bot.role.Avatar,
+		Model:  bot.role.Model,
+		Mode:   config.MyConfig.GetCurrentMode(bot.connected),
+		Usage:  bot.usage,
+		Roles:  []string{},
+	}
+	for role_name := range config.MyConfig.Roles {
+		status.Roles = append(status.Roles, role_name)
+	}
+	sort.Strings(status.Roles)
+	status.Sessions = bot.sessions()
+	return status
+}
+
+// sessions lists the chat history files, the latest first
+func (bot *ChatBot) sessions() []string {
+	if !bot.log_history {
+		return []string{}
+	}
+	files, err := filepath.Glob(filepath.Join(bot.chat_history_path, "*.md"))
+	if err != nil {
+		return []string{}
+	}
+
+	mod_times := map[string]time.Time{}
+	for _, file_name := range files {
+		if info, err := os.Stat(file_name); err == nil {
+			mod_times[file_name] = info.ModTime()
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return mod_times[files[i]].After(mod_times[files[j]])
+	})
+	return files
+}
@@ -0,0 +1,218 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/robinmin/xally/config"
+)
+
+// external plugins talk JSON over stdin / stdout, one request per process
+const EXTERNAL_PLUGIN_PROTOCOL_VERSION = 1
+
+const (
+	EXTERNAL_ACTION_DESCRIBE = "describe"
+	EXTERNAL_ACTION_EXECUTE  = "execute"
+)
+
+// describe only prints the metadata, so a plugin hanging on it never holds up the start for long
+const EXTERNAL_DESCRIBE_TIMEOUT = 3 * time.Second
+
+// ExternalRequest is written to the stdin of the plugin
+type ExternalRequest struct {
+	Version  int      `json:"version"`
+	Action   string   `json:"action"`
+	Command  string   `json:"command,omitempty"`
+	Message  string   `json:"message,omitempty"`
+	Args     []string `json:"args,omitempty"`
+	Role     string   `json:"role,omitempty"`
+	Language string   `json:"language,omitempty"`
+}
+
+// ExternalResponse is read from the stdout of the plugin on execute. Message
+// replaces the original input and is sent to the model, Output is shown to
+// the user directly.
+type ExternalResponse struct {
+	Message  string `json:"message,omitempty"`
+	Quote    string `json:"quote,omitempty"`
+	Output   string `json:"output,omitempty"`
+	NeedDump bool   `json:"need_dump,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+type ExternalPlugin struct {
+	path    string
+	meta    PluginMeta
+	timeout time.Duration
+	role    func() string
+}
+
+// LoadExternalPlugins describes every executable in the folder and wraps it as a plugin
+func LoadExternalPlugins(dir string, timeout time.Duration, role func() string) []Plugin {
+	plugins := []Plugin{}
+	if len(dir) == 0 {
+		return plugins
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Error("Failed to read the plugin folder : ", err)
+		}
+		return plugins
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	// describe them all at once, keeping the order of the names
+	candidates := []*ExternalPlugin{}
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() || info.Mode().Perm()&0111 == 0 {
+			continue
+		}
+		candidates = append(candidates, &ExternalPlugin{
+			path:    filepath.Join(dir, entry.Name()),
+			timeout: timeout,
+			role:    role,
+		})
+	}
+
+	errs := make([]error, len(candidates))
+	var wg sync.WaitGroup
+	for idx, plugin := range candidates {
+		wg.Add(1)
+		go func(idx int, plugin *ExternalPlugin) {
+			defer wg.Done()
+			errs[idx] = plugin.describe()
+		}(idx, plugin)
+	}
+	wg.Wait()
+
+	for idx, plugin := range candidates {
+		if errs[idx] != nil {
+			log.Errorf("Failed to load external plugin %s : %s", plugin.path, errs[idx].Error())
+			continue
+		}
+		plugins = append(plugins, plugin)
+	}
+	return plugins
+}
+
+func (plugin *ExternalPlugin) GetMeta() *PluginMeta {
+	return &plugin.meta
+}
+
+func (*ExternalPlugin) Open() error {
+	return nil
+}
+
+func (*ExternalPlugin) Close() error {
+	return nil
+}
+
+func (plugin *ExternalPlugin) Execute(original_msg string, arr_cmd []string) (*PluginResult, error) {
+	log.Debugf("Execute external plugin [%s] on : %s", plugin.meta.Name, original_msg)
+
+	req := &ExternalRequest{
+		Action:   EXTERNAL_ACTION_EXECUTE,
+		Command:  arr_cmd[0],
+		Message:  original_msg,
+		Args:     arr_cmd[1:],
+		Language: config.MyConfig.System.PeferenceLanguage,
+	}
+	if plugin.role != nil {
+		req.Role = plugin.role()
+	}
+
+	resp := &ExternalResponse{}
+	if err := plugin.call(req, resp, plugin.timeout); err != nil {
+		return nil, err
+	}
+	if len(resp.Error) > 0 {
+		return nil, errors.New(resp.Error)
+	}
+
+	return &PluginResult{
+		Question: resp.Message,
+		Quote:    resp.Quote,
+		Output:   resp.Output,
+		NeedDump: resp.NeedDump,
+	}, nil
+}
+
+func (plugin *ExternalPlugin) describe() error {
+	timeout := EXTERNAL_DESCRIBE_TIMEOUT
+	if plugin.timeout > 0 && plugin.timeout < timeout {
+		timeout = plugin.timeout
+	}
+
+	meta := PluginMeta{}
+	if err := plugin.call(&ExternalRequest{Action: EXTERNAL_ACTION_DESCRIBE}, &meta, timeout); err != nil {
+		return err
+	}
+
+	if len(meta.Name) == 0 {
+		meta.Name = strings.TrimSuffix(filepath.Base(plugin.path), filepath.Ext(plugin.path))
+	}
+	if strings.ContainsAny(meta.Name, " \t\r\n") {
+		return fmt.Errorf("invalid plugin name : %s", meta.Name)
+	}
+	plugin.meta = meta
+	return nil
+}
+
+// call runs the plugin once with the request on stdin and decodes its stdout into resp,
+// killing it after timeout unless it is zero
+func (plugin *ExternalPlugin) call(req *ExternalRequest, resp interface{}, timeout time.Duration) error {
+	req.Version = EXTERNAL_PLUGIN_PROTOCOL_VERSION
+	input, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, plugin.path)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err = cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("%s timed out after %s", filepath.Base(plugin.path), timeout)
+		}
+		if msg := strings.TrimSpace(stderr.String()); len(msg) > 0 {
+			return fmt.Errorf("%s : %s", err.Error(), msg)
+		}
+		return err
+	}
+	if stderr.Len() > 0 {
+		log.Debug("External plugin stderr : ", stderr.String())
+	}
+
+	if err = json.Unmarshal(stdout.Bytes(), resp); err != nil {
+		return fmt.Errorf("invalid response from %s : %s", filepath.Base(plugin.path), err.Error())
+	}
+	return nil
+}
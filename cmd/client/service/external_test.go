@@ -0,0 +1,75 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/robinmin/xally/config"
+)
+
+const sample_external_plugin = `#!/bin/sh
+input=$(cat)
+case "$input" in
+  *'"action":"describe"'*)
+    echo '{"name":"jira","aliases":["ji"],"description":"Load a Jira issue","args":[{"name":"issue"}],"completion":"url"}'
+    ;;
+  *'"args":["XA-1"]'*)
+    echo '{"message":"Summarize issue XA-1","quote":"XA-1"}'
+    ;;
+  *)
+    echo '{"error":"unknown issue"}'
+    ;;
+esac
+`
+
+func TestExternalPlugin(t *testing.T) {
+	assertions := require.New(t)
+	config.UseTestConfig(t)
+
+	dir := t.TempDir()
+	assertions.NoError(os.WriteFile(filepath.Join(dir, "jira"), []byte(sample_external_plugin), 0755))
+	assertions.NoError(os.WriteFile(filepath.Join(dir, "README.md"), []byte("not a plugin"), 0644))
+
+	plugins := LoadExternalPlugins(dir, 5*time.Second, func() string { return "expert" })
+	assertions.Len(plugins, 1)
+
+	meta := plugins[0].GetMeta()
+	assertions.Equal("jira", meta.Name)
+	assertions.Equal([]string{"ji"}, meta.Aliases)
+	assertions.Equal(CompleteURL, meta.Completion)
+
+	pm := &PluginManager{plugin_map: map[string]Plugin{}}
+	assertions.NoError(pm.AddPlugin(plugins[0]))
+
+	processed, result, err := pm.Execute("ji XA-1", []string{"ji", "XA-1"})
+	assertions.True(processed)
+	assertions.NoError(err)
+	assertions.Equal("Summarize issue XA-1", result.Question)
+	assertions.Equal("XA-1", result.Quote)
+
+	processed, _, err = pm.Execute("jira XA-2", []string{"jira", "XA-2"})
+	assertions.True(processed)
+	assertions.EqualError(err, "unknown issue")
+}
+
+func TestExternalPluginDescribeTimeout(t *testing.T) {
+	assertions := require.New(t)
+	config.UseTestConfig(t)
+
+	dir := t.TempDir()
+	assertions.NoError(os.WriteFile(filepath.Join(dir, "jira"), []byte(sample_external_plugin), 0755))
+	for _, name := range []string{"hang1", "hang2"} {
+		assertions.NoError(os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\nexec sleep 60\n"), 0755))
+	}
+
+	// the hanging ones are given up together after the describe timeout, not plugin_timeout each
+	start := time.Now()
+	plugins := LoadExternalPlugins(dir, 30*time.Second, nil)
+	assertions.Less(time.Since(start), 2*EXTERNAL_DESCRIBE_TIMEOUT)
+	assertions.Len(plugins, 1)
+	assertions.Equal("jira", plugins[0].GetMeta().Name)
+}
@@ -0,0 +1,207 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/robinmin/xally/config"
+	"github.com/robinmin/xally/shared/utility"
+)
+
+const PLUGIN_NAME_GIT_REVIEW = "git-review"
+const PLUGIN_NAME_GIT_COMMIT_MSG = "git-commit-msg"
+
+var rx_code_fence = regexp.MustCompile("(?s)^```[a-zA-Z]*\n(.*?)\n?```$")
+
+func (bot *ChatBot) cmdGitReview(original_msg string, arr_cmd []string) (*PluginResult, error) {
+	log.Debug("Execute [git-review] command on : ", original_msg)
+
+	diff_args := []string{"--cached"}
+	if len(arr_cmd) > 1 {
+		diff_args = arr_cmd[1:2]
+	}
+	chunks, err := collectGitDiff(diff_args, config.MyConfig.System.FileContextBudget)
+	if err != nil {
+		return nil, err
+	}
+
+	for idx, chunk := range chunks {
+		question := config.Text("prompt_git_review")
+		if len(chunks) > 1 {
+			question = question + fmt.Sprintf(config.Text("tips_git_part"), idx+1, len(chunks))
+		}
+		if need_quit := bot.Ask(question + "\n\n" + chunk); need_quit {
+			bot.Close(true)
+		}
+	}
+	return nil, nil
+}
+
+func (bot *ChatBot) cmdGitCommitMsg(original_msg string, arr_cmd []string) (*PluginResult, error) {
+	log.Debug("Execute [git-commit-msg] command on : ", original_msg)
+
+	chunks, err := collectGitDiff([]string{"--cached"}, config.MyConfig.System.FileContextBudget)
+	if err != nil {
+		return nil, err
+	}
+
+	// summarize the parts one by one when the diff does not fit in a single question
+	content := chunks[0]
+	if len(chunks) > 1 {
+		summaries := []string{}
+		for idx, chunk := range chunks {
+			question := config.Text("prompt_git_summarize") + fmt.Sprintf(config.Text("tips_git_part"), idx+1, len(chunks))
+			answer, err := bot.askForAnswer(question + "\n\n" + chunk)
+			if err != nil {
+				return nil, err
+			}
+			summaries = append(summaries, answer)
+		}
+		stat, _ := runGit("diff", "--cached", "--stat", "--no-color")
+		content = stat + "\n" + strings.Join(summaries, "\n\n")
+	}
+
+	answer, err := bot.askForAnswer(config.Text("prompt_git_commit_msg") + "\n\n" + content)
+	if err != nil {
+		return nil, err
+	}
+	commit_msg := stripCodeFence(answer)
+	if len(commit_msg) == 0 || !bot.confirm(config.Text("tips_git_confirm_commit")) {
+		return &PluginResult{Output: config.Text("tips_git_commit_skipped")}, nil
+	}
+
+	msg_file, err := os.CreateTemp("", "xally-commit-*.txt")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(msg_file.Name())
+	if _, err = msg_file.WriteString(commit_msg + "\n"); err != nil {
+		msg_file.Close()
+		return nil, err
+	}
+	msg_file.Close()
+
+	output, err := runGit("commit", "-F", msg_file.Name())
+	return &PluginResult{Output: "```\n" + output + "\n```", NeedDump: true}, err
+}
+
+// collectGitDiff loads the diff with the enclosing functions as context, and
+// packs it file by file into chunks within the token budget. Files too large for
+// the budget fall back to the default context, and get truncated if still too large.
+func collectGitDiff(diff_args []string, budget int) ([]string, error) {
+	limit := budget * utility.BYTES_PER_TOKEN
+	if _, err := runGit("rev-parse", "--is-inside-work-tree"); err != nil {
+		return nil, errors.New(config.Text("tips_git_not_repo"))
+	}
+
+	base_args := append([]string{"diff", "--no-color", "--no-ext-diff"}, diff_args...)
+	rich_diff, err := runGit(append(base_args, "--function-context")...)
+	if err != nil {
+		return nil, err
+	}
+	if len(strings.TrimSpace(rich_diff)) == 0 {
+		return nil, errors.New(config.Text("tips_git_no_changes"))
+	}
+	if limit <= 0 || len(rich_diff) <= limit {
+		return []string{rich_diff}, nil
+	}
+
+	plain_diff, err := runGit(base_args...)
+	if err != nil {
+		return nil, err
+	}
+	plain_sections := map[string]string{}
+	for _, section := range splitDiffByFile(plain_diff) {
+		plain_sections[diffHeader(section)] = section
+	}
+
+	sections := []string{}
+	for _, section := range splitDiffByFile(rich_diff) {
+		if len(section) > limit {
+			if plain, ok := plain_sections[diffHeader(section)]; ok {
+				section = plain
+			}
+		}
+		if len(section) > limit {
+			section = strings.ToValidUTF8(section[:limit], "") + "\n" + config.Text("tips_git_truncated") + "\n"
+		}
+		sections = append(sections, section)
+	}
+	return packChunks(sections, limit), nil
+}
+
+// splitDiffByFile cuts the unified diff into one section per file
+func splitDiffByFile(diff string) []string {
+	sections := []string{}
+	lines := strings.SplitAfter(diff, "\n")
+
+	var sb strings.Builder
+	for _, line := range lines {
+		if strings.HasPrefix(line, "diff --git ") && sb.Len() > 0 {
+			sections = append(sections, sb.String())
+			sb.Reset()
+		}
+		sb.WriteString(line)
+	}
+	if len(strings.TrimSpace(sb.String())) > 0 {
+		sections = append(sections, sb.String())
+	}
+	return sections
+}
+
+func diffHeader(section string) string {
+	if idx := strings.Index(section, "\n"); idx >= 0 {
+		return section[:idx]
+	}
+	return section
+}
+
+// packChunks greedily packs the sections in order into chunks within limit bytes
+func packChunks(sections []string, limit int) []string {
+	chunks := []string{}
+
+	var sb strings.Builder
+	for _, section := range sections {
+		if sb.Len() > 0 && sb.Len()+len(section) > limit {
+			chunks = append(chunks, sb.String())
+			sb.Reset()
+		}
+		sb.WriteString(section)
+	}
+	if sb.Len() > 0 {
+		chunks = append(chunks, sb.String())
+	}
+	return chunks
+}
+
+// stripCodeFence drops the code fence the model tends to wrap the answer with, e.g. the
+// commit message or the JSON of the shell command
+func stripCodeFence(answer string) string {
+	text := strings.TrimSpace(answer)
+	if matches := rx_code_fence.FindStringSubmatch(text); matches != nil {
+		text = strings.TrimSpace(matches[1])
+	}
+	return text
+}
+
+func runGit(args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.Command("git", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); len(msg) > 0 {
+			return stdout.String(), fmt.Errorf("%s : %s", err.Error(), msg)
+		}
+		return stdout.String(), err
+	}
+	return stdout.String(), nil
+}
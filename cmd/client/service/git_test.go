@@ -0,0 +1,45 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const sample_diff = `diff --git a/a.go b/a.go
+index 1..2 100644
+--- a/a.go
++++ b/a.go
+@@ -1 +1 @@
+-package a
++package aa
+diff --git a/b.go b/b.go
+index 3..4 100644
+--- a/b.go
++++ b/b.go
+@@ -1 +1 @@
+-package b
++package bb
+`
+
+func TestGitDiffChunks(t *testing.T) {
+	assertions := require.New(t)
+
+	sections := splitDiffByFile(sample_diff)
+	assertions.Len(sections, 2)
+	assertions.Equal("diff --git a/b.go b/b.go", diffHeader(sections[1]))
+	assertions.Equal(sample_diff, sections[0]+sections[1])
+
+	assertions.Len(packChunks(sections, len(sample_diff)), 1)
+	assertions.Len(packChunks(sections, len(sections[0])+1), 2)
+	// never emit an empty chunk for a section larger than the budget
+	assertions.Len(packChunks(sections, 10), 2)
+}
+
+func TestStripCodeFence(t *testing.T) {
+	assertions := require.New(t)
+
+	assertions.Equal("feat(git): add git-review", stripCodeFence("```text\nfeat(git): add git-review\n```"))
+	assertions.Equal("fix: handle empty diff\n\nbody", stripCodeFence("  fix: handle empty diff\n\nbody\n"))
+	assertions.Equal(`{"command": "ls"}`, stripCodeFence("```json\n{\"command\": \"ls\"}\n```"))
+}
@@ -0,0 +1,207 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/c-bata/go-prompt"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/robinmin/xally/config"
+)
+
+// historySearch is the incremental reverse search started by Ctrl+R, like the one of bash.
+// The typed characters go into the query while it is active, and the buffer shows the match.
+type historySearch struct {
+	// loads the full history, the latest first
+	load func() []string
+
+	active   bool
+	found    bool
+	query    string
+	entries  []string
+	index    int
+	original string // buffer before searching, restored on Ctrl+G
+	shown    string // buffer put by the search, any other change ends it
+}
+
+// Prefix replaces the prompt while searching
+func (hs *historySearch) Prefix() (string, bool) {
+	if !hs.active {
+		return "", false
+	}
+	label := config.Text("tips_history_search")
+	if !hs.found {
+		label = config.Text("tips_history_search_failed")
+	}
+	return fmt.Sprintf("(%s)`%s': ", label, hs.query), true
+}
+
+// Next starts the search with the text in the buffer, or jumps to the next older match
+func (hs *historySearch) Next(buf *prompt.Buffer) {
+	if hs.active && buf.Text() == hs.shown {
+		hs.search(buf, hs.index+1)
+		return
+	}
+
+	hs.active = true
+	hs.found = true
+	hs.query = buf.Text()
+	hs.entries = hs.load()
+	hs.index = -1
+	hs.original = buf.Text()
+	hs.shown = buf.Text()
+	if len(hs.query) > 0 {
+		hs.search(buf, 0)
+	}
+}
+
+// Type adds the character into the query, or into the buffer if not searching
+func (hs *historySearch) Type(buf *prompt.Buffer, text string) {
+	if !hs.active || buf.Text() != hs.shown {
+		hs.Stop()
+		buf.InsertText(text, false, true)
+		return
+	}
+	hs.query += text
+	if hs.index < 0 {
+		hs.index = 0
+	}
+	hs.search(buf, hs.index)
+}
+
+// Backspace shortens the query, the buffer is already changed by go-prompt
+func (hs *historySearch) Backspace(buf *prompt.Buffer) {
+	if !hs.active {
+		return
+	}
+	if query := []rune(hs.query); len(query) > 0 {
+		hs.query = string(query[:len(query)-1])
+	}
+	if len(hs.query) == 0 {
+		hs.index = -1
+		hs.found = true
+		hs.show(buf, hs.original)
+		return
+	}
+	hs.search(buf, 0)
+}
+
+// Cancel restores the buffer before searching
+func (hs *historySearch) Cancel(buf *prompt.Buffer) {
+	if hs.active {
+		hs.show(buf, hs.original)
+		hs.Stop()
+	}
+}
+
+// Stop keeps the match in the buffer for editing or running
+func (hs *historySearch) Stop() {
+	hs.active = false
+	hs.entries = nil
+}
+
+func (hs *historySearch) search(buf *prompt.Buffer, from int) {
+	query := strings.ToLower(hs.query)
+	for idx := from; idx < len(hs.entries); idx++ {
+		if strings.Contains(strings.ToLower(hs.entries[idx]), query) {
+			hs.index = idx
+			hs.found = true
+			hs.show(buf, hs.entries[idx])
+			return
+		}
+	}
+	// keep the last match, like bash
+	hs.found = false
+	hs.shown = buf.Text()
+}
+
+func (hs *historySearch) show(buf *prompt.Buffer, text string) {
+	buf.DeleteBeforeCursor(len([]rune(buf.Document().TextBeforeCursor())))
+	buf.Delete(len([]rune(buf.Text())))
+	buf.InsertText(text, false, true)
+	hs.shown = text
+}
+
+// historyOptions binds the keys of the reverse search into go-prompt
+func (bot *ChatBot) historyOptions() []prompt.Option {
+	stop := func(buf *prompt.Buffer) { bot.history_search.Stop() }
+	key_binds := []prompt.KeyBind{
+		{Key: prompt.ControlR, Fn: bot.history_search.Next},
+		{Key: prompt.ControlG, Fn: bot.history_search.Cancel},
+		{Key: prompt.Backspace, Fn: bot.history_search.Backspace},
+	}
+	for _, key := range []prompt.Key{prompt.Escape, prompt.ControlC, prompt.Up, prompt.Down, prompt.Left, prompt.Right, prompt.Home, prompt.End, prompt.ControlA, prompt.ControlE} {
+		key_binds = append(key_binds, prompt.KeyBind{Key: key, Fn: stop})
+	}
+
+	// printable characters go into the query while searching
+	ascii_binds := []prompt.ASCIICodeBind{}
+	for code := byte(0x20); code < 0x7f; code++ {
+		text := string(rune(code))
+		ascii_binds = append(ascii_binds, prompt.ASCIICodeBind{
+			ASCIICode: []byte{code},
+			Fn:        func(buf *prompt.Buffer) { bot.history_search.Type(buf, text) },
+		})
+	}
+	return []prompt.Option{prompt.OptionAddKeyBind(key_binds...), prompt.OptionAddASCIICodeBind(ascii_binds...)}
+}
+
+// fullHistory lists the distinct inputs of all roles, the latest first
+func (bot *ChatBot) fullHistory() []string {
+	options := []string{}
+	entries, err := bot.clientdb.OptionEntries("")
+	if err != nil {
+		log.Error("Failed to load option history: ", err)
+	}
+	for _, entry := range entries {
+		options = append(options, entry.Option)
+	}
+	return options
+}
+
+// livePrefix shows the reverse search in place of the prompt while searching
+func (bot *ChatBot) livePrefix() (string, bool) {
+	if prefix, ok := bot.history_search.Prefix(); ok {
+		return prefix, true
+	}
+	return bot.kb_padding.ChangeLivePrefix()
+}
+
+// acceptHistory takes `history` and `history prune [n]` only
+func acceptHistory(arr_cmd []string) bool {
+	switch {
+	case len(arr_cmd) == 1:
+		return true
+	case arr_cmd[1] != "prune":
+		return false
+	case len(arr_cmd) == 2:
+		return true
+	}
+	num, err := strconv.Atoi(arr_cmd[2])
+	return len(arr_cmd) == 3 && err == nil && num > 0
+}
+
+// cmdHistory handles `history prune [n]`, which merges the duplicated inputs and keeps the best n of each role
+func (bot *ChatBot) cmdHistory(original_msg string, arr_cmd []string) (*PluginResult, error) {
+	log.Debug("Execute [history] command on : ", original_msg)
+
+	if len(arr_cmd) < 2 || arr_cmd[1] != "prune" {
+		return &PluginResult{Output: config.Text("tips_history_usage")}, nil
+	}
+	limit := config.MyConfig.System.HistoryLimit
+	if len(arr_cmd) > 2 {
+		num, err := strconv.Atoi(arr_cmd[2])
+		if err != nil || num <= 0 {
+			return &PluginResult{Output: config.Text("tips_history_usage")}, nil
+		}
+		limit = num
+	}
+
+	removed, err := bot.clientdb.PruneOptionHistory(limit)
+	if err != nil {
+		return nil, err
+	}
+	return &PluginResult{Output: fmt.Sprintf(config.Text("tips_history_pruned"), removed)}, nil
+}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/c-bata/go-prompt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistorySearch(t *testing.T) {
+	assertions := require.New(t)
+
+	hs := &historySearch{load: func() []string {
+		return []string{"git-review main", "web-summary https://go.dev", "git-commit-msg"}
+	}}
+	buf := prompt.NewBuffer()
+
+	hs.Next(buf)
+	prefix, ok := hs.Prefix()
+	assertions.True(ok)
+	assertions.Contains(prefix, "`':")
+
+	for _, char := range "git" {
+		hs.Type(buf, string(char))
+	}
+	assertions.Equal("git-review main", buf.Text())
+
+	// Ctrl+R again jumps to the older match
+	hs.Next(buf)
+	assertions.Equal("git-commit-msg", buf.Text())
+	hs.Next(buf)
+	assertions.False(hs.found)
+	assertions.Equal("git-commit-msg", buf.Text())
+
+	hs.Type(buf, "x")
+	assertions.False(hs.found)
+	buf.DeleteBeforeCursor(1)
+	hs.Backspace(buf)
+	assertions.True(hs.found)
+	assertions.Equal("git-review main", buf.Text())
+
+	// any other change ends the search, the match stays for editing
+	hs.Stop()
+	hs.Type(buf, "!")
+	assertions.Equal("git-review main!", buf.Text())
+	_, ok = hs.Prefix()
+	assertions.False(ok)
+
+	hs.Next(buf)
+	hs.Cancel(buf)
+	assertions.Equal("git-review main!", buf.Text())
+}
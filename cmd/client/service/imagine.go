@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	gpt3 "github.com/sashabaranov/go-openai"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/robinmin/xally/config"
+	"github.com/robinmin/xally/shared/clientdb"
+	"github.com/robinmin/xally/shared/utility"
+)
+
+const PLUGIN_NAME_IMAGINE = "imagine"
+
+const IMAGINE_DEFAULT_SIZE = "1024x1024"
+
+// most images drawn by one imagine command
+const IMAGINE_MAX_N = 10
+
+var rx_image_size = regexp.MustCompile(`^\d+x\d+$`)
+
+// cmdImagine runs `imagine <prompt> [--size 1024x1024] [--n 2]`, drawing the images with
+// the image model and saving them into the history folder
+func (bot *ChatBot) cmdImagine(original_msg string, arr_cmd []string) (*PluginResult, error) {
+	log.Debug("Execute [imagine] command on : ", original_msg)
+
+	prompt, size, n, ok := parseImagineArgs(arr_cmd[1:])
+	if !ok || len(prompt) == 0 {
+		return &PluginResult{Output: config.Text("tips_imagine_usage")}, nil
+	}
+
+	bot.Say(fmt.Sprintf(config.Text("tips_imagine_drawing"), n, size), false)
+	images, err := bot.client.CreateImages(prompt, size, n)
+	if err != nil && len(images) == 0 {
+		return nil, err
+	}
+
+	dir := filepath.Join(bot.chat_history_path, HISTORY_IMAGE_FOLDER)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	var output strings.Builder
+	var history strings.Builder
+	history.WriteString("#### " + default_user_avatar + "  " + original_msg + "\n")
+	prefix := "imagine_" + time.Now().Format("20060102_150405")
+	for idx, img := range images {
+		data, err := bot.imageData(&img)
+		if err != nil {
+			log.Error("Failed to get the generated image : ", err)
+			output.WriteString(err.Error() + "\n")
+			continue
+		}
+		name := fmt.Sprintf("%s_%d.png", prefix, idx+1)
+		path := filepath.Join(dir, name)
+		if err = os.WriteFile(path, data, 0644); err != nil {
+			return nil, err
+		}
+
+		bot.clientdb.AddGeneratedImage(&clientdb.GeneratedImage{
+			Prompt:        prompt,
+			RevisedPrompt: img.RevisedPrompt,
+			AIModel:       config.MyConfig.System.ImageModel,
+			Size:          size,
+			Path:          path,
+		})
+
+		output.WriteString(fmt.Sprintf(config.Text("tips_imagine_saved"), path) + "\n")
+		history.WriteString(fmt.Sprintf("![%s](%s/%s)\n", strings.ReplaceAll(prompt, "]", ""), HISTORY_IMAGE_FOLDER, name))
+		if len(img.RevisedPrompt) > 0 {
+			output.WriteString("> " + img.RevisedPrompt + "\n")
+			history.WriteString("> " + img.RevisedPrompt + "\n")
+		}
+	}
+	bot.dumpChatHistory(history.String() + "\n")
+
+	// some images may be drawn before the failure
+	if err != nil {
+		output.WriteString(err.Error() + "\n")
+	}
+	return &PluginResult{Output: output.String()}, nil
+}
+
+// parseImagineArgs reads the prompt and the options, which can be anywhere after the command
+func parseImagineArgs(fields []string) (string, string, int, bool) {
+	size := IMAGINE_DEFAULT_SIZE
+	n := 1
+	words := []string{}
+	for idx := 0; idx < len(fields); idx++ {
+		switch fields[idx] {
+		case "--size":
+			if idx+1 >= len(fields) || !rx_image_size.MatchString(fields[idx+1]) {
+				return "", "", 0, false
+			}
+			idx++
+			size = fields[idx]
+		case "--n":
+			if idx+1 >= len(fields) {
+				return "", "", 0, false
+			}
+			idx++
+			value, err := strconv.Atoi(fields[idx])
+			if err != nil || value < 1 || value > IMAGINE_MAX_N {
+				return "", "", 0, false
+			}
+			n = value
+		default:
+			words = append(words, fields[idx])
+		}
+	}
+	return strings.Join(words, " "), size, n, true
+}
+
+// imageData decodes the image in base64, or downloads it from its URL
+func (bot *ChatBot) imageData(img *gpt3.ImageResponseDataInner) ([]byte, error) {
+	if len(img.B64JSON) > 0 {
+		return base64.StdEncoding.DecodeString(img.B64JSON)
+	}
+	if len(img.URL) == 0 {
+		return nil, fmt.Errorf("no image in the response")
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, img.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := utility.DefaultRetryPolicy.Do(bot.client.HTTPClient, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download the image, status code: %d", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	gpt3 "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/require"
+
+	"github.com/robinmin/xally/config"
+	"github.com/robinmin/xally/shared/clientdb"
+)
+
+// base64 of a 1x1 PNG
+const sample_png = "iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mNk+M9QDwADhgGAWjR9awAAAABJRU5ErkJggg=="
+
+func TestParseImagineArgs(t *testing.T) {
+	assertions := require.New(t)
+
+	prompt, size, n, ok := parseImagineArgs(strings.Fields("a red fox --size 1792x1024 in snow --n 2"))
+	assertions.True(ok)
+	assertions.Equal("a red fox in snow", prompt)
+	assertions.Equal("1792x1024", size)
+	assertions.Equal(2, n)
+
+	prompt, size, n, ok = parseImagineArgs(strings.Fields("a cat"))
+	assertions.True(ok)
+	assertions.Equal("a cat", prompt)
+	assertions.Equal(IMAGINE_DEFAULT_SIZE, size)
+	assertions.Equal(1, n)
+
+	for _, args := range []string{"a cat --size big", "a cat --n 0", "a cat --n 11", "a cat --n"} {
+		_, _, _, ok = parseImagineArgs(strings.Fields(args))
+		assertions.False(ok, args)
+	}
+}
+
+func TestImagine(t *testing.T) {
+	assertions := require.New(t)
+
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		var request gpt3.ImageRequest
+		if r.URL.Path != "/images/generations" || json.NewDecoder(r.Body).Decode(&request) != nil || request.N != 1 {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"created":1,"data":[{"b64_json":"%s","revised_prompt":"A red fox resting in the snow"}]}`, sample_png)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	config.UseTestConfig(t)
+	config.MyConfig.System.APIEndpointOpenai = server.URL
+
+	cdb, err := clientdb.InitClientDB(filepath.Join(dir, "xally.db"), false)
+	assertions.NoError(err)
+	bot := &ChatBot{
+		client:            NewChatBotClient("", server.URL),
+		clientdb:          cdb,
+		chat_history_path: dir,
+		console:           &terminalConsole{},
+	}
+
+	msg := "imagine a red fox --n 2"
+	result, err := bot.cmdImagine(msg, strings.Fields(msg))
+	assertions.NoError(err)
+	// dall-e-3 draws one image for each request
+	assertions.Equal(int32(2), atomic.LoadInt32(&hits))
+	assertions.Contains(result.Output, "A red fox resting in the snow")
+
+	files, err := filepath.Glob(filepath.Join(dir, HISTORY_IMAGE_FOLDER, "imagine_*.png"))
+	assertions.NoError(err)
+	assertions.Len(files, 2)
+	info, err := os.Stat(files[0])
+	assertions.NoError(err)
+	assertions.Greater(info.Size(), int64(0))
+}
@@ -1,15 +1,22 @@
 package service
 
 import (
-	"net/url"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
 	"os"
-	"regexp"
+	"path/filepath"
 	"strings"
+	"time"
 
 	md "github.com/JohannesKaufmann/html-to-markdown"
+	md_plugin "github.com/JohannesKaufmann/html-to-markdown/plugin"
+	"github.com/c-bata/go-prompt"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/robinmin/xally/config"
+	"github.com/robinmin/xally/shared/clientdb"
 	"github.com/robinmin/xally/shared/utility"
 )
 
@@ -25,55 +32,158 @@ const PLUGIN_NAME_WEB_TRANSLATE_CN = "web-translate-cn"
 const PLUGIN_NAME_WEB_TRANSLATE_EN = "web-translate-en"
 const PLUGIN_NAME_WEB_TRANSLATE_JP = "web-translate-jp"
 
+// CompletionHint tells the completer what kind of argument a plugin expects
+type CompletionHint int
+
+const (
+	CompleteNone CompletionHint = iota
+	CompleteFile
+	CompleteURL
+	CompleteRole
+	CompleteModel
+)
+
+var completion_hint_names = []string{"none", "file", "url", "role", "model"}
+
+// MarshalJSON keeps the completion hint readable for the external plugins
+func (hint CompletionHint) MarshalJSON() ([]byte, error) {
+	if int(hint) < 0 || int(hint) >= len(completion_hint_names) {
+		return nil, fmt.Errorf("Invalid completion hint : %d", hint)
+	}
+	return json.Marshal(completion_hint_names[hint])
+}
+
+func (hint *CompletionHint) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	for idx, tmp_name := range completion_hint_names {
+		if strings.EqualFold(name, tmp_name) {
+			*hint = CompletionHint(idx)
+			return nil
+		}
+	}
+	if name == "" {
+		*hint = CompleteNone
+		return nil
+	}
+	return fmt.Errorf("Invalid completion hint : %s", name)
+}
+
+type PluginArg struct {
+	Name     string `json:"name"`
+	Optional bool   `json:"optional,omitempty"`
+	Repeated bool   `json:"repeated,omitempty"`
+}
+
+type PluginHint struct {
+	Text        string `json:"text"`
+	Description string `json:"description,omitempty"`
+	// kind of the argument following the hint, e.g. the model after `set model`
+	Completion CompletionHint `json:"completion,omitempty"`
+}
+
+// PluginMeta describes a plugin. Description is looked up by config.Text,
+// so both i18n keys and plain text work.
+type PluginMeta struct {
+	Name        string         `json:"name"`
+	Aliases     []string       `json:"aliases,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Args        []PluginArg    `json:"args,omitempty"`
+	Completion  CompletionHint `json:"completion,omitempty"`
+	Hints       []PluginHint   `json:"hints,omitempty"`
+	// taken as the command only when it is the whole input, e.g. quit
+	Standalone bool `json:"standalone,omitempty"`
+}
+
+// PluginResult tells the chatbot what to do once a plugin is done
+type PluginResult struct {
+	// message sent to the model on behalf of the user, skipped if blank
+	Question string
+	// quote the message into the conversation before asking
+	Quote string
+	// direct output to the user
+	Output   string
+	NeedDump bool
+}
+
 type Plugin interface {
-	// GetName() string
+	GetMeta() *PluginMeta
 
 	Open() error
 	Close() error
-	Execute(original_msg string, arr_cmd []string) (processed bool, replaced_msg string, replaced_cmd []string, err error)
+	Execute(original_msg string, arr_cmd []string) (*PluginResult, error)
 }
 
-type PluginManager struct {
-	// name string
+// PluginMatcher is implemented by plugins that also pick up input without any command name
+type PluginMatcher interface {
+	Match(original_msg string) bool
+}
 
-	plugins []Plugin
-	// plugin_map map[string]*Plugin
+// PluginArgsChecker is implemented by plugins named by an ordinary word, they only take the
+// input with valid arguments and leave the questions like "history of rome" to be asked
+type PluginArgsChecker interface {
+	AcceptArgs(original_msg string, arr_cmd []string) bool
 }
 
-func NewPluginManager() *PluginManager {
-	pm := &PluginManager{}
-	pm.AddPlugin(&FilePlugin{mode: PLUGIN_NAME_FILE_CONTENT})
-	pm.AddPlugin(&FilePlugin{mode: PLUGIN_NAME_FILE_SUMMARY})
-	pm.AddPlugin(&FilePlugin{mode: PLUGIN_NAME_FILE_TRANSLATE_CN})
-	pm.AddPlugin(&FilePlugin{mode: PLUGIN_NAME_FILE_TRANSLATE_EN})
-	pm.AddPlugin(&FilePlugin{mode: PLUGIN_NAME_FILE_TRANSLATE_JP})
+type PluginManager struct {
+	plugins    []Plugin
+	plugin_map map[string]Plugin
+}
 
-	pm.AddPlugin(&WebSummaryPlugin{mode: PLUGIN_NAME_WEB_CONTENT})
-	pm.AddPlugin(&WebSummaryPlugin{mode: PLUGIN_NAME_WEB_SUMMARY})
-	pm.AddPlugin(&WebSummaryPlugin{mode: PLUGIN_NAME_WEB_TRANSLATE_CN})
-	pm.AddPlugin(&WebSummaryPlugin{mode: PLUGIN_NAME_WEB_TRANSLATE_EN})
-	pm.AddPlugin(&WebSummaryPlugin{mode: PLUGIN_NAME_WEB_TRANSLATE_JP})
+func NewPluginManager(cache *clientdb.ClientDB) *PluginManager {
+	pm := &PluginManager{
+		plugin_map: map[string]Plugin{},
+	}
+	pm.AddPlugin(&FilePlugin{mode: PLUGIN_NAME_FILE_CONTENT, cache: cache})
+	pm.AddPlugin(&FilePlugin{mode: PLUGIN_NAME_FILE_SUMMARY, cache: cache})
+	pm.AddPlugin(&FilePlugin{mode: PLUGIN_NAME_FILE_TRANSLATE_CN, cache: cache})
+	pm.AddPlugin(&FilePlugin{mode: PLUGIN_NAME_FILE_TRANSLATE_EN, cache: cache})
+	pm.AddPlugin(&FilePlugin{mode: PLUGIN_NAME_FILE_TRANSLATE_JP, cache: cache})
+
+	pm.AddPlugin(&WebSummaryPlugin{mode: PLUGIN_NAME_WEB_CONTENT, cache: cache})
+	pm.AddPlugin(&WebSummaryPlugin{mode: PLUGIN_NAME_WEB_SUMMARY, cache: cache})
+	pm.AddPlugin(&WebSummaryPlugin{mode: PLUGIN_NAME_WEB_TRANSLATE_CN, cache: cache})
+	pm.AddPlugin(&WebSummaryPlugin{mode: PLUGIN_NAME_WEB_TRANSLATE_EN, cache: cache})
+	pm.AddPlugin(&WebSummaryPlugin{mode: PLUGIN_NAME_WEB_TRANSLATE_JP, cache: cache})
 
 	return pm
 }
 
-func (pm *PluginManager) AddPlugin(p Plugin) {
+// AddPlugin registers the plugin under its name and aliases, the first one registered wins.
+// The names are case-sensitive, so "Help me ..." is still a question.
+func (pm *PluginManager) AddPlugin(p Plugin) error {
+	meta := p.GetMeta()
+	if meta == nil || meta.Name == "" {
+		return errors.New("Plugin without a name")
+	}
+
+	names := append([]string{meta.Name}, meta.Aliases...)
+	for _, name := range names {
+		if _, ok := pm.plugin_map[name]; ok {
+			return fmt.Errorf("Duplicated plugin name : %s", name)
+		}
+	}
+	for _, name := range names {
+		pm.plugin_map[name] = p
+	}
 	pm.plugins = append(pm.plugins, p)
-	// pm.plugin_map[name] = &p
+	return nil
 }
 
-// func (pm *PluginManager) GetPlugin(name string) *Plugin {
-// 	if plugin, ok := pm.plugin_map[name]; !ok {
-// 		return plugin
-// 	}
-// 	return nil
-// }
+func (pm *PluginManager) GetPlugin(name string) Plugin {
+	if plugin, ok := pm.plugin_map[name]; ok {
+		return plugin
+	}
+	return nil
+}
 
 func (pm *PluginManager) Open() error {
 	for _, p := range pm.plugins {
 		err := p.Open()
 		if err != nil {
-			log.Error("Failed to close plugin on plugin manager")
+			log.Error("Failed to open plugin on plugin manager")
 		}
 	}
 	return nil
@@ -89,26 +199,172 @@ func (pm *PluginManager) Close() error {
 	return nil
 }
 
-func (pm *PluginManager) Execute(original_msg string, arr_cmd []string) (processed bool, replaced_msg string, replaced_cmd []string, err error) {
-	processed = false
+// Execute dispatches the input to the plugin named by its first field, or to the
+// first plugin matching the whole input. processed is false if nobody takes it.
+func (pm *PluginManager) Execute(original_msg string, arr_cmd []string) (processed bool, result *PluginResult, err error) {
+	if len(arr_cmd) == 0 {
+		return false, nil, nil
+	}
+
+	p := pm.GetPlugin(arr_cmd[0])
+	if p != nil && p.GetMeta().Standalone && strings.TrimSpace(original_msg) != arr_cmd[0] {
+		p = nil
+	}
+	if checker, ok := p.(PluginArgsChecker); ok && !checker.AcceptArgs(original_msg, arr_cmd) {
+		p = nil
+	}
+	if p == nil {
+		for _, tmp_plugin := range pm.plugins {
+			if matcher, ok := tmp_plugin.(PluginMatcher); ok && matcher.Match(original_msg) {
+				p = tmp_plugin
+				arr_cmd = []string{p.GetMeta().Name, original_msg}
+				break
+			}
+		}
+	}
+	if p == nil {
+		return false, nil, nil
+	}
+
+	result, err = p.Execute(original_msg, arr_cmd)
+	if err != nil {
+		log.Error(err)
+	}
+	if result == nil {
+		result = &PluginResult{}
+	}
+	return true, result, err
+}
+
+// Suggestions generates the completer suggestions of the command names
+func (pm *PluginManager) Suggestions() []prompt.Suggest {
+	suggestions := []prompt.Suggest{}
+	for _, p := range pm.plugins {
+		meta := p.GetMeta()
+		suggestions = append(suggestions, prompt.Suggest{
+			Text:        meta.Name,
+			Description: config.Text(meta.Description),
+		})
+	}
+	return suggestions
+}
+
+// Help renders the usage of all plugins, or of the named one only
+func (pm *PluginManager) Help(name string) string {
+	var sb strings.Builder
+
+	if len(name) > 0 {
+		p := pm.GetPlugin(name)
+		if p == nil {
+			return fmt.Sprintf(config.Text("tips_help_unknown_cmd"), name)
+		}
+		meta := p.GetMeta()
+		sb.WriteString("#### " + meta.Name + "\n\n")
+		sb.WriteString(config.Text(meta.Description) + "\n\n")
+		sb.WriteString("```\n" + meta.Usage() + "\n")
+		for _, hint := range meta.Hints {
+			sb.WriteString(meta.Name + " " + hint.Text + "\t" + config.Text(hint.Description) + "\n")
+		}
+		sb.WriteString("```\n")
+		if len(meta.Aliases) > 0 {
+			sb.WriteString("\n" + config.Text("tips_help_aliases") + strings.Join(meta.Aliases, ", ") + "\n")
+		}
+		return sb.String()
+	}
+
+	sb.WriteString(config.Text("tips_help_header") + "\n|----|----|----|\n")
 	for _, p := range pm.plugins {
-		tmp_processed, tmp_replaced_msg, tmp_replaced_cmd, tmp_err := p.Execute(original_msg, arr_cmd)
-		if tmp_err != nil {
-			log.Error(tmp_err)
+		meta := p.GetMeta()
+		usage := meta.Usage()
+		if len(meta.Aliases) > 0 {
+			usage = usage + " (" + strings.Join(meta.Aliases, ", ") + ")"
+		}
+		sb.WriteString(fmt.Sprintf("| %s | `%s` | %s |\n", meta.Name, strings.ReplaceAll(usage, "|", "\\|"), config.Text(meta.Description)))
+	}
+	return sb.String()
+}
+
+// Usage renders the argument spec, e.g. `web-summary <url> [--raw]`
+func (meta *PluginMeta) Usage() string {
+	usage := meta.Name
+	for _, arg := range meta.Args {
+		name := arg.Name
+		if arg.Repeated {
+			name = name + "..."
+		}
+		if arg.Optional {
+			usage = usage + " [" + name + "]"
+		} else {
+			usage = usage + " <" + name + ">"
+		}
+	}
+	return usage
+}
+
+// ArgSuggestions lists the next words of the hints following the typed arguments, together
+// with the kind of completion for the argument under the cursor
+func (meta *PluginMeta) ArgSuggestions(args []string) ([]prompt.Suggest, CompletionHint) {
+	suggestions := []prompt.Suggest{}
+	kind := meta.Completion
+	seen := map[string]bool{}
+	for _, hint := range meta.Hints {
+		words := strings.Fields(hint.Text)
+		if len(words) < len(args) || !equalWords(words[:len(args)], args) {
+			continue
+		}
+		if len(words) == len(args) {
+			if hint.Completion != CompleteNone {
+				kind = hint.Completion
+			}
+			continue
 		}
-		if tmp_processed {
-			processed = true
-			return processed, tmp_replaced_msg, tmp_replaced_cmd, tmp_err
+
+		next := words[len(args)]
+		if seen[next] {
+			continue
 		}
+		seen[next] = true
+		suggestions = append(suggestions, prompt.Suggest{
+			Text:        next,
+			Description: config.Text(hint.Description),
+		})
 	}
-	return processed, "", nil, nil
+	return suggestions, kind
+}
+
+func equalWords(words1 []string, words2 []string) bool {
+	for idx := range words1 {
+		if !strings.EqualFold(words1[idx], words2[idx]) {
+			return false
+		}
+	}
+	return true
+}
+
+// quoteMessage formats the message as Markdown quote for echoing
+func quoteMessage(msg string) string {
+	return "> " + strings.ReplaceAll(msg, "\n", "\n> ") + "\n"
 }
 
 type FilePlugin struct {
-	mode string
+	mode  string
+	cache *clientdb.ClientDB
 	// rx_pattern *regexp.Regexp
 }
 
+func (plugin *FilePlugin) GetMeta() *PluginMeta {
+	meta := &PluginMeta{
+		Name:        plugin.mode,
+		Description: "tips_suggestion_" + strings.ReplaceAll(plugin.mode, "-", "_"),
+		Args:        []PluginArg{{Name: "file"}},
+		Completion:  CompleteFile,
+	}
+	if plugin.acceptMultiFiles() {
+		meta.Args = []PluginArg{{Name: "file|dir|glob", Repeated: true}}
+	}
+	return meta
+}
+
 func (plugin *FilePlugin) Open() error {
 	// plugin.rx_pattern = regexp.MustCompile(RX_FILE_NAME)
 	return nil
@@ -118,54 +374,59 @@ func (*FilePlugin) Close() error {
 	return nil
 }
 
-func (plugin *FilePlugin) Execute(original_msg string, arr_cmd []string) (processed bool, replaced_msg string, replaced_cmd []string, err error) {
-	processed = false
-	err = nil
-
-	if original_msg == "" {
-		return
-	}
-
-	var file_name string
-	var current_mode string
-	if len(arr_cmd) > 1 {
-		file_name = strings.Join(arr_cmd[1:], " ")
-		current_mode = arr_cmd[0]
-	} else {
-		file_name = original_msg
-		current_mode = PLUGIN_NAME_FILE_CONTENT
-	}
-
-	// ignore invalid input or skip the other modes
-	if file_name == "" || plugin.mode != current_mode {
-		return
+// Match picks up any input which is an existing file name as file-content
+func (plugin *FilePlugin) Match(original_msg string) bool {
+	if plugin.mode != PLUGIN_NAME_FILE_CONTENT {
+		return false
 	}
+	info, err := os.Stat(strings.TrimSpace(original_msg))
+	return err == nil && info.Mode().IsRegular()
+}
 
-	if _, err = os.Stat(file_name); os.IsNotExist(err) {
-		log.Debug("It's not a file : ", file_name)
-		return
+func (plugin *FilePlugin) Execute(original_msg string, arr_cmd []string) (*PluginResult, error) {
+	if len(arr_cmd) < 2 {
+		return &PluginResult{Output: plugin.GetMeta().Usage()}, nil
 	}
+	file_name := strings.Join(arr_cmd[1:], " ")
+
+	var replaced_msg string
+
+	// directories and glob patterns are bundled into one message, while single file keeps going below
+	if info, stat_err := os.Stat(file_name); (stat_err != nil || info.IsDir()) && plugin.acceptMultiFiles() {
+		var files []string
+		var err error
+		if stat_err == nil {
+			files, err = utility.CollectFiles([]string{file_name})
+		} else {
+			files, err = utility.CollectFiles(arr_cmd[1:])
+		}
+		if err != nil {
+			log.Error("Failed to collect files from : ", file_name, err)
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf(config.Text("error_file_not_found"), file_name)
+		}
+		replaced_msg = plugin.bundleFiles(files, config.MyConfig.System.FileContextBudget)
+	} else {
+		if stat_err != nil || info.IsDir() {
+			log.Debug("It's not a file : ", file_name)
+			return nil, fmt.Errorf(config.Text("error_file_not_found"), file_name)
+		}
 
-	var data []byte
-	if data, err = os.ReadFile(file_name); err != nil {
-		log.Error("Failed to read data from : ", file_name)
-		return
-	}
-	if len(data) <= 0 {
-		log.Info("Blank file ", file_name)
-		return
+		data, err := plugin.readFile(file_name)
+		if err != nil {
+			log.Error("Failed to read data from : ", file_name)
+			return nil, err
+		}
+		if len(data) <= 0 {
+			log.Info("Blank file ", file_name)
+			return nil, fmt.Errorf(config.Text("error_file_not_found"), file_name)
+		}
+		replaced_msg = string(data)
 	}
 
-	// stop bubble up
-	processed = true
-	replaced_msg = string(data)
-	if current_mode != PLUGIN_NAME_FILE_CONTENT {
-		replaced_cmd = append([]string{plugin.mode}, strings.Fields(replaced_msg)...)
-	} else {
-		replaced_cmd = append([]string{plugin.mode}, replaced_msg)
-	}
 	var prompt_msg string
-	switch current_mode {
+	switch plugin.mode {
 	case PLUGIN_NAME_FILE_SUMMARY:
 		prompt_msg = config.Text("prompt_content_summary")
 	case PLUGIN_NAME_FILE_TRANSLATE_CN:
@@ -178,11 +439,99 @@ func (plugin *FilePlugin) Execute(original_msg string, arr_cmd []string) (proces
 	if len(prompt_msg) > 0 {
 		replaced_msg = prompt_msg + "\n\n-------------------------\n" + replaced_msg
 	}
-	return
+	return &PluginResult{Question: replaced_msg, Quote: replaced_msg}, nil
+}
+
+// only file-content and file-summary make sense on a bunch of files
+func (plugin *FilePlugin) acceptMultiFiles() bool {
+	return plugin.mode == PLUGIN_NAME_FILE_CONTENT || plugin.mode == PLUGIN_NAME_FILE_SUMMARY
+}
+
+// bundleFiles concatenates the files with per-file headers until the estimated token budget is used up
+func (plugin *FilePlugin) bundleFiles(files []string, budget int) string {
+	var sb strings.Builder
+	skipped := []string{}
+
+	for _, file_name := range files {
+		info, err := os.Stat(file_name)
+		if err != nil || info.Size() == 0 {
+			continue
+		}
+
+		// skip without reading the file when it can not fit in anyway
+		if budget > 0 && utility.EstimateTokens(sb.Len()+int(info.Size())) > budget {
+			skipped = append(skipped, file_name)
+			continue
+		}
+
+		data, err := plugin.readFile(file_name)
+		if err != nil {
+			log.Error("Failed to read data from : ", file_name)
+			skipped = append(skipped, file_name)
+			continue
+		}
+		if utility.IsBinaryContent(data) {
+			log.Debug("Skip binary file : ", file_name)
+			continue
+		}
+
+		sb.WriteString("==> " + file_name + " <==\n")
+		sb.Write(data)
+		if !strings.HasSuffix(string(data), "\n") {
+			sb.WriteString("\n")
+		}
+		sb.WriteString("\n")
+	}
+
+	if len(skipped) > 0 {
+		sb.WriteString(fmt.Sprintf(config.Text("tips_file_skipped"), len(skipped), budget))
+		sb.WriteString("\n- " + strings.Join(skipped, "\n- ") + "\n")
+	}
+	return sb.String()
+}
+
+// readFile loads the file content from the cache as long as the file is not modified since then
+func (plugin *FilePlugin) readFile(file_name string) ([]byte, error) {
+	info, err := os.Stat(file_name)
+	if err != nil {
+		return nil, err
+	}
+	abs_name, err := filepath.Abs(file_name)
+	if err != nil {
+		abs_name = file_name
+	}
+
+	cached := plugin.cache.GetContentCache(clientdb.CACHE_KIND_FILE, abs_name)
+	if cached != nil && cached.ModTime.Equal(info.ModTime()) && int64(cached.Size) == info.Size() {
+		log.Debug("Load file content from cache : ", abs_name)
+		return cached.Content, nil
+	}
+
+	data, err := os.ReadFile(file_name)
+	if err != nil {
+		return nil, err
+	}
+	plugin.cache.SaveContentCache(&clientdb.ContentCache{
+		Kind:    clientdb.CACHE_KIND_FILE,
+		Key:     abs_name,
+		ModTime: info.ModTime(),
+		Content: data,
+	})
+	return data, nil
 }
 
 type WebSummaryPlugin struct {
-	mode string
+	mode  string
+	cache *clientdb.ClientDB
+}
+
+func (plugin *WebSummaryPlugin) GetMeta() *PluginMeta {
+	return &PluginMeta{
+		Name:        plugin.mode,
+		Description: "tips_suggestion_" + strings.ReplaceAll(plugin.mode, "-", "_"),
+		Args:        []PluginArg{{Name: "url"}, {Name: "--raw", Optional: true}},
+		Completion:  CompleteURL,
+	}
 }
 
 func (plugin *WebSummaryPlugin) Open() error {
@@ -194,50 +543,27 @@ func (*WebSummaryPlugin) Close() error {
 	return nil
 }
 
-func (plugin *WebSummaryPlugin) Execute(original_msg string, arr_cmd []string) (processed bool, replaced_msg string, replaced_cmd []string, err error) {
-	processed = false
-	replaced_msg = ""
-	err = nil
-
-	if original_msg == "" {
-		return
-	}
-
-	var url_str string
-	var current_mode string
-	if len(arr_cmd) > 0 {
-		url_str = strings.Join(arr_cmd[1:], " ")
-		current_mode = arr_cmd[0]
-	} else {
-		url_str = original_msg
-		current_mode = PLUGIN_NAME_WEB_CONTENT
-	}
-	if _, err = url.Parse(url_str); err != nil || plugin.mode != current_mode {
-		return
+func (plugin *WebSummaryPlugin) Execute(original_msg string, arr_cmd []string) (*PluginResult, error) {
+	// --raw skips the main content extraction and keeps the full page
+	raw := false
+	args := []string{}
+	for _, arg := range arr_cmd[1:] {
+		if arg == "--raw" {
+			raw = true
+		} else {
+			args = append(args, arg)
+		}
 	}
-	// stop bubble up
-	processed = true
-
-	headers := map[string]string{}
-	payload := ""
-	statusCode, responseBody, err := utility.FetchURLWithRetry("GET", url_str, payload, headers, 3, 5)
-	if err != nil || statusCode != 200 || responseBody == "" {
-		log.Error("Failed to fetch web page from : ", url_str)
-		return
+	url_str := strings.Join(args, " ")
+	if !utility.IsValidURL(url_str) {
+		return &PluginResult{Output: plugin.GetMeta().Usage()}, nil
 	}
 
-	// try to remove hyper-links
-	re := regexp.MustCompile(`<a href=['"](.*?)['"]>(.*?)</a>`)
-	responseBody = re.ReplaceAllString(responseBody, "$2")
-
-	converter := md.NewConverter("", true, nil)
-	replaced_msg, err = converter.ConvertString(responseBody)
+	replaced_msg, err := plugin.loadMarkdown(url_str, raw)
 	if err != nil {
-		log.Error("Failed to convert content in markdown")
-		return
+		return nil, err
 	}
 
-	replaced_cmd = append([]string{plugin.mode}, strings.Fields(replaced_msg)...)
 	var prompt_msg string
 	switch plugin.mode {
 	case PLUGIN_NAME_WEB_SUMMARY:
@@ -249,9 +575,106 @@ func (plugin *WebSummaryPlugin) Execute(original_msg string, arr_cmd []string) (
 	case PLUGIN_NAME_WEB_TRANSLATE_JP:
 		prompt_msg = config.Text("prompt_translate_jp")
 	}
-	if len(prompt_msg) > 0 {
-		replaced_msg = prompt_msg + "\n-------------------------\n" + replaced_msg
+
+	// web-content only loads the page into the conversation
+	if len(prompt_msg) == 0 {
+		return &PluginResult{Quote: replaced_msg}, nil
+	}
+	replaced_msg = prompt_msg + "\n-------------------------\n" + replaced_msg
+	return &PluginResult{Question: replaced_msg, Quote: replaced_msg}, nil
+}
+
+// loadMarkdown fetches the page and converts its main content (or the full page if raw) into Markdown
+func (plugin *WebSummaryPlugin) loadMarkdown(url_str string, raw bool) (string, error) {
+	page, err := plugin.fetchPage(url_str)
+	if err != nil || page.StatusCode != http.StatusOK || len(page.Body) == 0 {
+		log.Error("Failed to fetch web page from : ", url_str)
+		if err == nil {
+			err = fmt.Errorf(config.Text("error_fetch_web_page"), url_str)
+		}
+		return "", err
+	}
+
+	var content string
+	if content, err = utility.DecodeHTML(page.Body, page.ContentType); err != nil {
+		log.Warn("Failed to decode web page in its charset, fallback to UTF-8 : ", err)
+	}
+	if !raw {
+		if content, err = utility.ExtractMainContent(content); err != nil {
+			log.Error("Failed to extract main content from : ", url_str)
+			return "", err
+		}
+	}
+	// try to remove hyper-links
+	if content, err = utility.StripHyperLinks(content); err != nil {
+		log.Error("Failed to remove hyper-links from : ", url_str)
+		return "", err
+	}
+
+	converter := md.NewConverter("", true, nil)
+	converter.Use(md_plugin.Table())
+	markdown, err := converter.ConvertString(content)
+	if err != nil {
+		log.Error("Failed to convert content in markdown")
+		return "", err
+	}
+	return markdown, nil
+}
+
+// fetchPage serves the page from the cache within the TTL, otherwise revalidates it with ETag / Last-Modified
+func (plugin *WebSummaryPlugin) fetchPage(url_str string) (*utility.WebPage, error) {
+	cached := plugin.cache.GetContentCache(clientdb.CACHE_KIND_WEB, url_str)
+	if cached != nil && time.Now().Before(cached.ExpiresAt) {
+		log.Debug("Load web page from cache : ", url_str)
+		return &utility.WebPage{
+			URL:          url_str,
+			StatusCode:   http.StatusOK,
+			ContentType:  cached.ContentType,
+			ETag:         cached.ETag,
+			LastModified: cached.LastModified,
+			Body:         cached.Content,
+		}, nil
+	}
+
+	headers := map[string]string{}
+	if cached != nil {
+		if len(cached.ETag) > 0 {
+			headers["If-None-Match"] = cached.ETag
+		}
+		if len(cached.LastModified) > 0 {
+			headers["If-Modified-Since"] = cached.LastModified
+		}
+	}
+	page, err := utility.FetchWebPage(url_str, headers, 3, 5*time.Second)
+	if err != nil {
+		return page, err
 	}
 
-	return
+	if page.StatusCode == http.StatusNotModified && cached != nil {
+		log.Debug("Web page not modified since last fetch : ", url_str)
+		page.StatusCode = http.StatusOK
+		page.Body = cached.Content
+		if len(page.ContentType) == 0 {
+			page.ContentType = cached.ContentType
+		}
+		if len(page.ETag) == 0 {
+			page.ETag = cached.ETag
+		}
+		if len(page.LastModified) == 0 {
+			page.LastModified = cached.LastModified
+		}
+	}
+
+	if page.StatusCode == http.StatusOK && len(page.Body) > 0 {
+		plugin.cache.SaveContentCache(&clientdb.ContentCache{
+			Kind:         clientdb.CACHE_KIND_WEB,
+			Key:          url_str,
+			ContentType:  page.ContentType,
+			ETag:         page.ETag,
+			LastModified: page.LastModified,
+			Content:      page.Body,
+			ExpiresAt:    time.Now().Add(time.Duration(config.MyConfig.System.CacheTTL) * time.Second),
+		})
+	}
+	return page, nil
 }
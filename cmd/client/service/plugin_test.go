@@ -0,0 +1,175 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/robinmin/xally/config"
+	"github.com/robinmin/xally/shared/clientdb"
+)
+
+func TestBundleFiles(t *testing.T) {
+	assertions := require.New(t)
+
+	dir := t.TempDir()
+	small, large := filepath.Join(dir, "small.txt"), filepath.Join(dir, "large.txt")
+	assertions.NoError(os.WriteFile(small, []byte(strings.Repeat("a", 2000)), 0644))
+	assertions.NoError(os.WriteFile(large, []byte(strings.Repeat("b", 8000)), 0644))
+
+	// the budget is in tokens, so 1000 tokens take the 2000 bytes but not 8000 more
+	plugin := &FilePlugin{mode: PLUGIN_NAME_FILE_CONTENT}
+	bundle := plugin.bundleFiles([]string{small, large}, 1000)
+	assertions.Contains(bundle, "==> "+small+" <==")
+	assertions.NotContains(bundle, "==> "+large+" <==")
+	assertions.Contains(bundle, "- "+large)
+
+	bundle = plugin.bundleFiles([]string{small, large}, 3000)
+	assertions.Contains(bundle, "==> "+large+" <==")
+}
+
+func TestReadFileCache(t *testing.T) {
+	assertions := require.New(t)
+
+	cache, err := clientdb.InitClientDB(filepath.Join(t.TempDir(), "xally.db"), false)
+	assertions.NoError(err)
+	plugin := &FilePlugin{mode: PLUGIN_NAME_FILE_CONTENT, cache: cache}
+
+	file_name := filepath.Join(t.TempDir(), "notes.txt")
+	assertions.NoError(os.WriteFile(file_name, []byte("first"), 0644))
+	mod_time := time.Now().Add(-time.Hour).Truncate(time.Second)
+	assertions.NoError(os.Chtimes(file_name, mod_time, mod_time))
+	data, err := plugin.readFile(file_name)
+	assertions.NoError(err)
+	assertions.Equal("first", string(data))
+
+	// same size and mtime, so it comes from the cache
+	assertions.NoError(os.WriteFile(file_name, []byte("other"), 0644))
+	assertions.NoError(os.Chtimes(file_name, mod_time, mod_time))
+	data, err = plugin.readFile(file_name)
+	assertions.NoError(err)
+	assertions.Equal("first", string(data))
+
+	// a new mtime reads the file again
+	mod_time = mod_time.Add(time.Minute)
+	assertions.NoError(os.Chtimes(file_name, mod_time, mod_time))
+	data, err = plugin.readFile(file_name)
+	assertions.NoError(err)
+	assertions.Equal("other", string(data))
+}
+
+func TestFetchPageRevalidate(t *testing.T) {
+	assertions := require.New(t)
+
+	// expire at once to revalidate on every fetch
+	config.UseTestConfig(t).System.CacheTTL = 0
+	cache, err := clientdb.InitClientDB(filepath.Join(t.TempDir(), "xally.db"), false)
+	assertions.NoError(err)
+	plugin := &WebSummaryPlugin{mode: PLUGIN_NAME_WEB_CONTENT, cache: cache}
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte("<html><body><p>cached page</p></body></html>"))
+	}))
+	defer server.Close()
+
+	page, err := plugin.fetchPage(server.URL)
+	assertions.NoError(err)
+	assertions.Equal(http.StatusOK, page.StatusCode)
+	assertions.Contains(string(page.Body), "cached page")
+
+	page, err = plugin.fetchPage(server.URL)
+	assertions.NoError(err)
+	assertions.Equal(2, requests)
+	assertions.Equal(http.StatusOK, page.StatusCode)
+	assertions.Contains(string(page.Body), "cached page")
+	assertions.Equal("text/html; charset=utf-8", page.ContentType)
+	assertions.Equal(`"v1"`, page.ETag)
+}
+
+type fakePlugin struct {
+	meta  PluginMeta
+	match string
+	calls [][]string
+}
+
+func (plugin *fakePlugin) GetMeta() *PluginMeta {
+	return &plugin.meta
+}
+
+func (*fakePlugin) Open() error {
+	return nil
+}
+
+func (*fakePlugin) Close() error {
+	return nil
+}
+
+func (plugin *fakePlugin) Match(original_msg string) bool {
+	return len(plugin.match) > 0 && strings.HasPrefix(original_msg, plugin.match)
+}
+
+func (plugin *fakePlugin) Execute(original_msg string, arr_cmd []string) (*PluginResult, error) {
+	plugin.calls = append(plugin.calls, arr_cmd)
+	return &PluginResult{Output: plugin.meta.Name}, nil
+}
+
+func TestPluginManagerExecute(t *testing.T) {
+	assertions := require.New(t)
+
+	pm := &PluginManager{plugin_map: map[string]Plugin{}}
+	assertions.NoError(pm.AddPlugin(&fakePlugin{meta: PluginMeta{Name: "help"}}))
+	assertions.NoError(pm.AddPlugin(&fakePlugin{meta: PluginMeta{Name: "translate", Aliases: []string{"tr"}}}))
+	assertions.NoError(pm.AddPlugin(&fakePlugin{meta: PluginMeta{Name: "quit", Aliases: []string{"exit", "q"}, Standalone: true}}))
+	assertions.NoError(pm.AddPlugin(&fakePlugin{meta: PluginMeta{Name: "issue"}, match: "JIRA-"}))
+	assertions.Error(pm.AddPlugin(&fakePlugin{meta: PluginMeta{Name: "other", Aliases: []string{"tr"}}}))
+
+	cases := []struct {
+		input  string
+		plugin string
+		args   []string
+	}{
+		{input: "help", plugin: "help", args: []string{"help"}},
+		{input: "help quit", plugin: "help", args: []string{"help", "quit"}},
+		{input: "tr hello world", plugin: "translate", args: []string{"tr", "hello", "world"}},
+		{input: "translate hello", plugin: "translate", args: []string{"translate", "hello"}},
+		{input: "JIRA-42 details", plugin: "issue", args: []string{"issue", "JIRA-42 details"}},
+		{input: "quit", plugin: "quit", args: []string{"quit"}},
+		{input: "  q  ", plugin: "quit", args: []string{"q"}},
+		{input: "exit", plugin: "quit", args: []string{"exit"}},
+		// questions starting with a command word in another case
+		{input: "Help me write a poem"},
+		{input: "Translate this into French"},
+		{input: "History of Rome?"},
+		// the quit aliases only quit as the whole input
+		{input: "q what is a quine"},
+		{input: "exit codes of bash"},
+		{input: "Quit"},
+	}
+	for _, c := range cases {
+		processed, result, err := pm.Execute(c.input, strings.Fields(c.input))
+		assertions.NoError(err, c.input)
+		if len(c.plugin) == 0 {
+			assertions.False(processed, c.input)
+			continue
+		}
+		assertions.True(processed, c.input)
+		assertions.Equal(c.plugin, result.Output, c.input)
+
+		plugin := pm.GetPlugin(c.plugin).(*fakePlugin)
+		assertions.Equal(c.args, plugin.calls[len(plugin.calls)-1], c.input)
+	}
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/robinmin/xally/config"
+	"github.com/robinmin/xally/shared/utility"
+)
+
+// how often the config files are checked for changes
+const CONFIG_WATCH_INTERVAL = 2 * time.Second
+
+// WatchConfig applies the changes of the config files in the background while the session
+// is running, until the chatbot is closed
+func (bot *ChatBot) WatchConfig() {
+	bot.watchConfig(CONFIG_WATCH_INTERVAL)
+}
+
+func (bot *ChatBot) watchConfig(interval time.Duration) {
+	if bot.watch_stop != nil {
+		return
+	}
+	bot.watch_stop = make(chan struct{})
+	go func(stop chan struct{}) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				bot.reloadConfig()
+			}
+		}
+	}(bot.watch_stop)
+}
+
+// stopWatchConfig stops the watching started by WatchConfig
+func (bot *ChatBot) stopWatchConfig() {
+	if bot.watch_stop != nil {
+		close(bot.watch_stop)
+		bot.watch_stop = nil
+	}
+}
+
+// reloadConfig applies the changes of the config files to the running session. It waits
+// for the running command, and on any problem the current configuration is kept and the
+// problems are shown on the console. The completer and Status run besides the commands,
+// so they are kept off while the configuration is swapped.
+func (bot *ChatBot) reloadConfig() {
+	bot.exec_mutex.Lock()
+	defer bot.exec_mutex.Unlock()
+
+	if bot.config_watcher == nil || !bot.config_watcher.Changed() {
+		return
+	}
+	bot.state_mutex.Lock()
+	defer bot.state_mutex.Unlock()
+
+	old_cfg := config.MyConfig
+	new_cfg, err := config.ReloadClientConfig()
+	if err != nil {
+		log.Error("Failed to reload the configuration : ", err)
+		bot.Say(fmt.Sprintf(config.Text("tips_config_reload_failed"), err.Error()), false)
+		return
+	}
+	// the project file may have been created or removed since the last check
+	bot.config_watcher = config.NewWatcher(new_cfg.WatchedFiles()...)
+	// nothing to apply, e.g. the user file is just written back by the client itself
+	if reflect.DeepEqual(new_cfg.System, old_cfg.System) && reflect.DeepEqual(new_cfg.Roles, old_cfg.Roles) {
+		return
+	}
+
+	utility.SetLogLevel(new_cfg.System.LogLevel)
+	network_changed := new_cfg.System.ProxyURL != old_cfg.System.ProxyURL ||
+		!reflect.DeepEqual(new_cfg.System.NoProxy, old_cfg.System.NoProxy) ||
+		new_cfg.System.CABundle != old_cfg.System.CABundle
+	if network_changed {
+		if err := SetupNetwork(new_cfg); err != nil {
+			log.Error("Failed to set up the network : ", err)
+			bot.Say(fmt.Sprintf(config.Text("tips_network_setup_failed"), err.Error()), false)
+		}
+	}
+	if new_cfg.System.OpenaiApiKey != old_cfg.System.OpenaiApiKey || new_cfg.System.APIEndpointOpenai != old_cfg.System.APIEndpointOpenai {
+		client := NewChatBotClient(new_cfg.System.OpenaiApiKey, new_cfg.System.APIEndpointOpenai)
+		client.msg_history = bot.client.msg_history
+		bot.client = client
+		bot.service_models = nil
+		bot.CheckConnectivity()
+	} else if network_changed {
+		bot.CheckConnectivity()
+	}
+	bot.setupTranslator()
+	bot.setupResponseCache()
+
+	// keep the conversation as long as the active role still has the same prompt
+	role, err := new_cfg.FindRole(bot.role.Name)
+	switch {
+	case err != nil:
+		log.Error("Failed to find role after reloading : ", err)
+	case role.Name == bot.role.Name && role.Prompt == bot.role.Prompt && role.Opening == bot.role.Opening:
+		// the model set in the session stays unless the file changes it
+		if old_role, ok := old_cfg.Roles[role.Name]; ok && old_role.Model == role.Model {
+			role.Model = bot.role.Model
+		}
+		bot.role = role
+	default:
+		bot.resetRole(role.Name, false)
+	}
+
+	log.Info("Configuration reloaded from : ", new_cfg.WatchedFiles())
+	bot.Say(config.Text("tips_config_reloaded"), false)
+}
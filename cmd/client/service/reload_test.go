@@ -0,0 +1,109 @@
+package service
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/robinmin/xally/config"
+)
+
+// chanConsole passes the messages said to the channel
+type chanConsole struct {
+	said chan string
+}
+
+func (c *chanConsole) Say(msg string) {
+	c.said <- msg
+}
+
+func (*chanConsole) Answer(avatar string, msg string) {}
+
+func (*chanConsole) Usage(stats *UsageStats) {}
+
+func (*chanConsole) ReadLine(question string, initial string) string {
+	return ""
+}
+
+func (*chanConsole) ReadPassword(question string) (string, error) {
+	return "", nil
+}
+
+func (*chanConsole) Terminal() (io.Reader, io.Writer, io.Writer) {
+	return nil, io.Discard, io.Discard
+}
+
+func (*chanConsole) Quit() {}
+
+func TestWatchConfig(t *testing.T) {
+	assertions := require.New(t)
+
+	saved_system := config.SystemConfigFile
+	defer func() {
+		config.SystemConfigFile = saved_system
+	}()
+	config.SystemConfigFile = filepath.Join(t.TempDir(), "missing.yaml")
+	cfg := config.UseTestConfig(t)
+	user_file := filepath.Join(t.TempDir(), "xally.yaml")
+	assertions.NoError(os.WriteFile(user_file, []byte("system:\n  log_level: info\n"), 0644))
+	assertions.NoError(cfg.LoadLayers(user_file))
+
+	console := &chanConsole{said: make(chan string, 1)}
+	bot := &ChatBot{
+		console:        console,
+		config_watcher: config.NewWatcher(cfg.WatchedFiles()...),
+	}
+	bot.watchConfig(10 * time.Millisecond)
+	defer bot.stopWatchConfig()
+
+	// the problem is told without any command from the user, and the configuration is kept
+	future := time.Now().Add(time.Minute)
+	assertions.NoError(os.WriteFile(user_file, []byte("system:\n  log_level: loud\n"), 0644))
+	assertions.NoError(os.Chtimes(user_file, future, future))
+	select {
+	case msg := <-console.said:
+		assertions.Contains(msg, "log_level")
+	case <-time.After(5 * time.Second):
+		assertions.Fail("no reload reported")
+	}
+	assertions.Same(cfg, config.MyConfig)
+}
+
+func TestReloadKeepsSessionModel(t *testing.T) {
+	assertions := require.New(t)
+
+	saved_system := config.SystemConfigFile
+	defer func() {
+		config.SystemConfigFile = saved_system
+	}()
+	config.SystemConfigFile = filepath.Join(t.TempDir(), "missing.yaml")
+	cfg := config.UseTestConfig(t)
+	user_file := filepath.Join(t.TempDir(), "xally.yaml")
+	assertions.NoError(os.WriteFile(user_file, []byte("system:\n  file_context_budget: 3000\n"), 0644))
+	assertions.NoError(cfg.LoadLayers(user_file))
+
+	role, err := cfg.FindRole(cfg.System.DefaultRole)
+	assertions.NoError(err)
+	file_model := role.Model
+	// as `set model` does
+	role.Model = "gpt-4-session"
+	bot := &ChatBot{
+		client:         NewChatBotClient("", cfg.System.APIEndpointOpenai),
+		role:           role,
+		console:        &chanConsole{said: make(chan string, 10)},
+		config_watcher: config.NewWatcher(cfg.WatchedFiles()...),
+	}
+
+	future := time.Now().Add(time.Minute)
+	assertions.NoError(os.WriteFile(user_file, []byte("system:\n  file_context_budget: 4000\n"), 0644))
+	assertions.NoError(os.Chtimes(user_file, future, future))
+	bot.reloadConfig()
+	assertions.NotSame(cfg, config.MyConfig)
+	assertions.Equal(4000, config.MyConfig.System.FileContextBudget)
+	assertions.Equal("gpt-4-session", bot.role.Model)
+	assertions.Equal(file_model, config.MyConfig.Roles[role.Name].Model)
+}
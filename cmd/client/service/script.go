@@ -0,0 +1,293 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+
+	"github.com/robinmin/xally/config"
+	"github.com/robinmin/xally/shared/utility"
+)
+
+const script_file_ext = ".star"
+
+// upper bound of the computation steps of a single script run, the API calls are not counted
+const script_max_steps = 100000000
+
+// ScriptPlugin runs a Starlark script as a command. Scripts only see the
+// builtins below; there is no load(), no file system and no network access
+// except through them.
+type ScriptPlugin struct {
+	path string
+	meta PluginMeta
+	bot  *ChatBot
+}
+
+// LoadScriptPlugins wraps every .star file in the folder as a plugin, the
+// docstring of the script is used as its description
+func LoadScriptPlugins(dir string, bot *ChatBot) []Plugin {
+	plugins := []Plugin{}
+	if len(dir) == 0 {
+		return plugins
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Error("Failed to read the script folder : ", err)
+		}
+		return plugins
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != script_file_ext {
+			continue
+		}
+
+		plugin := &ScriptPlugin{
+			path: filepath.Join(dir, entry.Name()),
+			bot:  bot,
+		}
+		if err := plugin.describe(); err != nil {
+			log.Errorf("Failed to load script %s : %s", plugin.path, err.Error())
+			continue
+		}
+		plugins = append(plugins, plugin)
+	}
+	return plugins
+}
+
+func (plugin *ScriptPlugin) GetMeta() *PluginMeta {
+	return &plugin.meta
+}
+
+func (*ScriptPlugin) Open() error {
+	return nil
+}
+
+func (*ScriptPlugin) Close() error {
+	return nil
+}
+
+func (plugin *ScriptPlugin) Execute(original_msg string, arr_cmd []string) (*PluginResult, error) {
+	log.Debugf("Execute script [%s] on : %s", plugin.meta.Name, original_msg)
+
+	args := make(starlark.Tuple, 0, len(arr_cmd)-1)
+	for _, arg := range arr_cmd[1:] {
+		args = append(args, starlark.String(arg))
+	}
+
+	predeclared := plugin.builtins()
+	predeclared["args"] = args
+	predeclared["message"] = starlark.String(strings.TrimSpace(original_msg[len(arr_cmd[0]):]))
+
+	thread := &starlark.Thread{
+		Name: plugin.meta.Name,
+		Print: func(_ *starlark.Thread, msg string) {
+			plugin.bot.Say(msg, true)
+		},
+	}
+	thread.SetMaxExecutionSteps(script_max_steps)
+
+	if _, err := starlark.ExecFile(thread, plugin.path, nil, predeclared); err != nil {
+		var eval_err *starlark.EvalError
+		if errors.As(err, &eval_err) {
+			log.Error(eval_err.Backtrace())
+		}
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (plugin *ScriptPlugin) describe() error {
+	file, err := syntax.Parse(plugin.path, nil, 0)
+	if err != nil {
+		return err
+	}
+
+	plugin.meta = PluginMeta{
+		Name: strings.TrimSuffix(filepath.Base(plugin.path), script_file_ext),
+		Args: []PluginArg{{Name: "args", Optional: true, Repeated: true}},
+	}
+	if strings.ContainsAny(plugin.meta.Name, " \t\r\n") {
+		return fmt.Errorf("invalid script name : %s", plugin.meta.Name)
+	}
+
+	// the leading string literal works as the docstring
+	if len(file.Stmts) > 0 {
+		if stmt, ok := file.Stmts[0].(*syntax.ExprStmt); ok {
+			if literal, ok := stmt.X.(*syntax.Literal); ok && literal.Token == syntax.STRING {
+				doc := strings.TrimSpace(literal.Value.(string))
+				plugin.meta.Description = strings.SplitN(doc, "\n", 2)[0]
+			}
+		}
+	}
+	return nil
+}
+
+func (plugin *ScriptPlugin) builtins() starlark.StringDict {
+	return starlark.StringDict{
+		"ask":         starlark.NewBuiltin("ask", plugin.builtinAsk),
+		"read_file":   starlark.NewBuiltin("read_file", plugin.builtinReadFile),
+		"fetch_url":   starlark.NewBuiltin("fetch_url", plugin.builtinFetchURL),
+		"say":         starlark.NewBuiltin("say", plugin.builtinSay),
+		"save":        starlark.NewBuiltin("save", plugin.builtinSave),
+		"last_answer": starlark.NewBuiltin("last_answer", plugin.builtinLastAnswer),
+	}
+}
+
+// ask(prompt, role=None) asks within the current conversation, or on behalf of another role in a one-off conversation
+func (plugin *ScriptPlugin) builtinAsk(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var question, role string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "prompt", &question, "role?", &role); err != nil {
+		return nil, err
+	}
+
+	var answer string
+	var err error
+	if len(role) == 0 || role == plugin.bot.role.Name {
+		answer, err = plugin.bot.askForAnswer(question)
+	} else {
+		answer, err = plugin.bot.AskAs(role, question)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", fn.Name(), err.Error())
+	}
+	return starlark.String(answer), nil
+}
+
+// read_file(path) returns the content of a text file under the working directory, the scripts folder or the chat history folder
+func (plugin *ScriptPlugin) builtinReadFile(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var file_name string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "path", &file_name); err != nil {
+		return nil, err
+	}
+	if !plugin.readable(file_name) {
+		return nil, fmt.Errorf("%s: %s is outside of the working directory, the scripts folder and the chat history folder", fn.Name(), file_name)
+	}
+
+	file_plugin, ok := plugin.bot.plugin_mgr.GetPlugin(PLUGIN_NAME_FILE_CONTENT).(*FilePlugin)
+	if !ok {
+		return nil, fmt.Errorf("%s: file plugin is not available", fn.Name())
+	}
+	data, err := file_plugin.readFile(file_name)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", fn.Name(), err.Error())
+	}
+	if utility.IsBinaryContent(data) {
+		return nil, fmt.Errorf("%s: %s is not a text file", fn.Name(), file_name)
+	}
+	return starlark.String(data), nil
+}
+
+// readable tells if the file is under one of the folders the scripts may read, after following the symlinks
+func (plugin *ScriptPlugin) readable(file_name string) bool {
+	real_name, err := realPath(file_name)
+	if err != nil {
+		// let the reading report the missing file
+		return os.IsNotExist(err)
+	}
+
+	dirs := []string{".", filepath.Dir(plugin.path), config.MyConfig.System.ChatHistoryPath}
+	for _, dir := range dirs {
+		if len(dir) == 0 {
+			continue
+		}
+		real_dir, err := realPath(dir)
+		if err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(real_dir, real_name); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+func realPath(file_name string) (string, error) {
+	abs_name, err := filepath.Abs(file_name)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(abs_name)
+}
+
+// fetch_url(url, raw=False) returns the main content of the web page in Markdown
+func (plugin *ScriptPlugin) builtinFetchURL(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var url_str string
+	var raw bool
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "url", &url_str, "raw?", &raw); err != nil {
+		return nil, err
+	}
+	if !utility.IsValidURL(url_str) {
+		return nil, fmt.Errorf("%s: invalid URL %s", fn.Name(), url_str)
+	}
+
+	web_plugin, ok := plugin.bot.plugin_mgr.GetPlugin(PLUGIN_NAME_WEB_CONTENT).(*WebSummaryPlugin)
+	if !ok {
+		return nil, fmt.Errorf("%s: web plugin is not available", fn.Name())
+	}
+	content, err := web_plugin.loadMarkdown(url_str, raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", fn.Name(), err.Error())
+	}
+	return starlark.String(content), nil
+}
+
+// say(*values) shows the message to the user and keeps it in the chat history
+func (plugin *ScriptPlugin) builtinSay(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if len(kwargs) > 0 {
+		return nil, fmt.Errorf("%s: unexpected keyword arguments", fn.Name())
+	}
+
+	parts := make([]string, 0, len(args))
+	for _, arg := range args {
+		if str, ok := starlark.AsString(arg); ok {
+			parts = append(parts, str)
+		} else {
+			parts = append(parts, arg.String())
+		}
+	}
+	plugin.bot.Say(strings.Join(parts, " "), true)
+	return starlark.None, nil
+}
+
+// save(name, content) writes the content into the outputs folder under the chat history path and returns the full path
+func (plugin *ScriptPlugin) builtinSave(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name, content string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "name", &name, "content", &content); err != nil {
+		return nil, err
+	}
+
+	// never escape from the output folder
+	name = filepath.Base(name)
+	if name == "." || name == ".." || name == string(filepath.Separator) {
+		return nil, fmt.Errorf("%s: invalid file name", fn.Name())
+	}
+
+	dir := filepath.Join(config.MyConfig.System.ChatHistoryPath, "outputs")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("%s: %s", fn.Name(), err.Error())
+	}
+	file_name := filepath.Join(dir, name)
+	if err := os.WriteFile(file_name, []byte(content), 0644); err != nil {
+		return nil, fmt.Errorf("%s: %s", fn.Name(), err.Error())
+	}
+	return starlark.String(file_name), nil
+}
+
+// last_answer() returns the latest answer in the current conversation
+func (plugin *ScriptPlugin) builtinLastAnswer(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs); err != nil {
+		return nil, err
+	}
+	return starlark.String(plugin.bot.last_answer), nil
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/robinmin/xally/config"
+)
+
+const sample_script = `"""Bundle the given files into the outputs folder.
+
+Usage: bundle <file>...
+"""
+contents = [read_file(name) for name in args]
+saved = save("bundle.md", "\n".join(contents))
+say("saved", len(contents), "file(s)")
+`
+
+func TestScriptPlugin(t *testing.T) {
+	assertions := require.New(t)
+	config.UseTestConfig(t)
+
+	dir := t.TempDir()
+	assertions.NoError(os.WriteFile(filepath.Join(dir, "bundle.star"), []byte(sample_script), 0644))
+	assertions.NoError(os.WriteFile(filepath.Join(dir, "broken.star"), []byte("def ("), 0644))
+	assertions.NoError(os.WriteFile(filepath.Join(dir, "a.txt"), []byte("alpha"), 0644))
+	assertions.NoError(os.WriteFile(filepath.Join(dir, "b.txt"), []byte("beta"), 0644))
+
+	bot := &ChatBot{plugin_mgr: NewPluginManager(nil)}
+	plugins := LoadScriptPlugins(dir, bot)
+	assertions.Len(plugins, 1)
+	assertions.Equal("bundle", plugins[0].GetMeta().Name)
+	assertions.Equal("Bundle the given files into the outputs folder.", plugins[0].GetMeta().Description)
+	assertions.NoError(bot.plugin_mgr.AddPlugin(plugins[0]))
+
+	a_txt, b_txt := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+	processed, _, err := bot.plugin_mgr.Execute("bundle "+a_txt+" "+b_txt, []string{"bundle", a_txt, b_txt})
+	assertions.True(processed)
+	assertions.NoError(err)
+
+	data, err := os.ReadFile(filepath.Join(config.MyConfig.System.ChatHistoryPath, "outputs", "bundle.md"))
+	assertions.NoError(err)
+	assertions.Equal("alpha\nbeta", string(data))
+
+	_, _, err = bot.plugin_mgr.Execute("bundle missing.txt", []string{"bundle", "missing.txt"})
+	assertions.Error(err)
+
+	// nothing outside of the working directory, the scripts folder and the chat history folder
+	outside := filepath.Join(t.TempDir(), "secret.txt")
+	assertions.NoError(os.WriteFile(outside, []byte("secret"), 0644))
+	_, _, err = bot.plugin_mgr.Execute("bundle "+outside, []string{"bundle", outside})
+	assertions.ErrorContains(err, "outside")
+	link := filepath.Join(dir, "link.txt")
+	assertions.NoError(os.Symlink(outside, link))
+	_, _, err = bot.plugin_mgr.Execute("bundle "+link, []string{"bundle", link})
+	assertions.ErrorContains(err, "outside")
+
+	saved := filepath.Join(config.MyConfig.System.ChatHistoryPath, "outputs", "bundle.md")
+	_, _, err = bot.plugin_mgr.Execute("bundle "+saved, []string{"bundle", saved})
+	assertions.NoError(err)
+}
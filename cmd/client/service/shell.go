@@ -0,0 +1,161 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/robinmin/xally/config"
+	"github.com/robinmin/xally/shared/clientdb"
+)
+
+const PLUGIN_NAME_SHELL = "shell"
+
+// ShellSuggestion is the answer expected from the model for the shell command
+type ShellSuggestion struct {
+	Command     string `json:"command"`
+	Explanation string `json:"explanation"`
+}
+
+// acceptShell takes the requests for a command, the questions about the shell like
+// "shell vs terminal?" are asked instead
+func acceptShell(arr_cmd []string) bool {
+	return !strings.HasSuffix(arr_cmd[len(arr_cmd)-1], "?")
+}
+
+func (bot *ChatBot) cmdShell(original_msg string, arr_cmd []string) (*PluginResult, error) {
+	log.Debug("Execute [shell] command on : ", original_msg)
+
+	request := strings.TrimSpace(original_msg[len(arr_cmd[0]):])
+	if len(request) == 0 {
+		return &PluginResult{Output: config.Text("tips_shell_usage")}, nil
+	}
+
+	shell_name, shell_args := localShell()
+	role := &config.SysRole{
+		Name:        bot.role.Name,
+		Model:       bot.role.Model,
+		Temperature: 0,
+		Prompt:      fmt.Sprintf(config.Text("prompt_shell_command"), runtime.GOOS, filepath.Base(shell_name)),
+	}
+	answer, _, err := bot.askOneShot(role, request)
+	if err != nil {
+		return nil, err
+	}
+	suggestion, err := parseShellSuggestion(answer)
+	if err != nil {
+		return nil, err
+	}
+
+	record := &clientdb.ShellHistory{
+		Request:     request,
+		Command:     suggestion.Command,
+		Explanation: suggestion.Explanation,
+		Action:      clientdb.SHELL_ACTION_CANCEL,
+	}
+	defer bot.clientdb.AddShellHistory(record)
+
+	command := suggestion.Command
+	bot.Say("```shell\n"+command+"\n```\n"+suggestion.Explanation, true)
+	for confirmed := false; !confirmed; {
+		switch strings.ToLower(bot.getConsole().ReadLine(config.Text("tips_shell_choice")+" [r/e/C] ", "")) {
+		case "r", "run":
+			confirmed = true
+		case "e", "edit":
+			edited := strings.TrimSpace(bot.getConsole().ReadLine("$ ", command))
+			if len(edited) > 0 && edited != command {
+				command = edited
+				record.Command = command
+				record.Edited = true
+			}
+		default:
+			return &PluginResult{Output: config.Text("tips_shell_cancelled")}, nil
+		}
+	}
+
+	if pattern := matchDenylist(command, config.MyConfig.System.ShellDenylist); len(pattern) > 0 {
+		record.Dangerous = true
+		if !bot.confirm(fmt.Sprintf(config.Text("tips_shell_dangerous"), pattern)) {
+			return &PluginResult{Output: config.Text("tips_shell_cancelled")}, nil
+		}
+	}
+
+	record.Action = clientdb.SHELL_ACTION_RUN
+	output := &limitedBuffer{limit: config.MyConfig.System.CmdOutputLimit}
+	err = runLocalCommand(bot.getConsole(), shell_name, append(shell_args, command), output)
+	record.Output = output.String()
+
+	var exit_err *exec.ExitError
+	if errors.As(err, &exit_err) {
+		record.ExitCode = exit_err.ExitCode()
+		return &PluginResult{Output: fmt.Sprintf(config.Text("tips_cmd_exit_code"), record.ExitCode)}, nil
+	} else if err != nil {
+		record.ExitCode = -1
+		return nil, err
+	}
+	return nil, nil
+}
+
+// runLocalCommand runs the command on the terminal of the console. The output is
+// also kept in capture if it is given.
+func runLocalCommand(console Console, name string, args []string, capture io.Writer) error {
+	stdin, stdout, stderr := console.Terminal()
+	obj_cmd := exec.Command(name, args...)
+	obj_cmd.Stdin = stdin
+	if capture != nil {
+		obj_cmd.Stdout = io.MultiWriter(stdout, capture)
+		obj_cmd.Stderr = io.MultiWriter(stderr, capture)
+	} else {
+		obj_cmd.Stdout = stdout
+		obj_cmd.Stderr = stderr
+	}
+	return obj_cmd.Run()
+}
+
+// localShell returns the shell of the current user and the arguments to run a command line with it
+func localShell() (string, []string) {
+	if runtime.GOOS == "windows" {
+		if comspec := os.Getenv("COMSPEC"); len(comspec) > 0 {
+			return comspec, []string{"/C"}
+		}
+		return "cmd.exe", []string{"/C"}
+	}
+	if shell := os.Getenv("SHELL"); len(shell) > 0 {
+		return shell, []string{"-c"}
+	}
+	return "/bin/sh", []string{"-c"}
+}
+
+func parseShellSuggestion(answer string) (*ShellSuggestion, error) {
+	suggestion := &ShellSuggestion{}
+	if err := json.Unmarshal([]byte(stripCodeFence(answer)), suggestion); err != nil || len(strings.TrimSpace(suggestion.Command)) == 0 {
+		log.Error("Invalid shell suggestion : ", answer)
+		return nil, errors.New(config.Text("tips_shell_invalid_answer"))
+	}
+	suggestion.Command = strings.TrimSpace(suggestion.Command)
+	return suggestion, nil
+}
+
+// matchDenylist returns the first pattern found in the command as whole words
+func matchDenylist(command string, denylist []string) string {
+	for _, pattern := range denylist {
+		pattern = strings.TrimSpace(pattern)
+		if len(pattern) == 0 {
+			continue
+		}
+		rx := regexp.MustCompile(`(^|[\s;&|(` + "`" + `])` + regexp.QuoteMeta(pattern) + `($|[\s;&|)*.` + "`" + `])`)
+		if rx.MatchString(command) {
+			return pattern
+		}
+	}
+	return ""
+}
@@ -0,0 +1,31 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchDenylist(t *testing.T) {
+	assertions := require.New(t)
+
+	denylist := []string{"rm -rf /", "mkfs", "dd"}
+	assertions.Equal("rm -rf /", matchDenylist("sudo rm -rf /", denylist))
+	assertions.Equal("rm -rf /", matchDenylist("rm -rf /*", denylist))
+	assertions.Equal("mkfs", matchDenylist("mkfs.ext4 /dev/sdb1", denylist))
+	assertions.Equal("dd", matchDenylist("cat x | dd of=/dev/sda", denylist))
+	assertions.Empty(matchDenylist("rm -rf /tmp/build", denylist))
+	assertions.Empty(matchDenylist("git add . && git commit", denylist))
+}
+
+func TestParseShellSuggestion(t *testing.T) {
+	assertions := require.New(t)
+
+	suggestion, err := parseShellSuggestion("```json\n{\"command\": \" ls -la \", \"explanation\": \"list files\"}\n```")
+	assertions.NoError(err)
+	assertions.Equal("ls -la", suggestion.Command)
+	assertions.Equal("list files", suggestion.Explanation)
+
+	_, err = parseShellSuggestion("just run ls")
+	assertions.Error(err)
+}
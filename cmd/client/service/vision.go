@@ -0,0 +1,298 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/robinmin/xally/config"
+)
+
+const PLUGIN_NAME_IMAGE = "image"
+
+// largest image accepted by the API, the larger ones are encoded again as JPEG
+const IMAGE_BYTES_LIMIT = 20 * 1024 * 1024
+
+// folder under the chat history path keeping the images of the conversations
+const HISTORY_IMAGE_FOLDER = "images"
+
+var rx_image_ref = regexp.MustCompile(`@image:(\S+)`)
+var rx_image_name = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// imageAttachment is a local image attached to a question
+type imageAttachment struct {
+	path string
+	// original content, copied into the history folder
+	data []byte
+	// as sent to the API, maybe scaled down
+	data_url string
+	width    int
+	height   int
+	tokens   int
+}
+
+// cmdImage runs `image <path...> -- <question>`, asking about the local images
+func (bot *ChatBot) cmdImage(original_msg string, arr_cmd []string) (*PluginResult, error) {
+	log.Debug("Execute [image] command on : ", original_msg)
+
+	paths, question := splitQuestion(original_msg, arr_cmd[1:])
+	if len(paths) == 0 || len(question) == 0 {
+		return &PluginResult{Output: config.Text("tips_image_usage")}, nil
+	}
+	if err := bot.attachImages(paths); err != nil {
+		return &PluginResult{Output: err.Error()}, err
+	}
+	return &PluginResult{Question: question}, nil
+}
+
+// acceptImage takes `image` alone, the paths followed by `-- <question>`, or an existing
+// file first, e.g. "image of a cat" is a question
+func acceptImage(arr_cmd []string) bool {
+	if len(arr_cmd) == 1 {
+		return true
+	}
+	paths := arr_cmd[1:]
+	for idx, field := range paths {
+		if field == "--" {
+			return idx > 0
+		}
+	}
+	_, err := os.Stat(paths[0])
+	return err == nil
+}
+
+// splitQuestion splits `<args...> -- <question>` at the first `--`, keeping the spaces of the
+// question and any `--` inside it
+func splitQuestion(original_msg string, fields []string) ([]string, string) {
+	for idx := 0; idx < len(fields); idx++ {
+		if fields[idx] == "--" {
+			var question string
+			if pos := strings.Index(original_msg, " -- "); pos >= 0 {
+				question = strings.TrimSpace(original_msg[pos+4:])
+			}
+			return fields[:idx], question
+		}
+	}
+	return fields, ""
+}
+
+// attachImageRefs attaches the images referred by @image:path in the question, and
+// takes the references out of it
+func (bot *ChatBot) attachImageRefs(question string) (string, error) {
+	refs := rx_image_ref.FindAllStringSubmatch(question, -1)
+	if len(refs) == 0 {
+		return question, nil
+	}
+	paths := []string{}
+	for _, ref := range refs {
+		paths = append(paths, ref[1])
+	}
+	if err := bot.attachImages(paths); err != nil {
+		return question, err
+	}
+	return strings.Join(strings.Fields(rx_image_ref.ReplaceAllString(question, "")), " "), nil
+}
+
+// attachImages loads the images for the next question
+func (bot *ChatBot) attachImages(paths []string) error {
+	if !SupportsImages(bot.role.Model) {
+		return fmt.Errorf(config.Text("tips_image_model_unsupported"), requestModel(bot.role.Model))
+	}
+
+	images := []*imageAttachment{}
+	for _, path := range paths {
+		img, err := loadImage(path, config.MyConfig.System.ImageMaxSize)
+		if err != nil {
+			return err
+		}
+		images = append(images, img)
+	}
+	bot.pending_images = append(bot.pending_images, images...)
+	return nil
+}
+
+// addImageQuestion adds the question with the images into the conversation, and links
+// the copies of the images in the Markdown history
+func (bot *ChatBot) addImageQuestion(question string, images []*imageAttachment) {
+	image_urls := []string{}
+	for _, img := range images {
+		image_urls = append(image_urls, img.data_url)
+	}
+	bot.client.AddMsgHistoryWithImages("user", question, image_urls)
+
+	if !bot.log_history || bot.chat_history_file == nil {
+		return
+	}
+	var sb strings.Builder
+	sb.WriteString("#### " + default_user_avatar + "  " + question + "\n")
+	for _, img := range images {
+		link, err := saveHistoryImage(bot.chat_history_path, img)
+		if err != nil {
+			log.Error("Failed to copy the image into the history folder : ", err)
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("![%s](%s)\n", filepath.Base(img.path), link))
+	}
+	bot.dumpChatHistory(sb.String())
+}
+
+// loadImage reads the image, scaled down to fit in max_size pixels if larger
+func loadImage(path string, max_size int) (*imageAttachment, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf(config.Text("tips_image_unsupported"), path)
+	}
+
+	img := &imageAttachment{path: path, data: data, width: cfg.Width, height: cfg.Height}
+	content := data
+	mime_type := "image/" + format
+	if (max_size > 0 && (cfg.Width > max_size || cfg.Height > max_size)) || len(data) > IMAGE_BYTES_LIMIT {
+		src, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf(config.Text("tips_image_unsupported"), path)
+		}
+		img.width, img.height = fitSize(cfg.Width, cfg.Height, max_size)
+		scaled := scaleImage(src, img.width, img.height)
+
+		var buf bytes.Buffer
+		if format == "png" && len(data) <= IMAGE_BYTES_LIMIT {
+			// keep the transparency
+			err = png.Encode(&buf, scaled)
+		} else {
+			mime_type = "image/jpeg"
+			err = jpeg.Encode(&buf, scaled, &jpeg.Options{Quality: 85})
+		}
+		if err != nil {
+			return nil, err
+		}
+		content = buf.Bytes()
+		log.Debug(fmt.Sprintf("Image %s scaled from %dx%d to %dx%d", path, cfg.Width, cfg.Height, img.width, img.height))
+	}
+
+	img.data_url = "data:" + mime_type + ";base64," + base64.StdEncoding.EncodeToString(content)
+	img.tokens = imageTokens(img.width, img.height)
+	return img, nil
+}
+
+// fitSize scales the size down to fit in max_size pixels, keeping the aspect ratio
+func fitSize(width int, height int, max_size int) (int, int) {
+	if max_size <= 0 || (width <= max_size && height <= max_size) {
+		return width, height
+	}
+	if width >= height {
+		return max_size, maxInt(1, height*max_size/width)
+	}
+	return maxInt(1, width*max_size/height), max_size
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// scaleImage scales the image down by averaging the source pixels under each target pixel
+func scaleImage(src image.Image, width int, height int) *image.RGBA {
+	bounds := src.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Src)
+
+	src_w, src_h := bounds.Dx(), bounds.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := y*src_h/height, maxInt((y+1)*src_h/height, y*src_h/height+1)
+		for x := 0; x < width; x++ {
+			x0, x1 := x*src_w/width, maxInt((x+1)*src_w/width, x*src_w/width+1)
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				offset := rgba.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					for c := 0; c < 4; c++ {
+						sum[c] += int(rgba.Pix[offset+c])
+					}
+					offset += 4
+				}
+			}
+			count := (x1 - x0) * (y1 - y0)
+			offset := dst.PixOffset(x, y)
+			for c := 0; c < 4; c++ {
+				dst.Pix[offset+c] = uint8(sum[c] / count)
+			}
+		}
+	}
+	return dst
+}
+
+// imageTokens estimates the tokens of an image in high detail. It is scaled to fit in
+// 2048x2048, then its shorter side to 768, and each 512px tile costs 170 tokens plus 85.
+func imageTokens(width int, height int) int {
+	if width <= 0 || height <= 0 {
+		return 0
+	}
+	w, h := fitSize(width, height, 2048)
+	if shorter := minInt(w, h); shorter > 768 {
+		w, h = w*768/shorter, h*768/shorter
+	}
+	tiles := ((w + 511) / 512) * ((h + 511) / 512)
+	return 85 + 170*tiles
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// imageURLTokens estimates the tokens of an image URL, by the size in the header of a data URL
+func imageURLTokens(url string) int {
+	// a 1024x1024 image for the remote ones
+	const default_tokens = 765
+
+	pos := strings.Index(url, ";base64,")
+	if !strings.HasPrefix(url, "data:") || pos < 0 {
+		return default_tokens
+	}
+	cfg, _, err := image.DecodeConfig(base64.NewDecoder(base64.StdEncoding, strings.NewReader(url[pos+8:])))
+	if err != nil {
+		return default_tokens
+	}
+	return imageTokens(cfg.Width, cfg.Height)
+}
+
+// saveHistoryImage copies the image into the history folder once, and returns its link
+// relative to the Markdown history
+func saveHistoryImage(history_path string, img *imageAttachment) (string, error) {
+	dir := filepath.Join(history_path, HISTORY_IMAGE_FOLDER)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(img.data)
+	name := hex.EncodeToString(sum[:])[:12] + "_" + rx_image_name.ReplaceAllString(filepath.Base(img.path), "-")
+	target := filepath.Join(dir, name)
+	if _, err := os.Stat(target); os.IsNotExist(err) {
+		if err = os.WriteFile(target, img.data, 0644); err != nil {
+			return "", err
+		}
+	}
+	return HISTORY_IMAGE_FOLDER + "/" + name, nil
+}
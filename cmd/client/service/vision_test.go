@@ -0,0 +1,99 @@
+package service
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writePNG(t *testing.T, path string, width int, height int) {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		img.Set(x, 0, color.RGBA{R: 255, A: 255})
+	}
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	defer file.Close()
+	require.NoError(t, png.Encode(file, img))
+}
+
+func TestImageTokens(t *testing.T) {
+	assertions := require.New(t)
+
+	assertions.Equal(765, imageTokens(1024, 1024))
+	// 2048x4096 -> 1024x2048 -> 768x1536, 2x3 tiles
+	assertions.Equal(1105, imageTokens(2048, 4096))
+	assertions.Equal(255, imageTokens(100, 100))
+
+	w, h := fitSize(3000, 1000, 1500)
+	assertions.Equal([]int{1500, 500}, []int{w, h})
+	w, h = fitSize(300, 100, 1500)
+	assertions.Equal([]int{300, 100}, []int{w, h})
+}
+
+func TestLoadImage(t *testing.T) {
+	assertions := require.New(t)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "wide shot.png")
+	writePNG(t, path, 3000, 1000)
+
+	img, err := loadImage(path, 1500)
+	assertions.NoError(err)
+	assertions.Equal(1500, img.width)
+	assertions.Equal(500, img.height)
+	assertions.True(strings.HasPrefix(img.data_url, "data:image/png;base64,"))
+	assertions.Equal(img.tokens, imageURLTokens(img.data_url))
+
+	// the images count toward the token budget of the message
+	client := &ChatGPTCLient{}
+	client.AddMsgHistoryWithImages("user", "what is it?", []string{img.data_url})
+	assertions.Equal("what is it?", messageText(&client.msg_history[0]))
+	assertions.Equal(len("what is it?")+img.tokens, messageLength(&client.msg_history[0]))
+
+	link, err := saveHistoryImage(dir, img)
+	assertions.NoError(err)
+	assertions.True(strings.HasPrefix(link, "images/"))
+	assertions.True(strings.HasSuffix(link, "_wide-shot.png"))
+	assertions.FileExists(filepath.Join(dir, link))
+
+	assertions.NoError(os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("hello"), 0644))
+	_, err = loadImage(filepath.Join(dir, "notes.txt"), 0)
+	assertions.ErrorContains(err, "notes.txt")
+}
+
+func TestSplitQuestion(t *testing.T) {
+	assertions := require.New(t)
+
+	msg := "image a.png b.png -- what  differs?"
+	paths, question := splitQuestion(msg, strings.Fields(msg)[1:])
+	assertions.Equal([]string{"a.png", "b.png"}, paths)
+	assertions.Equal("what  differs?", question)
+
+	msg = "image a.png -- what does `ls -- -a` do?"
+	paths, question = splitQuestion(msg, strings.Fields(msg)[1:])
+	assertions.Equal([]string{"a.png"}, paths)
+	assertions.Equal("what does `ls -- -a` do?", question)
+
+	paths, question = splitQuestion("image a.png", []string{"a.png"})
+	assertions.Equal([]string{"a.png"}, paths)
+	assertions.Empty(question)
+}
+
+func TestShortQuestionDropsImages(t *testing.T) {
+	assertions := require.New(t)
+
+	bot := &ChatBot{
+		connected:      true,
+		console:        &terminalConsole{},
+		pending_images: []*imageAttachment{{tokens: 85}},
+	}
+	bot.Ask("ok")
+	assertions.Empty(bot.pending_images)
+}
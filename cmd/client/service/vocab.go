@@ -0,0 +1,229 @@
+package service
+
+import (
+	"encoding/csv"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	strftime "github.com/itchyny/timefmt-go"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/robinmin/xally/config"
+	"github.com/robinmin/xally/shared/clientdb"
+)
+
+const PLUGIN_NAME_VOCAB = "vocab"
+
+// number of words listed or reviewed at one time by default
+const VOCAB_DEFAULT_LIMIT = 20
+
+// acceptVocab takes `vocab`, `vocab list|review [n]` and `vocab export [--anki] [file]` only
+func acceptVocab(arr_cmd []string) bool {
+	switch {
+	case len(arr_cmd) == 1:
+		return true
+	case arr_cmd[1] == "export":
+		return len(arr_cmd) <= 4
+	case arr_cmd[1] == "list" || arr_cmd[1] == "ls" || arr_cmd[1] == "review":
+		if len(arr_cmd) == 2 {
+			return true
+		}
+		num, err := strconv.Atoi(arr_cmd[2])
+		return len(arr_cmd) == 3 && err == nil && num > 0
+	}
+	return false
+}
+
+// cmdVocab handles `vocab list [n]`, `vocab review [n]` and `vocab export --anki [file]`
+func (bot *ChatBot) cmdVocab(original_msg string, arr_cmd []string) (*PluginResult, error) {
+	log.Debug("Execute [vocab] command on : ", original_msg)
+
+	args := arr_cmd[1:]
+	if bot.clientdb == nil || len(args) == 0 {
+		return &PluginResult{Output: config.Text("tips_vocab_usage")}, nil
+	}
+
+	limit := VOCAB_DEFAULT_LIMIT
+	if len(args) > 1 && args[0] != "export" {
+		if num, err := strconv.Atoi(args[1]); err == nil && num > 0 {
+			limit = num
+		}
+	}
+
+	switch args[0] {
+	case "list", "ls":
+		return bot.vocabList(limit)
+	case "review":
+		return bot.vocabReview(limit)
+	case "export":
+		file_name := ""
+		for _, arg := range args[1:] {
+			if arg == "--anki" {
+				continue
+			}
+			if strings.HasPrefix(arg, "--") || len(file_name) > 0 {
+				return &PluginResult{Output: config.Text("tips_vocab_usage")}, nil
+			}
+			file_name = arg
+		}
+		if len(file_name) == 0 {
+			file_name = filepath.Join(config.MyConfig.System.ChatHistoryPath, "outputs", "xally_vocab_anki.csv")
+		}
+		return bot.vocabExport(file_name)
+	default:
+		return &PluginResult{Output: config.Text("tips_vocab_usage")}, nil
+	}
+}
+
+func (bot *ChatBot) vocabList(limit int) (*PluginResult, error) {
+	entries, err := bot.clientdb.ListVocabEntries(limit)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return &PluginResult{Output: config.Text("tips_vocab_empty")}, nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString(config.Text("tips_vocab_list_header") + "\n|----|----|----|----|----|\n")
+	for _, entry := range entries {
+		sense := strings.TrimSpace(entry.Senses)
+		if pos := strings.Index(sense, "\n"); pos >= 0 {
+			sense = sense[:pos]
+		}
+		sb.WriteString(fmt.Sprintf(
+			"| %s | %s | %d | %s | %s |\n",
+			entry.Word,
+			entry.Language,
+			entry.Box,
+			strftime.Format(entry.DueAt, "%Y-%m-%d"),
+			strings.ReplaceAll(clientdb.TruncateStr(sense, 60), "|", "\\|"),
+		))
+	}
+	return &PluginResult{Output: sb.String()}, nil
+}
+
+// vocabReview quizzes the due words one by one, the remembered ones move to the next Leitner box
+func (bot *ChatBot) vocabReview(limit int) (*PluginResult, error) {
+	entries, err := bot.clientdb.DueVocabEntries(time.Now(), limit)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return &PluginResult{Output: config.Text("tips_vocab_review_none")}, nil
+	}
+
+	reviewed, remembered := 0, 0
+	for idx := range entries {
+		entry := &entries[idx]
+
+		question := fmt.Sprintf("### %s (%d/%d)", entry.Word, idx+1, len(entries))
+		if len(entry.Sentence) > 0 {
+			question = question + "\n\n> " + entry.Sentence
+		}
+		bot.Say(question, true)
+		if strings.ToLower(bot.getConsole().ReadLine(config.Text("tips_vocab_review_reveal"), "")) == "q" {
+			break
+		}
+
+		bot.Say(entry.Senses, true)
+		answer := strings.ToLower(bot.getConsole().ReadLine(config.Text("tips_vocab_review_remembered")+" [y/n/q] ", ""))
+		if answer == "q" {
+			break
+		}
+
+		ok := answer == "y" || answer == "yes"
+		entry.Review(ok, time.Now())
+		bot.clientdb.UpdateVocabEntry(entry)
+		reviewed++
+		if ok {
+			remembered++
+		}
+	}
+	return &PluginResult{Output: fmt.Sprintf(config.Text("tips_vocab_review_done"), reviewed, remembered)}, nil
+}
+
+func (bot *ChatBot) vocabExport(file_name string) (*PluginResult, error) {
+	entries, err := bot.clientdb.ListVocabEntries(0)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return &PluginResult{Output: config.Text("tips_vocab_empty")}, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file_name), 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.Create(file_name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if err := exportAnki(entries, file); err != nil {
+		return nil, err
+	}
+	return &PluginResult{Output: fmt.Sprintf(config.Text("tips_vocab_exported"), len(entries), file_name)}, nil
+}
+
+// exportAnki writes the entries as an Anki CSV of front, back and tags, with the
+// file headers telling Anki how to import it
+func exportAnki(entries []clientdb.VocabEntry, writer io.Writer) error {
+	if _, err := io.WriteString(writer, "#separator:comma\n#html:true\n#tags column:3\n"); err != nil {
+		return err
+	}
+
+	csv_writer := csv.NewWriter(writer)
+	for _, entry := range entries {
+		front := html.EscapeString(entry.Word)
+		if len(entry.Sentence) > 0 {
+			front = front + "<br><i>" + html.EscapeString(entry.Sentence) + "</i>"
+		}
+		back := strings.ReplaceAll(html.EscapeString(strings.TrimSpace(entry.Senses)), "\n", "<br>")
+
+		tags := "xally"
+		if len(entry.Language) > 0 {
+			tags = tags + " " + entry.Language
+		}
+		if err := csv_writer.Write([]string{front, back, tags}); err != nil {
+			return err
+		}
+	}
+	csv_writer.Flush()
+	return csv_writer.Error()
+}
+
+// detectLanguage guesses the language of the word looked up, kana for Japanese and Han for Chinese.
+// Han alone is written in both, so the kana of the sentence the word comes from decides then,
+// or the language it is looked up into for a Japanese speaker.
+func detectLanguage(word string, sentence string, target_lang string) string {
+	has_han := false
+	for _, r := range word {
+		switch {
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+			return "ja"
+		case unicode.Is(unicode.Han, r):
+			has_han = true
+		}
+	}
+	if !has_han {
+		return "en"
+	}
+	for _, r := range sentence {
+		if unicode.In(r, unicode.Hiragana, unicode.Katakana) {
+			return "ja"
+		}
+	}
+	if strings.HasPrefix(config.ParseLanguageTag(target_lang), "ja") {
+		return "ja"
+	}
+	return "zh"
+}
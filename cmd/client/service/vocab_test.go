@@ -0,0 +1,35 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/robinmin/xally/shared/clientdb"
+)
+
+func TestExportAnki(t *testing.T) {
+	assertions := require.New(t)
+
+	var sb strings.Builder
+	assertions.NoError(exportAnki([]clientdb.VocabEntry{
+		{Word: "猫", Language: "ja", Senses: "cat\nねこ", Sentence: "猫が好き"},
+		{Word: "a<b", Senses: "one, two"},
+	}, &sb))
+	assertions.Equal("#separator:comma\n#html:true\n#tags column:3\n"+
+		"猫<br><i>猫が好き</i>,cat<br>ねこ,xally ja\n"+
+		"a&lt;b,\"one, two\",xally\n", sb.String())
+}
+
+func TestDetectLanguage(t *testing.T) {
+	assertions := require.New(t)
+
+	assertions.Equal("ja", detectLanguage("食べる", "", "CN"))
+	assertions.Equal("zh", detectLanguage("学习", "", "CN"))
+	assertions.Equal("en", detectLanguage("learn", "", "CN"))
+	// Han only is decided by the sentence, then by the language looked up into
+	assertions.Equal("ja", detectLanguage("勉強", "毎日勉強します", "CN"))
+	assertions.Equal("ja", detectLanguage("勉強", "", "ja_JP.UTF-8"))
+	assertions.Equal("zh", detectLanguage("勉强", "我很勉强", "en_US"))
+}
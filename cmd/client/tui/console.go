@@ -0,0 +1,88 @@
+package tui
+
+import (
+	"io"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/robinmin/xally/cmd/client/service"
+)
+
+// messages sent from the chatbot into the interface
+type sayMsg struct {
+	text string
+	// output of the local commands, shown as it is
+	raw bool
+}
+
+type answerMsg struct {
+	avatar string
+	text   string
+}
+
+type usageMsg service.UsageStats
+
+// askMsg asks the user for a line, the answer goes back through reply
+type askMsg struct {
+	question string
+	initial  string
+	password bool
+	reply    chan string
+}
+
+// doneMsg tells the command is finished, with the status after it
+type doneMsg struct {
+	status *service.BotStatus
+}
+
+type quitMsg struct{}
+
+// tuiConsole lets the chatbot talk through the full screen interface. It is called from
+// the goroutines running the commands, and waits for the answers of the user.
+type tuiConsole struct {
+	program *tea.Program
+}
+
+func (c *tuiConsole) Say(msg string) {
+	c.program.Send(sayMsg{text: msg})
+}
+
+func (c *tuiConsole) Answer(avatar string, msg string) {
+	c.program.Send(answerMsg{avatar: avatar, text: msg})
+}
+
+func (c *tuiConsole) Usage(stats *service.UsageStats) {
+	c.program.Send(usageMsg(*stats))
+}
+
+func (c *tuiConsole) ReadLine(question string, initial string) string {
+	reply := make(chan string)
+	c.program.Send(askMsg{question: question, initial: initial, reply: reply})
+	return <-reply
+}
+
+func (c *tuiConsole) ReadPassword(question string) (string, error) {
+	reply := make(chan string)
+	c.program.Send(askMsg{question: question, password: true, reply: reply})
+	return <-reply, nil
+}
+
+// Terminal gives no stdin to the local commands, as the keyboard belongs to the interface
+func (c *tuiConsole) Terminal() (io.Reader, io.Writer, io.Writer) {
+	writer := &consoleWriter{program: c.program}
+	return nil, writer, writer
+}
+
+func (c *tuiConsole) Quit() {
+	c.program.Send(quitMsg{})
+}
+
+// consoleWriter streams the output of the local commands into the transcript
+type consoleWriter struct {
+	program *tea.Program
+}
+
+func (w *consoleWriter) Write(data []byte) (int, error) {
+	w.program.Send(sayMsg{text: string(data), raw: true})
+	return len(data), nil
+}
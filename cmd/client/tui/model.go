@@ -0,0 +1,505 @@
+package tui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/textarea"
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/glamour"
+	"github.com/charmbracelet/lipgloss"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/robinmin/xally/cmd/client/service"
+	"github.com/robinmin/xally/config"
+)
+
+const (
+	SIDEBAR_WIDTH     = 28
+	SIDEBAR_MIN_WIDTH = 80 // no sidebar on a narrower terminal
+	INPUT_HEIGHT      = 3
+)
+
+type entryKind int
+
+const (
+	entryUser entryKind = iota
+	entryAnswer
+	entryInfo
+	entryRaw
+)
+
+// entry is one block of the transcript, rendered once for the current width
+type entry struct {
+	kind     entryKind
+	avatar   string
+	text     string
+	rendered string
+}
+
+var (
+	styleUser     = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("12"))
+	styleAvatar   = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("10"))
+	styleHeader   = lipgloss.NewStyle().Bold(true).Underline(true)
+	styleSelected = lipgloss.NewStyle().Reverse(true)
+	styleStatus   = lipgloss.NewStyle().Foreground(lipgloss.Color("15")).Background(lipgloss.Color("237"))
+	styleBorder   = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).BorderForeground(lipgloss.Color("8"))
+	styleFocused  = styleBorder.Copy().BorderForeground(lipgloss.Color("12"))
+)
+
+type model struct {
+	bot *service.ChatBot
+
+	width    int
+	height   int
+	renderer *glamour.TermRenderer
+
+	transcript []entry
+	viewport   viewport.Model
+	input      textarea.Model
+	spinner    spinner.Model
+	status     *service.BotStatus
+	busy       bool
+
+	// the sidebar lists the roles and then the sessions
+	sidebar_focused bool
+	cursor          int
+	// the session shown in place of the transcript, Esc goes back
+	viewing string
+
+	// the question asked by a command, answered in the line above the input box
+	asking *askMsg
+	answer textinput.Model
+}
+
+func newModel(bot *service.ChatBot) *model {
+	input := textarea.New()
+	input.Placeholder = config.Text("tui_placeholder")
+	input.ShowLineNumbers = false
+	input.SetHeight(INPUT_HEIGHT)
+	input.KeyMap.InsertNewline = key.NewBinding(key.WithKeys("alt+enter", "ctrl+j"))
+	input.Focus()
+
+	return &model{
+		bot:      bot,
+		viewport: viewport.New(0, 0),
+		input:    input,
+		spinner:  spinner.New(spinner.WithSpinner(spinner.Dot)),
+		status:   bot.Status(),
+		busy:     true,
+	}
+}
+
+func (m *model) Init() tea.Cmd {
+	return tea.Batch(textarea.Blink, m.spinner.Tick, func() tea.Msg {
+		m.bot.Greet()
+		return doneMsg{status: m.bot.Status()}
+	})
+}
+
+func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.resize()
+		return m, nil
+
+	case tea.KeyMsg:
+		return m.handleKey(msg)
+
+	case tea.MouseMsg:
+		var cmd tea.Cmd
+		m.viewport, cmd = m.viewport.Update(msg)
+		return m, cmd
+
+	case sayMsg:
+		if msg.raw && len(m.transcript) > 0 && m.transcript[len(m.transcript)-1].kind == entryRaw {
+			last := &m.transcript[len(m.transcript)-1]
+			last.text += msg.text
+			last.rendered = ""
+		} else if msg.raw {
+			m.append(entry{kind: entryRaw, text: msg.text})
+		} else {
+			m.append(entry{kind: entryInfo, text: msg.text})
+		}
+		m.refresh()
+		return m, nil
+
+	case answerMsg:
+		m.append(entry{kind: entryAnswer, avatar: msg.avatar, text: msg.text})
+		m.refresh()
+		return m, nil
+
+	case usageMsg:
+		m.status.Usage = service.UsageStats(msg)
+		return m, nil
+
+	case askMsg:
+		m.asking = &msg
+		m.answer = textinput.New()
+		m.answer.Prompt = msg.question
+		if msg.password {
+			m.answer.EchoMode = textinput.EchoPassword
+		}
+		m.answer.SetValue(msg.initial)
+		m.answer.CursorEnd()
+		m.input.Blur()
+		m.resize()
+		return m, m.answer.Focus()
+
+	case doneMsg:
+		m.busy = false
+		m.status = msg.status
+		if m.cursor >= m.sidebarLen() {
+			m.cursor = 0
+		}
+		return m, nil
+
+	case quitMsg:
+		return m, tea.Quit
+
+	case spinner.TickMsg:
+		if !m.busy {
+			return m, nil
+		}
+		var cmd tea.Cmd
+		m.spinner, cmd = m.spinner.Update(msg)
+		return m, cmd
+	}
+
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
+func (m *model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if msg.String() == "ctrl+c" {
+		if m.asking != nil {
+			m.reply("")
+		}
+		return m, tea.Quit
+	}
+
+	if m.asking != nil {
+		switch msg.String() {
+		case "enter":
+			m.reply(m.answer.Value())
+			return m, nil
+		case "esc":
+			m.reply("")
+			return m, nil
+		}
+		var cmd tea.Cmd
+		m.answer, cmd = m.answer.Update(msg)
+		return m, cmd
+	}
+
+	switch msg.String() {
+	case "pgup", "pgdown":
+		var cmd tea.Cmd
+		m.viewport, cmd = m.viewport.Update(msg)
+		return m, cmd
+	case "esc":
+		if len(m.viewing) > 0 {
+			m.viewing = ""
+			m.refresh()
+		}
+		return m, nil
+	case "tab":
+		if m.hasSidebar() {
+			m.sidebar_focused = !m.sidebar_focused
+			if m.sidebar_focused {
+				m.input.Blur()
+				return m, nil
+			}
+			return m, m.input.Focus()
+		}
+		return m, nil
+	}
+
+	if m.sidebar_focused {
+		switch msg.String() {
+		case "up", "k":
+			if m.cursor > 0 {
+				m.cursor--
+			}
+		case "down", "j":
+			if m.cursor < m.sidebarLen()-1 {
+				m.cursor++
+			}
+		case "enter":
+			return m, m.selectItem()
+		}
+		return m, nil
+	}
+
+	if msg.String() == "enter" {
+		text := strings.TrimSpace(m.input.Value())
+		if len(text) == 0 || m.busy {
+			return m, nil
+		}
+		m.input.Reset()
+		return m, m.execute(text)
+	}
+
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
+// execute runs the input on the chatbot in the background, one at a time
+func (m *model) execute(text string) tea.Cmd {
+	m.append(entry{kind: entryUser, text: text})
+	m.viewing = ""
+	m.refresh()
+	m.busy = true
+	return tea.Batch(m.spinner.Tick, func() tea.Msg {
+		m.bot.Execute(text)
+		return doneMsg{status: m.bot.Status()}
+	})
+}
+
+// selectItem switches to the role, or shows the session under the cursor
+func (m *model) selectItem() tea.Cmd {
+	if m.cursor < len(m.status.Roles) {
+		if m.busy {
+			return nil
+		}
+		return m.execute("reset " + m.status.Roles[m.cursor])
+	}
+
+	idx := m.cursor - len(m.status.Roles)
+	if idx >= len(m.status.Sessions) {
+		return nil
+	}
+	content, err := os.ReadFile(m.status.Sessions[idx])
+	if err != nil {
+		log.Error("Failed to read the session: ", err)
+		return nil
+	}
+	m.viewing = m.status.Sessions[idx]
+	m.viewport.SetContent(m.render(entry{kind: entryInfo, text: string(content)}))
+	m.viewport.GotoTop()
+	return nil
+}
+
+// reply gives the answer to the command waiting for it
+func (m *model) reply(answer string) {
+	m.asking.reply <- answer
+	m.asking = nil
+	if !m.sidebar_focused {
+		m.input.Focus()
+	}
+	m.resize()
+}
+
+func (m *model) append(item entry) {
+	m.transcript = append(m.transcript, item)
+}
+
+func (m *model) hasSidebar() bool {
+	return m.width >= SIDEBAR_MIN_WIDTH
+}
+
+func (m *model) sidebarLen() int {
+	return len(m.status.Roles) + len(m.status.Sessions)
+}
+
+// mainWidth is the width of the transcript and the input box
+func (m *model) mainWidth() int {
+	if m.hasSidebar() {
+		return m.width - SIDEBAR_WIDTH
+	}
+	return m.width
+}
+
+// resize lays out the panes for the terminal size, and renders the transcript again for the new width
+func (m *model) resize() {
+	if m.width == 0 {
+		return
+	}
+	main_width := m.mainWidth()
+	m.input.SetWidth(main_width - 2)
+
+	// the input box with its border, the status bar and the question line
+	height := m.height - INPUT_HEIGHT - 2 - 1
+	if m.asking != nil {
+		height--
+		m.answer.Width = main_width - lipgloss.Width(m.asking.question) - 1
+	}
+	if height < 1 {
+		height = 1
+	}
+	m.viewport.Width = main_width
+	m.viewport.Height = height
+
+	renderer, err := glamour.NewTermRenderer(glamour.WithStandardStyle("dark"), glamour.WithWordWrap(main_width-2))
+	if err != nil {
+		log.Error("Failed to create the markdown renderer: ", err)
+	} else {
+		m.renderer = renderer
+	}
+	for idx := range m.transcript {
+		m.transcript[idx].rendered = ""
+	}
+	if len(m.viewing) == 0 {
+		m.refresh()
+	}
+}
+
+// refresh puts the transcript into the viewport, and follows the latest message
+func (m *model) refresh() {
+	if len(m.viewing) > 0 {
+		return
+	}
+	blocks := make([]string, 0, len(m.transcript))
+	for idx := range m.transcript {
+		if len(m.transcript[idx].rendered) == 0 {
+			m.transcript[idx].rendered = m.render(m.transcript[idx])
+		}
+		blocks = append(blocks, m.transcript[idx].rendered)
+	}
+	m.viewport.SetContent(strings.Join(blocks, "\n"))
+	m.viewport.GotoBottom()
+}
+
+func (m *model) render(item entry) string {
+	switch item.kind {
+	case entryUser:
+		return styleUser.Render("▶ ") + item.text + "\n"
+	case entryRaw:
+		return item.text
+	case entryAnswer:
+		return styleAvatar.Render(item.avatar+" ▶") + "\n" + m.markdown(item.text)
+	default:
+		return m.markdown(item.text)
+	}
+}
+
+func (m *model) markdown(text string) string {
+	if m.renderer == nil {
+		return text + "\n"
+	}
+	out, err := m.renderer.Render(text)
+	if err != nil {
+		return text + "\n"
+	}
+	return out
+}
+
+func (m *model) View() string {
+	if m.width == 0 {
+		return ""
+	}
+
+	panes := []string{m.viewport.View()}
+	if m.asking != nil {
+		panes = append(panes, m.answer.View())
+	}
+	box := styleBorder
+	if !m.sidebar_focused && m.asking == nil {
+		box = styleFocused
+	}
+	panes = append(panes, box.Render(m.input.View()))
+	body := lipgloss.JoinVertical(lipgloss.Left, panes...)
+
+	if m.hasSidebar() {
+		body = lipgloss.JoinHorizontal(lipgloss.Top, m.sidebarView(lipgloss.Height(body)), body)
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, body, m.statusView())
+}
+
+func (m *model) sidebarView(height int) string {
+	width := SIDEBAR_WIDTH - 2
+	lines := []string{styleHeader.Render(config.Text("tui_roles"))}
+	for idx, role_name := range m.status.Roles {
+		mark := "  "
+		if role_name == m.status.Role {
+			mark = "● "
+		}
+		lines = append(lines, m.sidebarItem(idx, mark+role_name, width))
+	}
+	lines = append(lines, "", styleHeader.Render(config.Text("tui_sessions")))
+	for idx, file_name := range m.status.Sessions {
+		lines = append(lines, m.sidebarItem(len(m.status.Roles)+idx, "  "+filepath.Base(file_name), width))
+	}
+
+	// keep the cursor in sight
+	if inner := height - 2; len(lines) > inner && inner > 0 {
+		from := m.cursor + 1 - inner/2
+		if len(m.status.Roles) <= m.cursor {
+			from += 2
+		}
+		if from > len(lines)-inner {
+			from = len(lines) - inner
+		}
+		if from < 0 {
+			from = 0
+		}
+		lines = lines[from : from+inner]
+	}
+
+	box := styleBorder
+	if m.sidebar_focused {
+		box = styleFocused
+	}
+	return box.Width(width).Height(height - 2).Render(strings.Join(lines, "\n"))
+}
+
+func (m *model) sidebarItem(idx int, text string, width int) string {
+	text = truncate(text, width)
+	if m.sidebar_focused && idx == m.cursor {
+		return styleSelected.Render(text)
+	}
+	return text
+}
+
+func (m *model) statusView() string {
+	usage := m.status.Usage
+	tokens := fmt.Sprintf("%s %d + %d = %d", config.Text("tui_tokens"), usage.Prompt, usage.Completion, usage.Total)
+	if usage.Cached {
+		tokens = config.Text("tips_answer_cached")
+	}
+	left := fmt.Sprintf(" %s │ %s %s │ %s │ %s │ %s %d ",
+		m.status.Mode,
+		m.status.Avatar,
+		m.status.Role,
+		m.status.Model,
+		tokens,
+		config.Text("tui_available"),
+		usage.Available,
+	)
+	if m.busy {
+		left += m.spinner.View() + " "
+	}
+
+	right := config.Text("tui_help")
+	if len(m.viewing) > 0 {
+		right = filepath.Base(m.viewing) + " │ " + config.Text("tui_session_back")
+	}
+	right += " "
+
+	gap := m.width - lipgloss.Width(left) - lipgloss.Width(right)
+	if gap < 1 {
+		return styleStatus.Render(truncate(left, m.width))
+	}
+	return styleStatus.Render(left + strings.Repeat(" ", gap) + right)
+}
+
+// truncate cuts the text down to the width of the terminal cells
+func truncate(text string, width int) string {
+	if lipgloss.Width(text) <= width {
+		return text
+	}
+	runes := []rune(text)
+	for len(runes) > 0 && lipgloss.Width(string(runes))+1 > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "…"
+}
@@ -0,0 +1,69 @@
+package tui
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/bubbles/textarea"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/require"
+
+	"github.com/robinmin/xally/cmd/client/service"
+)
+
+func TestModelLayout(t *testing.T) {
+	assertions := require.New(t)
+
+	m := &model{
+		viewport: viewport.New(0, 0),
+		input:    textarea.New(),
+		status: &service.BotStatus{
+			Role:     "expert",
+			Model:    "gpt-3.5-turbo",
+			Mode:     "🌐",
+			Roles:    []string{"expert", "writer"},
+			Sessions: []string{"/tmp/xally_20230501.md"},
+		},
+	}
+	m.input.SetHeight(INPUT_HEIGHT)
+	m.Update(tea.WindowSizeMsg{Width: 100, Height: 30})
+	assertions.True(m.hasSidebar())
+	assertions.Equal(100-SIDEBAR_WIDTH, m.viewport.Width)
+	assertions.Equal(30-INPUT_HEIGHT-2-1, m.viewport.Height)
+
+	// the output of a local command is kept in one block
+	m.Update(sayMsg{text: "line 1\n", raw: true})
+	m.Update(sayMsg{text: "line 2\n", raw: true})
+	m.Update(answerMsg{avatar: "🧑", text: "hello"})
+	assertions.Len(m.transcript, 2)
+	assertions.Equal("line 1\nline 2\n", m.transcript[0].text)
+
+	m.Update(usageMsg{Prompt: 10, Completion: 5, Total: 15})
+	view := m.View()
+	assertions.Equal(30, len(strings.Split(view, "\n")))
+	for _, text := range []string{"expert", "writer", "xally_20230501.md", "gpt-3.5-turbo", "10 + 5 = 15"} {
+		assertions.Contains(view, text)
+	}
+
+	// the question takes one line from the transcript, the answer goes back to the command
+	reply := make(chan string, 1)
+	m.Update(askMsg{question: "continue? ", initial: "y", reply: reply})
+	assertions.Equal(30-INPUT_HEIGHT-2-1-1, m.viewport.Height)
+	m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	assertions.Equal("y", <-reply)
+	assertions.Nil(m.asking)
+
+	// narrow terminals have no sidebar
+	m.Update(tea.WindowSizeMsg{Width: 60, Height: 20})
+	assertions.False(m.hasSidebar())
+	assertions.Equal(60, m.viewport.Width)
+}
+
+func TestTruncate(t *testing.T) {
+	assertions := require.New(t)
+
+	assertions.Equal("short", truncate("short", 10))
+	assertions.Equal("a long…", truncate("a long session name", 7))
+	assertions.Equal("角色…", truncate("角色列表", 6))
+}
@@ -0,0 +1,24 @@
+// Package tui is the full screen interface of `xally --tui`. It drives the same ChatBot as the
+// REPL, and only replaces the way it talks with the user.
+package tui
+
+import (
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/robinmin/xally/cmd/client/service"
+	"github.com/robinmin/xally/config"
+	"github.com/robinmin/xally/shared/utility"
+)
+
+// Run shows the full screen interface until the user quits
+func Run(bot *service.ChatBot) error {
+	program := tea.NewProgram(newModel(bot), tea.WithAltScreen(), tea.WithMouseCellMotion())
+	console := &tuiConsole{program: program}
+	bot.SetConsole(console)
+
+	// the secret store asks its passphrase inside the interface from now on
+	config.SecretPassphrase = utility.AskSecretKeyBy(console.ReadPassword)
+
+	_, err := program.Run()
+	return err
+}
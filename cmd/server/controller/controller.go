@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"strings"
 	"sync"
 	"time"
 
@@ -39,6 +40,7 @@ const (
 	ERR_DEACTIVIATE_FAILED
 	ERR_GENERATE_TOKEN_FAILED
 	ERR_UNKNOWN_FAILED
+	ERR_NO_FIXTURE
 )
 
 const EnableProxyLog = true
@@ -48,6 +50,8 @@ type APIHandler struct {
 	WhiteList *serverdb.WhiteList
 	// TokenService *token.Token
 	DB *gorm.DB
+	// answers the routes with the recorded fixtures instead of the targets if set
+	Replay *utility.ReplayTransport
 }
 
 // // NewAPIHandler 创建APIHandler实例
@@ -140,11 +144,15 @@ func (h *APIHandler) RegisterRoutes(router *gin.Engine, routes *[]config.ProxyRo
 
 func (h *APIHandler) reverseProxyHandler(target *url.URL, auth_token string, org_id string) gin.HandlerFunc {
 	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.Transport = &utility.RetryTransport{Base: utility.HTTPTransport, Policy: utility.DefaultRetryPolicy}
 	return func(ctx *gin.Context) {
 		if _, ok := ctx.Get("auth_user"); ok {
 			// 替换HTTP头
 			ctx.Request.Header.Set("Accept", "application/json; charset=utf-8")
-			ctx.Request.Header.Set("Content-Type", "application/json; charset=utf-8")
+			// keep the Content-Type of the uploads, e.g. multipart/form-data of the audio
+			if len(ctx.Request.Header.Get("Content-Type")) == 0 {
+				ctx.Request.Header.Set("Content-Type", "application/json; charset=utf-8")
+			}
 
 			ctx.Request.Header.Set("X-Forwarded-Host", ctx.Request.Header.Get("Host"))
 			ctx.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", auth_token))
@@ -155,6 +163,10 @@ func (h *APIHandler) reverseProxyHandler(target *url.URL, auth_token string, org
 			ctx.Request.Host = target.Host
 
 			log.Info("[X-Ally]" + ctx.Request.Method + " " + ctx.Request.RequestURI + "......>> ")
+			if h.Replay != nil {
+				h.serveReplay(ctx)
+				return
+			}
 			proxy.ServeHTTP(ctx.Writer, ctx.Request)
 			log.Info("[X-Ally]" + ctx.Request.Method + " " + ctx.Request.RequestURI + "<<...... ")
 		} else {
@@ -163,6 +175,34 @@ func (h *APIHandler) reverseProxyHandler(target *url.URL, auth_token string, org
 	}
 }
 
+// serveReplay answers with the fixture of the request, like a fake target
+func (h *APIHandler) serveReplay(ctx *gin.Context) {
+	resp, err := h.Replay.RoundTrip(ctx.Request)
+	if err != nil {
+		h.ResponseRaw(ctx, err.Error(), ERR_NO_FIXTURE, nil, http.StatusNotImplemented)
+		return
+	}
+	defer resp.Body.Close()
+
+	for name, values := range resp.Header {
+		for _, value := range values {
+			ctx.Writer.Header().Add(name, value)
+		}
+	}
+	ctx.Writer.WriteHeader(resp.StatusCode)
+	if _, err := io.Copy(ctx.Writer, resp.Body); err != nil {
+		log.Error("Failed to write the replayed response: ", err)
+	}
+}
+
+// loggedRequestBody keeps the uploaded files out of the proxy log
+func loggedRequestBody(content_type string, body []byte) string {
+	if strings.HasPrefix(content_type, "multipart/") {
+		return fmt.Sprintf("<%s, %d bytes>", content_type, len(body))
+	}
+	return string(body)
+}
+
 // 无法路由
 func (h *APIHandler) noRouteHandler() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
@@ -221,6 +261,10 @@ func (h *APIHandler) authMiddleware() gin.HandlerFunc {
 		reqBody, _ := io.ReadAll(ctx.Request.Body)
 		// And now set a new body, which will simulate the same data we read:
 		ctx.Request.Body = io.NopCloser(bytes.NewBuffer(reqBody))
+		// the proxy sends it again on retry
+		ctx.Request.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(reqBody)), nil
+		}
 
 		// 处理请求
 		blw := &bodyLogWriter{
@@ -296,7 +340,7 @@ func (h *APIHandler) authMiddleware() gin.HandlerFunc {
 				RequestMethod:  ctx.Request.Method,
 				RequestURL:     ctx.Request.URL.String(),
 				RequestHeaders: string(reqHeaders),
-				RequestBody:    string(reqBody),
+				RequestBody:    loggedRequestBody(ctx.Request.Header.Get("Content-Type"), reqBody),
 
 				ResponseStatusCode: blw.Status(),
 				ResponseHeaders:    string(rspHeaders),
@@ -29,6 +29,7 @@ var (
 	help        bool
 	config_file string
 	verbose     bool
+	replay_dir  string
 )
 
 func init() {
@@ -36,6 +37,7 @@ func init() {
 	flag.BoolVar(&help, "h", false, "show the help message")
 	flag.StringVar(&config_file, "f", "", "config file")
 	flag.BoolVar(&verbose, "v", false, "show detail information")
+	flag.StringVar(&replay_dir, "replay", "", "answer the routes with the fixtures recorded by xally -record, instead of the targets")
 
 	// change the default useage
 	flag.Usage = usage
@@ -43,7 +45,7 @@ func init() {
 
 func usage() {
 	fmt.Fprintf(os.Stderr, `xally_server version: xally_server/%s
-Usage: xally_server [-hv] [-f config_file]
+Usage: xally_server [-hv] [-f config_file] [-replay dir]
 
 Options:
 `, config.Version)
@@ -68,6 +70,15 @@ func main() {
 		fmt.Println(err)
 		return
 	}
+	err = utility.SetupNetwork(utility.NetworkSettings{
+		ProxyURL: config.SvrConfig.Server.ProxyURL,
+		NoProxy:  config.SvrConfig.Server.NoProxy,
+		CABundle: config.SvrConfig.Server.CABundle,
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
 
 	// initialize log files
 	logger := utility.NewLog("logs", config.ServerName, "debug")
@@ -97,6 +108,14 @@ func main() {
 		verbose,
 	)
 
+	if len(replay_dir) > 0 {
+		if api.Replay, err = utility.NewReplayTransport(utility.REPLAY_SERVE, replay_dir, nil); err != nil {
+			log.Error("Failed to load the fixtures: ", err)
+			return
+		}
+		log.Info("Answer the routes with the fixtures in ", replay_dir)
+	}
+
 	// 注册路由
 	api.RegisterRoutes(router, &config.SvrConfig.Server.Routes)
 	server := &http.Server{
@@ -24,6 +24,14 @@ type SysRole struct {
 	TopP        int     `yaml:"top_p,omitempty"`
 	Prompt      string  `yaml:"prompt,omitempty"`
 	Opening     string  `yaml:"opening,omitempty"`
+	// answers may come from the response cache, true if not set
+	Cacheable *bool `yaml:"cacheable,omitempty"`
+}
+
+// IsCacheable tells whether the answers of the role may come from the response cache,
+// creative roles turn it off to get a new answer each time
+func (role *SysRole) IsCacheable() bool {
+	return role.Cacheable == nil || *role.Cacheable
 }
 
 type SysSystem struct {
@@ -45,6 +53,51 @@ type SysSystem struct {
 	AppToken      string `yaml:"app_token,omitempty"`
 	Email         string `yaml:"email,omitempty"`
 
+	// estimated token budget for the bundled contents of file-* commands
+	FileContextBudget int `yaml:"file_context_budget,omitempty"`
+	// seconds to reuse the cached web pages before revalidating them
+	CacheTTL int64 `yaml:"cache_ttl,omitempty"`
+	// folder of the external executable plugins
+	PluginPath string `yaml:"plugin_path,omitempty"`
+	// seconds to wait for an external plugin before killing it
+	PluginTimeout int `yaml:"plugin_timeout,omitempty"`
+	// folder of the Starlark scripts
+	ScriptPath string `yaml:"script_path,omitempty"`
+	// max bytes of stdout and stderr each captured by cmd-ask
+	CmdOutputLimit int `yaml:"cmd_output_limit,omitempty"`
+	// shell commands asking for an extra confirmation before running
+	ShellDenylist []string `yaml:"shell_denylist,omitempty"`
+	// max distinct inputs of each role loaded into the input history
+	HistoryLimit int `yaml:"history_limit,omitempty"`
+	// translators tried in order, any of deepl, llm and dict
+	Translators []string `yaml:"translators,omitempty"`
+	// local dictionary CSV (word, meaning) for the dict translator
+	DictionaryPath string `yaml:"dictionary_path,omitempty"`
+	// global glossary CSV (source term, target term)
+	GlossaryPath string `yaml:"glossary_path,omitempty"`
+	// source language of the glossaries, required by DeepL to apply them
+	GlossarySourceLang string `yaml:"glossary_source_lang,omitempty"`
+	// proxy of the outbound requests, http://, https:// or socks5://, HTTP(S)_PROXY if empty
+	ProxyURL string `yaml:"proxy_url,omitempty"`
+	// hosts, domains, IPs or CIDRs going direct besides NO_PROXY
+	NoProxy []string `yaml:"no_proxy,omitempty"`
+	// PEM file of extra root certificates, e.g. of a TLS intercepting proxy
+	CABundle string `yaml:"ca_bundle,omitempty"`
+	// reuse the answers of the identical requests, off by default
+	ResponseCache bool `yaml:"response_cache,omitempty"`
+	// seconds to keep the cached answers
+	ResponseCacheTTL int64 `yaml:"response_cache_ttl,omitempty"`
+	// max cached answers, the least recently used ones go first
+	ResponseCacheLimit int `yaml:"response_cache_limit,omitempty"`
+	// longest side in pixels of the images sent to the vision models, the larger ones are scaled down
+	ImageMaxSize int `yaml:"image_max_size,omitempty"`
+	// model drawing the images of the imagine command
+	ImageModel string `yaml:"image_model,omitempty"`
+	// model of audio-transcribe and audio-translate
+	AudioModel string `yaml:"audio_model,omitempty"`
+	// max MB of each audio segment uploaded, the longer recordings are split
+	AudioSegmentSize int `yaml:"audio_segment_size,omitempty"`
+
 	DebugMode bool `yaml:"debug_mode,omitempty"`
 }
 
@@ -52,6 +105,12 @@ type SysConfig struct {
 	System SysSystem `yaml:"system"`
 
 	Roles map[string]SysRole `yaml:"roles"`
+
+	// sources merged into this configuration, see LoadLayers
+	Layers    []ConfigLayer `yaml:"-"`
+	user_file string
+	// names of the secrets referred by the settings, keyed by the setting
+	secret_refs map[string]string
 }
 
 var MyConfig *SysConfig
@@ -75,7 +134,26 @@ func NewSysConfig(cfg_file string) *SysConfig {
 			UseSharedMode: 0,
 			AppToken:      "",
 			Email:         "",
-			DebugMode:     false,
+
+			FileContextBudget:  3000,
+			CacheTTL:           3600,
+			PluginPath:         path.Join(path.Dir(cfg_file), "plugins"),
+			PluginTimeout:      30,
+			ScriptPath:         path.Join(path.Dir(cfg_file), "scripts"),
+			CmdOutputLimit:     8000,
+			ShellDenylist:      []string{"rm -rf /", "mkfs", "dd"},
+			HistoryLimit:       1000,
+			Translators:        []string{"deepl", "llm"},
+			DictionaryPath:     path.Join(path.Dir(cfg_file), "dictionary.csv"),
+			GlossaryPath:       path.Join(path.Dir(cfg_file), "glossary.csv"),
+			GlossarySourceLang: "EN",
+			ResponseCacheTTL:   7 * 24 * 3600,
+			ResponseCacheLimit: 1000,
+			ImageMaxSize:       2048,
+			ImageModel:         "dall-e-3",
+			AudioModel:         "whisper-1",
+			AudioSegmentSize:   24,
+			DebugMode:          false,
 		},
 		Roles: map[string]SysRole{
 			"expert": {
@@ -180,13 +258,23 @@ func (cfg *SysConfig) GetCurrentMode(connected bool) string {
 	return flags
 }
 
+// DumpIntoYAML writes the configuration with the secrets moved into the secret store
 func (cfg *SysConfig) DumpIntoYAML(cfg_file string) (string, error) {
-	yaml_data, err := yaml.Marshal(cfg)
+	shareable := *cfg
+	if err := shareable.stashSecrets(); err != nil {
+		return "", err
+	}
+
+	yaml_data, err := yaml.Marshal(&shareable)
 	if err != nil {
 		return "", err
 	}
 
-	if err = os.WriteFile(cfg_file, yaml_data, 0644); err != nil {
+	if err = os.WriteFile(cfg_file, yaml_data, 0600); err != nil {
+		return "", err
+	}
+	// files written by the former versions are 0644
+	if err = os.Chmod(cfg_file, 0600); err != nil {
 		return "", err
 	}
 	return string(yaml_data), nil
@@ -202,6 +290,7 @@ func (cfg *SysConfig) LoadFromYAML(cfg_file string) error {
 	if err = yaml.Unmarshal(data, cfg); err != nil {
 		return err
 	}
+	cfg.collectSecretRefs()
 	return nil
 }
 
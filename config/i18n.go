@@ -0,0 +1,279 @@
+package config
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed locales/*.yaml
+var embedded_locales embed.FS
+
+// the final fallback of all languages, also the reference of the missing keys check
+const DEFAULT_LANGUAGE = "en"
+
+var (
+	// message catalogs keyed by the normalized language tag, e.g. zh, en, zh-TW
+	catalogs      = map[string]map[string]string{}
+	catalog_mutex sync.RWMutex
+
+	peference_language string
+	// language tags tried in order by Text, e.g. zh-TW, zh, en
+	text_chain []string
+)
+
+func init() {
+	entries, err := embedded_locales.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	for _, entry := range entries {
+		data, err := embedded_locales.ReadFile("locales/" + entry.Name())
+		if err != nil {
+			panic(err)
+		}
+		if err = addCatalog(entry.Name(), data); err != nil {
+			panic(err)
+		}
+	}
+	SetupPeferenceLanguage("")
+}
+
+// LoadLocales loads the extra locale files (YAML or JSON) in the folder, named after
+// their language tags like fr.yaml or zh-TW.json. Keys in these files override the
+// embedded ones of the same language.
+func LoadLocales(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".yaml", ".yml", ".json":
+		default:
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+		if err = addCatalog(entry.Name(), data); err != nil {
+			return fmt.Errorf("%s : %w", entry.Name(), err)
+		}
+	}
+
+	// the chain may change with the new languages
+	SetupPeferenceLanguage(peference_language)
+	return nil
+}
+
+func addCatalog(file_name string, data []byte) error {
+	tag := ParseLanguageTag(strings.TrimSuffix(file_name, filepath.Ext(file_name)))
+	if len(tag) == 0 {
+		return fmt.Errorf("invalid language tag in file name")
+	}
+
+	messages := map[string]string{}
+	var err error
+	if strings.ToLower(filepath.Ext(file_name)) == ".json" {
+		err = json.Unmarshal(data, &messages)
+	} else {
+		err = yaml.Unmarshal(data, &messages)
+	}
+	if err != nil {
+		return err
+	}
+
+	catalog_mutex.Lock()
+	defer catalog_mutex.Unlock()
+	if catalog, ok := catalogs[tag]; ok {
+		for key, val := range messages {
+			catalog[key] = val
+		}
+	} else {
+		catalogs[tag] = messages
+	}
+	return nil
+}
+
+// SetupPeferenceLanguage accepts the language preference in any form of CN, JP, EN,
+// BCP-47 tags like zh-TW, or locales like ja_JP.UTF-8. The locale environment
+// variables are used if it is blank.
+func SetupPeferenceLanguage(language string) {
+	tag := ParseLanguageTag(language)
+	if len(tag) == 0 {
+		tag = ParseLanguageTag(DetectSystemLanguage())
+	}
+
+	catalog_mutex.Lock()
+	defer catalog_mutex.Unlock()
+	peference_language = language
+	text_chain = LanguageFallbacks(tag)
+}
+
+func Text(str_key string) string {
+	catalog_mutex.RLock()
+	defer catalog_mutex.RUnlock()
+
+	for _, tag := range text_chain {
+		if str_val, ok := catalogs[tag][str_key]; ok {
+			return str_val
+		}
+	}
+	return str_key
+}
+
+// GetAcceptLanguage returns the preferred language tag for HTTP requests
+func GetAcceptLanguage() string {
+	catalog_mutex.RLock()
+	defer catalog_mutex.RUnlock()
+
+	if len(text_chain) > 0 {
+		return text_chain[0]
+	}
+	return DEFAULT_LANGUAGE
+}
+
+// ParseLanguageTag normalizes the language preference into a BCP-47 tag, e.g.
+// zh_TW.UTF-8 into zh-TW, and CN / JP / EN into zh / ja / en. It returns blank
+// for the C locale and anything it can not parse.
+func ParseLanguageTag(value string) string {
+	value = strings.TrimSpace(value)
+	// POSIX locale : language[_territory][.codeset][@modifier]
+	if pos := strings.IndexAny(value, ".@"); pos >= 0 {
+		value = value[:pos]
+	}
+
+	switch strings.ToUpper(value) {
+	case "", "C", "POSIX":
+		return ""
+	case "CN":
+		return "zh"
+	case "JP":
+		return "ja"
+	case "EN":
+		return "en"
+	}
+
+	subtags := strings.FieldsFunc(value, func(r rune) bool { return r == '-' || r == '_' })
+	if len(subtags) == 0 || len(subtags[0]) < 2 || len(subtags[0]) > 3 || !isAlpha(subtags[0]) {
+		return ""
+	}
+
+	subtags[0] = strings.ToLower(subtags[0])
+	for idx := 1; idx < len(subtags); idx++ {
+		subtag := subtags[idx]
+		switch {
+		case len(subtag) == 4 && isAlpha(subtag):
+			// script, e.g. Hant
+			subtags[idx] = strings.ToUpper(subtag[:1]) + strings.ToLower(subtag[1:])
+		case len(subtag) == 2 && isAlpha(subtag), len(subtag) == 3 && !isAlpha(subtag):
+			// region, e.g. TW or 419
+			subtags[idx] = strings.ToUpper(subtag)
+		default:
+			subtags[idx] = strings.ToLower(subtag)
+		}
+	}
+	return strings.Join(subtags, "-")
+}
+
+// LanguageFallbacks returns the tag and its parents, ending with the default
+// language, e.g. zh-Hant-TW, zh-Hant, zh, en
+func LanguageFallbacks(tag string) []string {
+	chain := []string{}
+	for len(tag) > 0 {
+		chain = append(chain, tag)
+		if pos := strings.LastIndex(tag, "-"); pos >= 0 {
+			tag = tag[:pos]
+		} else {
+			tag = ""
+		}
+	}
+	if len(chain) == 0 || chain[len(chain)-1] != DEFAULT_LANGUAGE {
+		chain = append(chain, DEFAULT_LANGUAGE)
+	}
+	return chain
+}
+
+// DetectSystemLanguage returns the language from the locale environment variables
+// in the order of gettext
+func DetectSystemLanguage() string {
+	for _, name := range []string{"LANGUAGE", "LC_ALL", "LC_MESSAGES", "LANG"} {
+		value := os.Getenv(name)
+		if name == "LANGUAGE" {
+			// a colon separated list of languages
+			value = strings.Split(value, ":")[0]
+		}
+		if len(value) > 0 {
+			return value
+		}
+	}
+	return ""
+}
+
+// Languages returns the tags of all languages loaded
+func Languages() []string {
+	catalog_mutex.RLock()
+	defer catalog_mutex.RUnlock()
+
+	tags := []string{}
+	for tag := range catalogs {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// MissingKeys reports the keys of the default language missing in each of the
+// others. Keys found in the parent languages (e.g. zh for zh-TW) are not missing.
+func MissingKeys() map[string][]string {
+	catalog_mutex.RLock()
+	defer catalog_mutex.RUnlock()
+
+	missing := map[string][]string{}
+	for tag := range catalogs {
+		if tag == DEFAULT_LANGUAGE {
+			continue
+		}
+		fallbacks := LanguageFallbacks(tag)
+		fallbacks = fallbacks[:len(fallbacks)-1]
+
+		for key := range catalogs[DEFAULT_LANGUAGE] {
+			found := false
+			for _, parent := range fallbacks {
+				if _, found = catalogs[parent][key]; found {
+					break
+				}
+			}
+			if !found {
+				missing[tag] = append(missing[tag], key)
+			}
+		}
+		sort.Strings(missing[tag])
+	}
+	return missing
+}
+
+func isAlpha(str string) bool {
+	for _, r := range str {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,72 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/robinmin/xally/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLanguageTag(t *testing.T) {
+	assertions := require.New(t)
+
+	for value, tag := range map[string]string{
+		"CN":               "zh",
+		"JP":               "ja",
+		"EN":               "en",
+		"en_GB.UTF-8":      "en-GB",
+		"zh_TW":            "zh-TW",
+		"ZH-HANT-TW":       "zh-Hant-TW",
+		"es-419":           "es-419",
+		"de_DE.UTF-8@euro": "de-DE",
+		"C":                "",
+		"POSIX":            "",
+		"1234":             "",
+	} {
+		assertions.Equal(tag, config.ParseLanguageTag(value), value)
+	}
+
+	assertions.Equal([]string{"zh-Hant-TW", "zh-Hant", "zh", "en"}, config.LanguageFallbacks("zh-Hant-TW"))
+	assertions.Equal([]string{"en-GB", "en"}, config.LanguageFallbacks("en-GB"))
+	assertions.Equal([]string{"en"}, config.LanguageFallbacks(""))
+}
+
+func TestTextFallback(t *testing.T) {
+	assertions := require.New(t)
+	defer config.SetupPeferenceLanguage("")
+
+	config.SetupPeferenceLanguage("zh_TW.UTF-8")
+	assertions.Equal("zh-TW", config.GetAcceptLanguage())
+	assertions.Equal("好的，回头见！👋🏻", config.Text("byebye_msg"))
+
+	config.SetupPeferenceLanguage("en_GB.UTF-8")
+	assertions.Equal("Okay, see you later!👋🏻", config.Text("byebye_msg"))
+	assertions.Equal("no_such_key", config.Text("no_such_key"))
+
+	dir := t.TempDir()
+	assertions.NoError(os.WriteFile(filepath.Join(dir, "fr.yaml"), []byte("byebye_msg: \"D'accord, à plus tard !\"\n"), 0644))
+	assertions.NoError(os.WriteFile(filepath.Join(dir, "zh-TW.json"), []byte(`{"byebye_msg": "好的，回頭見！"}`), 0644))
+	assertions.NoError(config.LoadLocales(dir))
+
+	config.SetupPeferenceLanguage("fr_FR.UTF-8")
+	assertions.Equal("D'accord, à plus tard !", config.Text("byebye_msg"))
+	assertions.Equal("Exit", config.Text("tips_suggestion_quit"))
+	config.SetupPeferenceLanguage("zh-TW")
+	assertions.Equal("好的，回頭見！", config.Text("byebye_msg"))
+
+	missing := config.MissingKeys()
+	assertions.NotContains(missing, "zh-TW")
+	assertions.Contains(missing["fr"], "greeting_msg")
+}
+
+func TestLocaleCatalogs(t *testing.T) {
+	assertions := require.New(t)
+
+	assertions.Subset(config.Languages(), []string{"en", "ja", "zh"})
+	missing := config.MissingKeys()
+	for _, tag := range []string{"ja", "zh"} {
+		assertions.Empty(missing[tag], "missing keys in %s", tag)
+	}
+}
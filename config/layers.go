@@ -0,0 +1,241 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// system wide configuration shared by all users on the machine
+var SystemConfigFile = "/etc/xally/xally.yaml"
+
+// project configuration found by walking up from the current directory
+const PROJECT_CONFIG_FILE = ".xally.yaml"
+
+// prefix of the environment variables overriding the system settings, e.g. XALLY_DEFAULT_ROLE
+const ENV_PREFIX = "XALLY_"
+
+const (
+	LAYER_SYSTEM  = "system"
+	LAYER_USER    = "user"
+	LAYER_PROJECT = "project"
+	LAYER_ENV     = "env"
+)
+
+// ConfigLayer is one source merged into the effective configuration
+type ConfigLayer struct {
+	Name   string
+	Source string // file name, or the environment variables applied
+}
+
+// LoadLayers merges the system file, the user file, the project file and the
+// XALLY_* environment variables in order on top of the defaults. Problems found
+// in any layer are returned together, the valid parts are still applied.
+func (cfg *SysConfig) LoadLayers(user_file string) error {
+	cfg.user_file = user_file
+	cfg.Layers = []ConfigLayer{}
+
+	layers := []ConfigLayer{
+		{Name: LAYER_SYSTEM, Source: SystemConfigFile},
+		{Name: LAYER_USER, Source: user_file},
+	}
+	if project_file := FindProjectConfig(); len(project_file) > 0 && !sameFile(project_file, user_file) {
+		layers = append(layers, ConfigLayer{Name: LAYER_PROJECT, Source: project_file})
+	}
+
+	problems := []string{}
+	for _, layer := range layers {
+		data, err := os.ReadFile(layer.Source)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				problems = append(problems, err.Error())
+			}
+			continue
+		}
+
+		for _, cfg_err := range ValidateConfigData(layer.Source, data) {
+			problems = append(problems, cfg_err.Error())
+		}
+		if err = yaml.Unmarshal(data, cfg); err != nil {
+			problems = append(problems, layer.Source+": "+err.Error())
+		}
+		cfg.Layers = append(cfg.Layers, layer)
+	}
+
+	applied, env_problems := cfg.applyEnv(os.LookupEnv)
+	problems = append(problems, env_problems...)
+	if len(applied) > 0 {
+		cfg.Layers = append(cfg.Layers, ConfigLayer{Name: LAYER_ENV, Source: strings.Join(applied, ", ")})
+	}
+
+	problems = append(problems, cfg.resolveSecrets()...)
+
+	// update key from env var in case of blank
+	if cfg.System.OpenaiApiKey == "" {
+		cfg.System.OpenaiApiKey = os.Getenv("OPENAI_API_KEY")
+	}
+
+	for _, cfg_err := range cfg.Validate() {
+		problems = append(problems, cfg_err.Error())
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+// UserFile returns the file the user settings are written into
+func (cfg *SysConfig) UserFile() string {
+	return cfg.user_file
+}
+
+// FindProjectConfig walks up from the current directory to find the project configuration
+func FindProjectConfig() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	for {
+		file_name := filepath.Join(dir, PROJECT_CONFIG_FILE)
+		if info, err := os.Stat(file_name); err == nil && !info.IsDir() {
+			return file_name
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// UpdateUserConfig applies the change to the effective configuration and writes it
+// into the user file only, so the values from the other layers never leak into it
+func UpdateUserConfig(apply func(cfg *SysConfig)) error {
+	apply(MyConfig)
+
+	user_file := MyConfig.user_file
+	if len(user_file) == 0 {
+		dir_home, err := FindHomeDir(false)
+		if err != nil {
+			dir_home = "."
+		}
+		user_file = path.Join(dir_home, "xally.yaml")
+	}
+
+	user_cfg := NewSysConfig(user_file)
+	if _, err := os.Stat(user_file); err == nil {
+		if err = user_cfg.LoadFromYAML(user_file); err != nil {
+			return err
+		}
+	}
+	apply(user_cfg)
+	_, err := user_cfg.DumpIntoYAML(user_file)
+	return err
+}
+
+// EffectiveYAML renders the merged configuration with the secrets masked
+func (cfg *SysConfig) EffectiveYAML() (string, error) {
+	masked := *cfg
+	masked.System.OpenaiApiKey = maskSecret(masked.System.OpenaiApiKey)
+	masked.System.DeeplApiKey = maskSecret(masked.System.DeeplApiKey)
+	masked.System.AppToken = maskSecret(masked.System.AppToken)
+	masked.System.SentryDSN = maskSecret(masked.System.SentryDSN)
+
+	yaml_data, err := yaml.Marshal(&masked)
+	return string(yaml_data), err
+}
+
+// applyEnv overrides the system settings by XALLY_<YAML_KEY> environment variables,
+// lists are comma separated. It returns the names of the variables applied.
+func (cfg *SysConfig) applyEnv(lookup func(string) (string, bool)) ([]string, []string) {
+	applied := []string{}
+	problems := []string{}
+
+	val_sys := reflect.ValueOf(&cfg.System).Elem()
+	for idx := 0; idx < val_sys.NumField(); idx++ {
+		key := yamlKey(val_sys.Type().Field(idx))
+		if len(key) == 0 {
+			continue
+		}
+		env_name := ENV_PREFIX + strings.ToUpper(key)
+		env_val, ok := lookup(env_name)
+		if !ok {
+			continue
+		}
+
+		if err := setFromString(val_sys.Field(idx), env_val); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s", env_name, err.Error()))
+			continue
+		}
+		applied = append(applied, env_name)
+	}
+	return applied, problems
+}
+
+func setFromString(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		flag, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("expect a boolean, got %q", value)
+		}
+		field.SetBool(flag)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		num, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("expect an integer, got %q", value)
+		}
+		field.SetInt(num)
+	case reflect.Uint, reflect.Uint32, reflect.Uint64:
+		num, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("expect a non-negative integer, got %q", value)
+		}
+		field.SetUint(num)
+	case reflect.Slice:
+		items := []string{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); len(item) > 0 {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("not supported by environment variables")
+	}
+	return nil
+}
+
+func yamlKey(field reflect.StructField) string {
+	key := strings.Split(field.Tag.Get("yaml"), ",")[0]
+	if key == "-" {
+		return ""
+	}
+	return key
+}
+
+func maskSecret(secret string) string {
+	if len(secret) == 0 {
+		return ""
+	}
+	if len(secret) <= 8 {
+		return "****"
+	}
+	return secret[:3] + "****" + secret[len(secret)-4:]
+}
+
+func sameFile(file1 string, file2 string) bool {
+	info1, err1 := os.Stat(file1)
+	info2, err2 := os.Stat(file2)
+	return err1 == nil && err2 == nil && os.SameFile(info1, info2)
+}
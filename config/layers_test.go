@@ -0,0 +1,139 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/robinmin/xally/config"
+	"github.com/robinmin/xally/shared/secretstore"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadLayers(t *testing.T) {
+	assertions := require.New(t)
+
+	root := t.TempDir()
+	system_file := filepath.Join(root, "etc", "xally.yaml")
+	user_file := filepath.Join(root, "home", "xally.yaml")
+	project_dir := filepath.Join(root, "repo", "sub", "dir")
+	for file_name, content := range map[string]string{
+		system_file: "system:\n  default_role: expert\n  log_level: debug\n  cache_ttl: 60\n",
+		user_file:   "system:\n  default_role: assistant\n  openai_api_key: sk-user\n",
+		filepath.Join(root, "repo", ".xally.yaml"): "system:\n  default_role: architect\n  translators: [llm]\nroles:\n  reviewer:\n    name: reviewer\n    prompt: Review the code\n",
+	} {
+		assertions.NoError(os.MkdirAll(filepath.Dir(file_name), 0755))
+		assertions.NoError(os.WriteFile(file_name, []byte(content), 0644))
+	}
+	assertions.NoError(os.MkdirAll(project_dir, 0755))
+
+	cwd, err := os.Getwd()
+	assertions.NoError(err)
+	defer os.Chdir(cwd)
+	assertions.NoError(os.Chdir(project_dir))
+
+	saved := config.SystemConfigFile
+	defer func() { config.SystemConfigFile = saved }()
+	config.SystemConfigFile = system_file
+	t.Setenv("XALLY_CACHE_TTL", "120")
+	t.Setenv("XALLY_SHELL_DENYLIST", "rm -rf /, shutdown")
+
+	cfg := config.NewSysConfig(user_file)
+	assertions.NoError(cfg.LoadLayers(user_file))
+	assertions.Equal("architect", cfg.System.DefaultRole)
+	assertions.Equal("debug", cfg.System.LogLevel)
+	assertions.Equal("sk-user", cfg.System.OpenaiApiKey)
+	assertions.Equal([]string{"llm"}, cfg.System.Translators)
+	assertions.Equal(int64(120), cfg.System.CacheTTL)
+	assertions.Equal([]string{"rm -rf /", "shutdown"}, cfg.System.ShellDenylist)
+	assertions.Contains(cfg.Roles, "reviewer")
+	assertions.Contains(cfg.Roles, "expert")
+
+	names := []string{}
+	for _, layer := range cfg.Layers {
+		names = append(names, layer.Name)
+	}
+	assertions.Equal([]string{config.LAYER_SYSTEM, config.LAYER_USER, config.LAYER_PROJECT, config.LAYER_ENV}, names)
+
+	effective, err := cfg.EffectiveYAML()
+	assertions.NoError(err)
+	assertions.NotContains(effective, "sk-user")
+
+	// write back into the user file only, with the secrets moved into the store
+	t.Setenv(secretstore.ENV_SECRET_KEY, "passphrase")
+	saved_secrets := config.MySecrets
+	defer func() { config.MySecrets = saved_secrets }()
+	config.MySecrets = secretstore.New(filepath.Join(root, "home", "secrets.age"), nil)
+	config.MySecrets.WorkFactor = 10
+
+	saved_cfg := config.MyConfig
+	defer func() { config.MyConfig = saved_cfg }()
+	config.MyConfig = cfg
+	assertions.NoError(config.UpdateUserConfig(func(cfg *config.SysConfig) {
+		cfg.System.Email = "someone@example.com"
+		cfg.System.AppToken = "token-1"
+	}))
+	data, err := os.ReadFile(user_file)
+	assertions.NoError(err)
+	assertions.Contains(string(data), "someone@example.com")
+	assertions.Contains(string(data), "default_role: assistant")
+	assertions.Contains(string(data), "openai_api_key: secret://openai_api_key")
+	assertions.Contains(string(data), "app_token: secret://app_token")
+	assertions.NotContains(string(data), "sk-user")
+	assertions.NotContains(string(data), "token-1")
+	assertions.NotContains(string(data), "reviewer")
+	assertions.Equal("someone@example.com", cfg.System.Email)
+
+	info, err := os.Stat(user_file)
+	assertions.NoError(err)
+	assertions.Equal(os.FileMode(0600), info.Mode().Perm())
+
+	reloaded := config.NewSysConfig(user_file)
+	assertions.NoError(reloaded.LoadLayers(user_file))
+	assertions.Equal("sk-user", reloaded.System.OpenaiApiKey)
+	assertions.Equal("token-1", reloaded.System.AppToken)
+
+	reloaded.RefreshSecret("app_token", "token-2")
+	assertions.Equal("token-2", reloaded.System.AppToken)
+}
+
+func TestValidateConfigData(t *testing.T) {
+	assertions := require.New(t)
+
+	data := strings.Join([]string{
+		"system:",
+		"  log_level: verbose",
+		"  cache_ttl: soon",
+		"  unknown_key: 1",
+		"  translators: [deepl, google]",
+		"  api_endpoint_openai: api.openai.com",
+		"roles:",
+		"  expert:",
+		"    temperature: 3",
+		"",
+	}, "\n")
+	messages := []string{}
+	for _, cfg_err := range config.ValidateConfigData("xally.yaml", []byte(data)) {
+		messages = append(messages, cfg_err.Error())
+	}
+	assertions.Equal([]string{
+		`xally.yaml:2:14: system.log_level: "verbose" is not one of panic, fatal, error, warn, warning, info, debug, trace`,
+		`xally.yaml:3:14: system.cache_ttl: expect an integer, got "soon"`,
+		`xally.yaml:4:3: system.unknown_key: unknown field`,
+		`xally.yaml:5:24: system.translators[1]: "google" is not one of deepl, llm, dict`,
+		`xally.yaml:6:24: system.api_endpoint_openai: "api.openai.com" is not a valid http(s) URL`,
+		`xally.yaml:9:18: roles.expert.temperature: "3" is out of the range [0, 2]`,
+	}, messages)
+
+	cfg_errors := config.ValidateConfigData("broken.yaml", []byte("system:\n  a: [\n"))
+	assertions.Len(cfg_errors, 1)
+	assertions.True(strings.HasPrefix(cfg_errors[0].Error(), "broken.yaml:"))
+
+	// the default configuration is always valid
+	cfg := config.NewSysConfig(filepath.Join(t.TempDir(), "xally.yaml"))
+	yaml_data, err := cfg.DumpIntoYAML(filepath.Join(t.TempDir(), "xally.yaml"))
+	assertions.NoError(err)
+	assertions.Empty(config.ValidateConfigData("xally.yaml", []byte(yaml_data)))
+	assertions.Empty(cfg.Validate())
+}
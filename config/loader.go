@@ -6,6 +6,8 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+
+	"github.com/robinmin/xally/shared/secretstore"
 )
 
 // /////////////////////////////////////////////////////////////////////////////
@@ -101,6 +103,7 @@ func LoadClientConfig(config_file string, verbose bool) (*SysConfig, error) {
 	}
 
 	// Create config structure
+	MySecrets = secretstore.New(path.Join(path.Dir(temp_file), "secrets.age"), askSecretPassphrase)
 	MyConfig = NewSysConfig(temp_file)
 	skip_reload := false
 	if _, err = os.Stat(temp_file); os.IsNotExist(err) {
@@ -115,73 +118,21 @@ func LoadClientConfig(config_file string, verbose bool) (*SysConfig, error) {
 		}
 	}
 
-	// Open config file
-	if !skip_reload {
-		if verbose {
-			fmt.Println("Loading config file from ", temp_file)
-		}
-
-		if err = MyConfig.LoadFromYAML(temp_file); err != nil {
-			if verbose {
-				fmt.Println("Failed to load configuration from config file : ", temp_file)
-				fmt.Println(err)
-			}
-			return MyConfig, err
-		}
-		// update key from env var in case of blank
-		if MyConfig.System.OpenaiApiKey == "" {
-			MyConfig.System.OpenaiApiKey = os.Getenv("OPENAI_API_KEY")
-		}
+	// Merge the system, user and project config files and the environment variables
+	if verbose && !skip_reload {
+		fmt.Println("Loading config file from ", temp_file)
 	}
-
-	SetupPeferenceLanguage(MyConfig.System.PeferenceLanguage)
-
-	return MyConfig, nil
-}
-
-var peference_language string
-
-func SetupPeferenceLanguage(language string) {
-	peference_language = language
-}
-
-func Text(str_key string) string {
-	var msg string
-
-	switch peference_language {
-	case "EN", "en_US.UTF-8", "C":
-		if str_val, ok := i18n_str_table_en[str_key]; ok {
-			msg = str_val
-		} else {
-			msg = str_key
-		}
-	case "JP", "ja_JP.UTF-8":
-		if str_val, ok := i18n_str_table_jp[str_key]; ok {
-			msg = str_val
-		} else {
-			msg = str_key
-		}
-	case "CN", "zh_CN.UTF-8":
-		fallthrough
-	default:
-		if str_val, ok := i18n_str_table[str_key]; ok {
-			msg = str_val
-		} else {
-			msg = str_key
-		}
+	layer_err := MyConfig.LoadLayers(temp_file)
+	if layer_err != nil && verbose {
+		fmt.Println("Problems found in the configuration : ")
+		fmt.Println(layer_err)
 	}
-	return msg
-}
 
-func GetAcceptLanguage() string {
-	switch peference_language {
-	case "EN", "en_US.UTF-8", "C":
-		return "en"
-	case "JP", "ja_JP.UTF-8":
-		return "ja"
-	case "CN", "zh_CN.UTF-8":
-		return "zh"
-	default:
-		return "en"
+	// extra locale files under the same folder as the config file
+	if err = LoadLocales(path.Join(path.Dir(temp_file), "locales")); err != nil && verbose {
+		fmt.Println("Failed to load locale files : ", err)
 	}
+	SetupPeferenceLanguage(MyConfig.System.PeferenceLanguage)
+
+	return MyConfig, layer_err
 }
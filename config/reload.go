@@ -0,0 +1,93 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// settings given on the command line, applied again after each reload
+var flag_overrides func(cfg *SysConfig)
+
+// SetFlagOverrides applies the command line settings to the current configuration and
+// keeps them, so they still win over the files after the configuration is reloaded
+func SetFlagOverrides(apply func(cfg *SysConfig)) {
+	flag_overrides = apply
+	if MyConfig != nil && apply != nil {
+		apply(MyConfig)
+	}
+}
+
+// WatchedFiles lists the config files of all layers, including the ones not created yet
+func (cfg *SysConfig) WatchedFiles() []string {
+	files := []string{SystemConfigFile}
+	if len(cfg.user_file) > 0 {
+		files = append(files, cfg.user_file)
+	}
+	if project_file := FindProjectConfig(); len(project_file) > 0 {
+		files = append(files, project_file)
+	} else if dir, err := os.Getwd(); err == nil {
+		files = append(files, filepath.Join(dir, PROJECT_CONFIG_FILE))
+	}
+	return files
+}
+
+// ReloadClientConfig loads all layers again into a new configuration. The current one is
+// kept untouched if any problem is found, so a half edited file never breaks the session.
+func ReloadClientConfig() (*SysConfig, error) {
+	user_file := ""
+	if MyConfig != nil {
+		user_file = MyConfig.user_file
+	}
+
+	cfg := NewSysConfig(user_file)
+	if err := cfg.LoadLayers(user_file); err != nil {
+		return nil, err
+	}
+	if flag_overrides != nil {
+		flag_overrides(cfg)
+	}
+
+	MyConfig = cfg
+	SetupPeferenceLanguage(cfg.System.PeferenceLanguage)
+	return cfg, nil
+}
+
+type fileStamp struct {
+	exists   bool
+	mod_time time.Time
+	size     int64
+}
+
+// Watcher polls the files and tells if any of them is created, changed or removed
+type Watcher struct {
+	files  []string
+	stamps map[string]fileStamp
+	mutex  sync.Mutex
+}
+
+func NewWatcher(files ...string) *Watcher {
+	w := &Watcher{files: files, stamps: map[string]fileStamp{}}
+	w.Changed()
+	return w
+}
+
+// Changed compares the files with the last check
+func (w *Watcher) Changed() bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	changed := false
+	for _, file_name := range w.files {
+		stamp := fileStamp{}
+		if info, err := os.Stat(file_name); err == nil {
+			stamp = fileStamp{exists: true, mod_time: info.ModTime(), size: info.Size()}
+		}
+		if last, ok := w.stamps[file_name]; ok && (last.exists != stamp.exists || !last.mod_time.Equal(stamp.mod_time) || last.size != stamp.size) {
+			changed = true
+		}
+		w.stamps[file_name] = stamp
+	}
+	return changed
+}
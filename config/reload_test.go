@@ -0,0 +1,60 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/robinmin/xally/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReloadClientConfig(t *testing.T) {
+	assertions := require.New(t)
+
+	root := t.TempDir()
+	user_file := filepath.Join(root, "xally.yaml")
+	assertions.NoError(os.WriteFile(user_file, []byte("system:\n  log_level: info\n"), 0644))
+
+	cwd, err := os.Getwd()
+	assertions.NoError(err)
+	defer os.Chdir(cwd)
+	assertions.NoError(os.Chdir(root))
+
+	saved_system, saved_cfg := config.SystemConfigFile, config.MyConfig
+	defer func() {
+		config.SystemConfigFile, config.MyConfig = saved_system, saved_cfg
+		config.SetFlagOverrides(nil)
+	}()
+	config.SystemConfigFile = filepath.Join(root, "missing.yaml")
+
+	config.MyConfig = config.NewSysConfig(user_file)
+	assertions.NoError(config.MyConfig.LoadLayers(user_file))
+	config.SetFlagOverrides(func(cfg *config.SysConfig) { cfg.System.ChatHistoryPath = "/tmp/flags" })
+
+	watcher := config.NewWatcher(config.MyConfig.WatchedFiles()...)
+	assertions.False(watcher.Changed())
+
+	// a new project file is picked up as well
+	project_file := filepath.Join(root, config.PROJECT_CONFIG_FILE)
+	assertions.NoError(os.WriteFile(project_file, []byte("system:\n  log_level: debug\n"), 0644))
+	assertions.True(watcher.Changed())
+	assertions.False(watcher.Changed())
+
+	cfg, err := config.ReloadClientConfig()
+	assertions.NoError(err)
+	assertions.Same(cfg, config.MyConfig)
+	assertions.Equal("debug", cfg.System.LogLevel)
+	assertions.Equal("/tmp/flags", cfg.System.ChatHistoryPath)
+
+	// an invalid change keeps the current configuration
+	future := time.Now().Add(time.Minute)
+	assertions.NoError(os.WriteFile(user_file, []byte("system:\n  log_level: loud\n"), 0644))
+	assertions.NoError(os.Chtimes(user_file, future, future))
+	assertions.True(watcher.Changed())
+
+	_, err = config.ReloadClientConfig()
+	assertions.ErrorContains(err, "log_level")
+	assertions.Same(cfg, config.MyConfig)
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/robinmin/xally/shared/secretstore"
+)
+
+// keys of the settings kept in the secret store instead of the YAML
+var SECRET_KEYS = []string{"openai_api_key", "deepl_api_key", "app_token"}
+
+// secret store next to the user config file
+var MySecrets *secretstore.Store
+
+// SecretPassphrase asks for the passphrase of the secret store, the client sets it to prompt in the terminal
+var SecretPassphrase secretstore.KeyFunc
+
+// askSecretPassphrase looks up SecretPassphrase at the time of asking, so the client can
+// change where to ask after the store is created
+func askSecretPassphrase(create bool) (string, error) {
+	if SecretPassphrase == nil {
+		return "", secretstore.ErrNoKey
+	}
+	return SecretPassphrase(create)
+}
+
+func (cfg *SysConfig) secretField(key string) *string {
+	switch key {
+	case "openai_api_key":
+		return &cfg.System.OpenaiApiKey
+	case "deepl_api_key":
+		return &cfg.System.DeeplApiKey
+	case "app_token":
+		return &cfg.System.AppToken
+	default:
+		return nil
+	}
+}
+
+// collectSecretRefs remembers the secret names referred by the settings, so they
+// are written back under the same names
+func (cfg *SysConfig) collectSecretRefs() {
+	if cfg.secret_refs == nil {
+		cfg.secret_refs = map[string]string{}
+	}
+	for _, key := range SECRET_KEYS {
+		if name, ok := secretstore.IsRef(*cfg.secretField(key)); ok {
+			cfg.secret_refs[key] = name
+		}
+	}
+}
+
+// resolveSecrets replaces the secret:// references by the values in the store
+func (cfg *SysConfig) resolveSecrets() []string {
+	cfg.collectSecretRefs()
+
+	problems := []string{}
+	for _, key := range SECRET_KEYS {
+		field := cfg.secretField(key)
+		name, ok := secretstore.IsRef(*field)
+		if !ok {
+			continue
+		}
+
+		// never use the reference itself as the secret
+		*field = ""
+		if MySecrets == nil {
+			problems = append(problems, fmt.Sprintf("%s: no secret store for %s", key, secretstore.Ref(name)))
+			continue
+		}
+		value, found, err := MySecrets.Get(name)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s", key, err.Error()))
+		} else if !found {
+			problems = append(problems, fmt.Sprintf("%s: secret %q is not found in %s", key, name, MySecrets.Path()))
+		} else {
+			*field = value
+		}
+	}
+	return problems
+}
+
+// stashSecrets moves the plain secrets into the store and keeps their references only
+func (cfg *SysConfig) stashSecrets() error {
+	for _, key := range SECRET_KEYS {
+		field := cfg.secretField(key)
+		if len(*field) == 0 {
+			continue
+		}
+		if _, ok := secretstore.IsRef(*field); ok {
+			continue
+		}
+
+		name := key
+		if ref_name, ok := cfg.secret_refs[key]; ok {
+			name = ref_name
+		}
+		if MySecrets == nil {
+			return fmt.Errorf("no secret store to keep %s", key)
+		}
+		if err := MySecrets.Set(name, *field); err != nil {
+			return err
+		}
+		*field = secretstore.Ref(name)
+	}
+	return nil
+}
+
+// RefreshSecret updates the settings referring to the secret after it is changed
+func (cfg *SysConfig) RefreshSecret(name string, value string) {
+	for key, ref_name := range cfg.secret_refs {
+		if ref_name == name {
+			*cfg.secretField(key) = value
+		}
+	}
+}
@@ -43,6 +43,11 @@ type ServerConfigItems struct {
 	DirectEmailNotify   bool   `yaml:"direct_email_notify"`
 	EmailRestrictDomain string `yaml:"email_restrict_domain"`
 
+	// proxy, direct hosts and extra root certificates of the outbound requests, like the client
+	ProxyURL string   `yaml:"proxy_url,omitempty"`
+	NoProxy  []string `yaml:"no_proxy,omitempty"`
+	CABundle string   `yaml:"ca_bundle,omitempty"`
+
 	DebugMode bool `yaml:"debug_mode,omitempty"`
 }
 
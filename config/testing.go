@@ -0,0 +1,17 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// UseTestConfig sets MyConfig to the defaults with the files in a temporary folder of the
+// test, and restores the previous one once the test is done
+func UseTestConfig(t testing.TB) *SysConfig {
+	saved := MyConfig
+	MyConfig = NewSysConfig(filepath.Join(t.TempDir(), "xally.yaml"))
+	t.Cleanup(func() {
+		MyConfig = saved
+	})
+	return MyConfig
+}
@@ -0,0 +1,242 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigError is a problem found in the configuration, with its location if it comes from a file
+type ConfigError struct {
+	File    string
+	Line    int
+	Column  int
+	Field   string
+	Message string
+}
+
+func (e *ConfigError) Error() string {
+	var location string
+	switch {
+	case len(e.File) > 0 && e.Line > 0 && e.Column > 0:
+		location = fmt.Sprintf("%s:%d:%d: ", e.File, e.Line, e.Column)
+	case len(e.File) > 0 && e.Line > 0:
+		location = fmt.Sprintf("%s:%d: ", e.File, e.Line)
+	case len(e.File) > 0:
+		location = e.File + ": "
+	}
+	if len(e.Field) > 0 {
+		return location + e.Field + ": " + e.Message
+	}
+	return location + e.Message
+}
+
+// checks on the scalar values, keyed by the field path with `*` for map keys and `[]` for list items
+var value_checks = map[string]func(value string) string{
+	"system.log_level":           checkOneOf("panic", "fatal", "error", "warn", "warning", "info", "debug", "trace"),
+	"system.api_endpoint_openai": checkURL,
+	"system.api_endpoint_deepl":  checkURL,
+	"system.proxy_url":           checkProxyURL,
+	"system.translators[]":       checkOneOf("deepl", "llm", "dict"),
+	"roles.*.temperature":        checkRange(0, 2),
+}
+
+var rx_yaml_line = regexp.MustCompile(`line (\d+)`)
+
+// ValidateConfigData checks the YAML against the schema of SysConfig, e.g. unknown
+// fields, wrong types and invalid values, and reports where they are in the file
+func ValidateConfigData(file_name string, data []byte) []*ConfigError {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		cfg_err := &ConfigError{File: file_name, Message: strings.TrimPrefix(err.Error(), "yaml: ")}
+		if matches := rx_yaml_line.FindStringSubmatch(err.Error()); matches != nil {
+			cfg_err.Line, _ = strconv.Atoi(matches[1])
+		}
+		return []*ConfigError{cfg_err}
+	}
+	if len(doc.Content) == 0 {
+		return nil
+	}
+
+	validator := &schemaValidator{file_name: file_name}
+	validator.check(doc.Content[0], reflect.TypeOf(SysConfig{}), "", "")
+	return validator.errors
+}
+
+// Validate checks the effective configuration for the problems across the layers
+func (cfg *SysConfig) Validate() []*ConfigError {
+	errors := []*ConfigError{}
+	if _, ok := cfg.Roles[cfg.System.DefaultRole]; !ok {
+		errors = append(errors, &ConfigError{
+			Field:   "system.default_role",
+			Message: fmt.Sprintf("role %q is not defined in roles", cfg.System.DefaultRole),
+		})
+	}
+	return errors
+}
+
+// ValidateLayers checks the files of all layers again together with the effective configuration
+func (cfg *SysConfig) ValidateLayers() []*ConfigError {
+	errors := []*ConfigError{}
+	for _, layer := range cfg.Layers {
+		if layer.Name == LAYER_ENV {
+			continue
+		}
+		data, err := os.ReadFile(layer.Source)
+		if err != nil {
+			errors = append(errors, &ConfigError{File: layer.Source, Message: err.Error()})
+			continue
+		}
+		errors = append(errors, ValidateConfigData(layer.Source, data)...)
+	}
+	return append(errors, cfg.Validate()...)
+}
+
+type schemaValidator struct {
+	file_name string
+	errors    []*ConfigError
+}
+
+func (v *schemaValidator) fail(node *yaml.Node, field string, format string, args ...interface{}) {
+	v.errors = append(v.errors, &ConfigError{
+		File:    v.file_name,
+		Line:    node.Line,
+		Column:  node.Column,
+		Field:   field,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// check walks the node along the type, field is the path to show and schema_path the one to look up value_checks
+func (v *schemaValidator) check(node *yaml.Node, typ reflect.Type, field string, schema_path string) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if node.Tag == "!!null" {
+		return
+	}
+
+	switch typ.Kind() {
+	case reflect.Ptr:
+		v.check(node, typ.Elem(), field, schema_path)
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			v.fail(node, field, "expect a mapping")
+			return
+		}
+		fields := map[string]reflect.StructField{}
+		for idx := 0; idx < typ.NumField(); idx++ {
+			if key := yamlKey(typ.Field(idx)); len(key) > 0 && typ.Field(idx).IsExported() {
+				fields[key] = typ.Field(idx)
+			}
+		}
+		for idx := 0; idx+1 < len(node.Content); idx += 2 {
+			key_node := node.Content[idx]
+			sub_field, ok := fields[key_node.Value]
+			if !ok {
+				v.fail(key_node, joinField(field, key_node.Value), "unknown field")
+				continue
+			}
+			v.check(node.Content[idx+1], sub_field.Type, joinField(field, key_node.Value), joinField(schema_path, key_node.Value))
+		}
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			v.fail(node, field, "expect a mapping")
+			return
+		}
+		for idx := 0; idx+1 < len(node.Content); idx += 2 {
+			v.check(node.Content[idx+1], typ.Elem(), joinField(field, node.Content[idx].Value), joinField(schema_path, "*"))
+		}
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			v.fail(node, field, "expect a list")
+			return
+		}
+		for idx, item := range node.Content {
+			v.check(item, typ.Elem(), fmt.Sprintf("%s[%d]", field, idx), schema_path+"[]")
+		}
+	default:
+		if node.Kind != yaml.ScalarNode {
+			v.fail(node, field, "expect a single value")
+			return
+		}
+		if msg := checkScalarType(node, typ); len(msg) > 0 {
+			v.fail(node, field, msg)
+			return
+		}
+		if check, ok := value_checks[schema_path]; ok {
+			if msg := check(node.Value); len(msg) > 0 {
+				v.fail(node, field, msg)
+			}
+		}
+	}
+}
+
+func checkScalarType(node *yaml.Node, typ reflect.Type) string {
+	switch typ.Kind() {
+	case reflect.Bool:
+		if node.Tag != "!!bool" {
+			return fmt.Sprintf("expect a boolean, got %q", node.Value)
+		}
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		if node.Tag != "!!int" {
+			return fmt.Sprintf("expect an integer, got %q", node.Value)
+		}
+	case reflect.Uint, reflect.Uint32, reflect.Uint64:
+		if node.Tag != "!!int" || strings.HasPrefix(node.Value, "-") {
+			return fmt.Sprintf("expect a non-negative integer, got %q", node.Value)
+		}
+	case reflect.Float32, reflect.Float64:
+		if node.Tag != "!!int" && node.Tag != "!!float" {
+			return fmt.Sprintf("expect a number, got %q", node.Value)
+		}
+	}
+	return ""
+}
+
+func checkOneOf(options ...string) func(value string) string {
+	return func(value string) string {
+		for _, option := range options {
+			if strings.EqualFold(value, option) {
+				return ""
+			}
+		}
+		return fmt.Sprintf("%q is not one of %s", value, strings.Join(options, ", "))
+	}
+}
+
+func checkURL(value string) string {
+	if obj_url, err := url.Parse(value); err != nil || (obj_url.Scheme != "http" && obj_url.Scheme != "https") || len(obj_url.Host) == 0 {
+		return fmt.Sprintf("%q is not a valid http(s) URL", value)
+	}
+	return ""
+}
+
+func checkProxyURL(value string) string {
+	if obj_url, err := url.Parse(value); err != nil || (obj_url.Scheme != "http" && obj_url.Scheme != "https" && obj_url.Scheme != "socks5") || len(obj_url.Host) == 0 {
+		return fmt.Sprintf("%q is not a valid proxy URL, expect http, https or socks5", value)
+	}
+	return ""
+}
+
+func checkRange(min float64, max float64) func(value string) string {
+	return func(value string) string {
+		if num, err := strconv.ParseFloat(value, 64); err != nil || num < min || num > max {
+			return fmt.Sprintf("%q is out of the range [%g, %g]", value, min, max)
+		}
+		return ""
+	}
+}
+
+func joinField(parent string, key string) string {
+	if len(parent) == 0 {
+		return key
+	}
+	return parent + "." + key
+}
@@ -1,10 +1,144 @@
 package clientdb
 
-import "gorm.io/gorm"
+import (
+	"sort"
+	"time"
 
+	"gorm.io/gorm"
+)
+
+// OptionHistory keeps one row for each input of a role, UpdatedAt is the last time it is used
 type OptionHistory struct {
 	gorm.Model
 
-	Role   string `gorm:"type:varchar(32);<-:create"`  // allow read and create
-	Option string `gorm:"type:varchar(256);<-:create"` // allow read and create
+	Role   string `gorm:"type:varchar(32);<-:create;index:idx_option_history"` // allow read and create
+	Option string `gorm:"type:text;<-:create;index:idx_option_history"`        // allow read and create
+	Count  int    `gorm:"default:1"`
+}
+
+// OptionEntry is a distinct input with how often and how lately it is used
+type OptionEntry struct {
+	Option   string
+	Hits     int
+	LastUsed time.Time
+}
+
+// Frecency ranks the entry by its uses, the recent ones weigh more
+func (entry *OptionEntry) Frecency(now time.Time) float64 {
+	age := now.Sub(entry.LastUsed)
+	weight := 0.25
+	switch {
+	case age < 24*time.Hour:
+		weight = 4
+	case age < 7*24*time.Hour:
+		weight = 2
+	case age < 30*24*time.Hour:
+		weight = 1
+	case age < 90*24*time.Hour:
+		weight = 0.5
+	}
+	return float64(entry.Hits) * weight
+}
+
+// RankOptionEntries sorts the entries by frecency with the best ones last, as the up
+// arrow starts from the end of the history, and keeps the best limit ones if limit > 0
+func RankOptionEntries(entries []OptionEntry, limit int, now time.Time) []string {
+	sort.SliceStable(entries, func(i, j int) bool {
+		score_i, score_j := entries[i].Frecency(now), entries[j].Frecency(now)
+		if score_i != score_j {
+			return score_i < score_j
+		}
+		return entries[i].LastUsed.Before(entries[j].LastUsed)
+	})
+	if limit > 0 && len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+
+	options := []string{}
+	for _, entry := range entries {
+		options = append(options, entry.Option)
+	}
+	return options
+}
+
+const SHELL_ACTION_RUN = "run"
+const SHELL_ACTION_CANCEL = "cancel"
+
+// ShellHistory keeps the commands suggested by the shell command and what happened to them
+type ShellHistory struct {
+	gorm.Model
+
+	Request     string `gorm:"type:varchar(1024)"`
+	Command     string `gorm:"type:varchar(1024)"`
+	Explanation string `gorm:"type:varchar(2048)"`
+	Action      string `gorm:"type:varchar(16)"`
+	Edited      bool
+	Dangerous   bool
+	ExitCode    int
+	Output      string `gorm:"type:text"`
+}
+
+const CACHE_KIND_WEB = "web"
+const CACHE_KIND_FILE = "file"
+const CACHE_KIND_ANSWER = "answer"
+
+// ContentCache keeps fetched web pages (keyed by URL), extracted files (keyed by path and mtime)
+// and the answers of the API (keyed by the hash of the request)
+type ContentCache struct {
+	gorm.Model
+
+	Kind         string    `gorm:"type:varchar(16);index:idx_content_cache_key"`
+	Key          string    `gorm:"type:varchar(1024);index:idx_content_cache_key"`
+	ContentType  string    `gorm:"type:varchar(128)"`
+	ETag         string    `gorm:"type:varchar(256)"`
+	LastModified string    `gorm:"type:varchar(64)"`
+	ModTime      time.Time // modification time of the cached file
+	Size         int
+	Content      []byte
+	ExpiresAt    time.Time
+}
+
+// GeneratedImage keeps an image drawn by the imagine command, Path is where it is saved
+type GeneratedImage struct {
+	gorm.Model
+
+	Prompt        string `gorm:"type:text"`
+	RevisedPrompt string `gorm:"type:text"`
+	AIModel       string `gorm:"type:varchar(64)"`
+	Size          string `gorm:"type:varchar(16)"`
+	Path          string `gorm:"type:varchar(1024)"`
+}
+
+// days to wait before the next review for each Leitner box
+var VOCAB_BOX_INTERVALS = []int{1, 2, 4, 8, 16, 32}
+
+// VocabEntry keeps a word looked up by the user, reviewed in Leitner boxes starting from 1
+type VocabEntry struct {
+	gorm.Model
+
+	Word     string `gorm:"type:varchar(128);index:idx_vocab_word"`
+	Language string `gorm:"type:varchar(16);index:idx_vocab_word"`
+	Senses   string `gorm:"type:text"`
+	Sentence string `gorm:"type:varchar(1024)"`
+	Box      int
+	DueAt    time.Time `gorm:"index"`
+	Reviews  int
+	Lapses   int
+}
+
+// Review moves the entry to the next box if it is remembered, otherwise back to the first one
+func (entry *VocabEntry) Review(remembered bool, now time.Time) {
+	entry.Reviews++
+	if remembered {
+		if entry.Box < len(VOCAB_BOX_INTERVALS) {
+			entry.Box++
+		}
+	} else {
+		entry.Lapses++
+		entry.Box = 1
+	}
+	if entry.Box < 1 {
+		entry.Box = 1
+	}
+	entry.DueAt = now.AddDate(0, 0, VOCAB_BOX_INTERVALS[entry.Box-1])
 }
@@ -2,6 +2,8 @@ package clientdb
 
 import (
 	"fmt"
+	"strings"
+	"time"
 	"unicode/utf8"
 
 	"github.com/robinmin/xally/config"
@@ -41,6 +43,10 @@ func InitClientDB(db_name string, verbose bool) (*ClientDB, error) {
 		// if config.MyConfig.DebugMode() {
 		if err = cdb.db.AutoMigrate(
 			&OptionHistory{},
+			&ContentCache{},
+			&ShellHistory{},
+			&VocabEntry{},
+			&GeneratedImage{},
 			&model.ConversationHistory{},
 		); err != nil {
 			log.Error(err)
@@ -50,29 +56,127 @@ func InitClientDB(db_name string, verbose bool) (*ClientDB, error) {
 	return cdb, err
 }
 
-func (cdb *ClientDB) LoadOptionHistory(role_name string) ([]string, error) {
-	option_history := []string{}
-	records := &[]OptionHistory{}
+// max runes of an input kept in the history, longer ones are too long to recall anyway
+const OPTION_HISTORY_MAX_LEN = 4096
 
-	cdb.db.Unscoped().Where("role = ?", role_name).Find(records)
-	for _, record := range *records {
-		option_history = append(option_history, record.Option)
+// LoadOptionHistory returns the distinct inputs of the role ranked by frecency, the best
+// ones last, and at most limit of them if limit > 0
+func (cdb *ClientDB) LoadOptionHistory(role_name string, limit int) ([]string, error) {
+	entries, err := cdb.OptionEntries(role_name)
+	if err != nil {
+		return []string{}, err
 	}
-	return option_history, nil
+	return RankOptionEntries(entries, limit, time.Now()), nil
 }
 
-func (cdb *ClientDB) AddOptionHistory(op_history *OptionHistory) bool {
-	if op_history != nil {
-		op_history.Option = TruncateStr(op_history.Option, 256)
-		tx := cdb.db.Create(op_history)
-		if tx.Error != nil {
-			log.Error("Failed to add new option history")
-			log.Error(tx.Error)
-		} else {
-			return true
+// OptionEntries returns the distinct inputs of the role, or of all roles if role_name is
+// blank, the latest used first
+func (cdb *ClientDB) OptionEntries(role_name string) ([]OptionEntry, error) {
+	entries := []OptionEntry{}
+	if cdb == nil || cdb.db == nil {
+		return entries, nil
+	}
+
+	rows, err := cdb.optionEntriesQuery(role_name).Rows()
+	if err != nil {
+		return entries, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry OptionEntry
+		var last_used string
+		if err = rows.Scan(&entry.Option, &entry.Hits, &last_used); err != nil {
+			return entries, err
 		}
+		entry.LastUsed = parseDBTime(last_used)
+		entries = append(entries, entry)
 	}
-	return false
+	return entries, rows.Err()
+}
+
+func (cdb *ClientDB) optionEntriesQuery(role_name string) *gorm.DB {
+	tx := cdb.db.Model(&OptionHistory{}).
+		Select("option, SUM(count) AS hits, MAX(updated_at) AS last_used").
+		Group("option").
+		Order("last_used desc")
+	if len(role_name) > 0 {
+		tx = tx.Where("role = ?", role_name)
+	}
+	return tx
+}
+
+// AddOptionHistory counts one more use of the input, it is added if not used before
+func (cdb *ClientDB) AddOptionHistory(op_history *OptionHistory) bool {
+	if cdb == nil || cdb.db == nil || op_history == nil {
+		return false
+	}
+	if len(strings.TrimSpace(op_history.Option)) == 0 || utf8.RuneCountInString(op_history.Option) > OPTION_HISTORY_MAX_LEN {
+		return false
+	}
+
+	tx := cdb.db.Model(&OptionHistory{}).
+		Where("role = ? AND option = ?", op_history.Role, op_history.Option).
+		Updates(map[string]interface{}{"count": gorm.Expr("count + 1"), "updated_at": time.Now()})
+	if tx.Error == nil && tx.RowsAffected == 0 {
+		op_history.Count = 1
+		tx = cdb.db.Create(op_history)
+	}
+	if tx.Error != nil {
+		log.Error("Failed to add new option history")
+		log.Error(tx.Error)
+		return false
+	}
+	return true
+}
+
+// PruneOptionHistory merges the duplicated inputs of each role into one row, and removes
+// all but the best limit ones of each role if limit > 0. It returns the rows removed.
+func (cdb *ClientDB) PruneOptionHistory(limit int) (int64, error) {
+	if cdb == nil || cdb.db == nil {
+		return 0, nil
+	}
+
+	var removed int64
+	err := cdb.db.Transaction(func(tx *gorm.DB) error {
+		var roles []string
+		if err := tx.Unscoped().Model(&OptionHistory{}).Distinct().Pluck("role", &roles).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		for _, role_name := range roles {
+			entries, err := (&ClientDB{db: tx}).OptionEntries(role_name)
+			if err != nil {
+				return err
+			}
+			kept := RankOptionEntries(entries, limit, now)
+			hits := map[string]OptionEntry{}
+			for _, entry := range entries {
+				hits[entry.Option] = entry
+			}
+
+			// soft deleted rows are gone as well
+			result := tx.Unscoped().Where("role = ?", role_name).Delete(&OptionHistory{})
+			if result.Error != nil {
+				return result.Error
+			}
+			removed += result.RowsAffected
+
+			for _, option := range kept {
+				entry := hits[option]
+				record := &OptionHistory{Role: role_name, Option: option, Count: entry.Hits}
+				record.CreatedAt = entry.LastUsed
+				record.UpdatedAt = entry.LastUsed
+				if err = tx.Create(record).Error; err != nil {
+					return err
+				}
+				removed--
+			}
+		}
+		return nil
+	})
+	return removed, err
 }
 
 func (cdb *ClientDB) AddChatHistory(chat_history *model.ConversationHistory) bool {
@@ -88,6 +192,236 @@ func (cdb *ClientDB) AddChatHistory(chat_history *model.ConversationHistory) boo
 	return false
 }
 
+func (cdb *ClientDB) AddShellHistory(shell_history *ShellHistory) bool {
+	if cdb == nil || cdb.db == nil || shell_history == nil {
+		return false
+	}
+
+	shell_history.Request = TruncateStr(shell_history.Request, 1024)
+	shell_history.Command = TruncateStr(shell_history.Command, 1024)
+	shell_history.Explanation = TruncateStr(shell_history.Explanation, 2048)
+	tx := cdb.db.Create(shell_history)
+	if tx.Error != nil {
+		log.Error("Failed to add new shell history")
+		log.Error(tx.Error)
+		return false
+	}
+	return true
+}
+
+func (cdb *ClientDB) AddGeneratedImage(image *GeneratedImage) bool {
+	if cdb == nil || cdb.db == nil || image == nil {
+		return false
+	}
+
+	image.Path = TruncateStr(image.Path, 1024)
+	tx := cdb.db.Create(image)
+	if tx.Error != nil {
+		log.Error("Failed to add new generated image")
+		log.Error(tx.Error)
+		return false
+	}
+	return true
+}
+
+// SaveVocabEntry adds the word into the vocabulary notebook, or refreshes its senses and sentence if it is already there
+func (cdb *ClientDB) SaveVocabEntry(entry *VocabEntry) bool {
+	if cdb == nil || cdb.db == nil || entry == nil {
+		return false
+	}
+
+	entry.Word = TruncateStr(entry.Word, 128)
+	entry.Sentence = TruncateStr(entry.Sentence, 1024)
+	existing := &VocabEntry{}
+	tx := cdb.db.Where("word = ? AND language = ?", entry.Word, entry.Language).Limit(1).Find(existing)
+	if tx.Error == nil && tx.RowsAffected > 0 {
+		existing.Senses = entry.Senses
+		if len(entry.Sentence) > 0 {
+			existing.Sentence = entry.Sentence
+		}
+		*entry = *existing
+	} else {
+		entry.Box = 1
+		entry.DueAt = time.Now()
+	}
+
+	if tx = cdb.db.Save(entry); tx.Error != nil {
+		log.Error("Failed to save vocabulary entry")
+		log.Error(tx.Error)
+		return false
+	}
+	return true
+}
+
+// ListVocabEntries returns the latest looked up words first, limit <= 0 means all of them
+func (cdb *ClientDB) ListVocabEntries(limit int) ([]VocabEntry, error) {
+	records := []VocabEntry{}
+	if cdb == nil || cdb.db == nil {
+		return records, nil
+	}
+
+	tx := cdb.db.Order("updated_at desc")
+	if limit > 0 {
+		tx = tx.Limit(limit)
+	}
+	tx = tx.Find(&records)
+	return records, tx.Error
+}
+
+// DueVocabEntries returns the words to review at the moment, the most overdue first
+func (cdb *ClientDB) DueVocabEntries(now time.Time, limit int) ([]VocabEntry, error) {
+	records := []VocabEntry{}
+	if cdb == nil || cdb.db == nil {
+		return records, nil
+	}
+
+	tx := cdb.db.Where("due_at <= ?", now).Order("due_at")
+	if limit > 0 {
+		tx = tx.Limit(limit)
+	}
+	tx = tx.Find(&records)
+	return records, tx.Error
+}
+
+func (cdb *ClientDB) UpdateVocabEntry(entry *VocabEntry) bool {
+	if cdb == nil || cdb.db == nil || entry == nil {
+		return false
+	}
+
+	tx := cdb.db.Save(entry)
+	if tx.Error != nil {
+		log.Error("Failed to update vocabulary entry")
+		log.Error(tx.Error)
+		return false
+	}
+	return true
+}
+
+func (cdb *ClientDB) GetContentCache(kind string, key string) *ContentCache {
+	if cdb == nil || cdb.db == nil {
+		return nil
+	}
+
+	cache := &ContentCache{}
+	tx := cdb.db.Where("kind = ? AND key = ?", kind, key).Limit(1).Find(cache)
+	if tx.Error != nil {
+		log.Error("Failed to load content cache: ", tx.Error)
+		return nil
+	}
+	if tx.RowsAffected == 0 {
+		return nil
+	}
+	return cache
+}
+
+func (cdb *ClientDB) SaveContentCache(cache *ContentCache) bool {
+	if cdb == nil || cdb.db == nil || cache == nil {
+		return false
+	}
+
+	// only keep one entry for each key
+	cache.Size = len(cache.Content)
+	if existing := cdb.GetContentCache(cache.Kind, cache.Key); existing != nil {
+		cache.ID = existing.ID
+		cache.CreatedAt = existing.CreatedAt
+	}
+	tx := cdb.db.Save(cache)
+	if tx.Error != nil {
+		log.Error("Failed to save content cache")
+		log.Error(tx.Error)
+		return false
+	}
+	return true
+}
+
+// ListContentCache returns all cache entries without their contents
+func (cdb *ClientDB) ListContentCache() ([]ContentCache, error) {
+	records := []ContentCache{}
+	if cdb == nil || cdb.db == nil {
+		return records, nil
+	}
+
+	tx := cdb.db.Omit("content").Order("kind, updated_at desc").Find(&records)
+	return records, tx.Error
+}
+
+// RecentURLs returns the URLs of the web pages fetched lately, the latest first
+func (cdb *ClientDB) RecentURLs(limit int) ([]string, error) {
+	urls := []string{}
+	if cdb == nil || cdb.db == nil {
+		return urls, nil
+	}
+
+	tx := cdb.db.Model(&ContentCache{}).Where("kind = ?", CACHE_KIND_WEB).Order("updated_at desc").Limit(limit).Pluck("key", &urls)
+	return urls, tx.Error
+}
+
+// ClearContentCache removes the cache entries of the kind, or all of them if kind is blank
+func (cdb *ClientDB) ClearContentCache(kind string) (int64, error) {
+	if cdb == nil || cdb.db == nil {
+		return 0, nil
+	}
+
+	tx := cdb.db.Unscoped()
+	if len(kind) > 0 {
+		tx = tx.Where("kind = ?", kind)
+	} else {
+		tx = tx.Where("1 = 1")
+	}
+	tx = tx.Delete(&ContentCache{})
+	return tx.RowsAffected, tx.Error
+}
+
+// TouchContentCache marks the entry as just used, so TrimContentCache keeps it longer
+func (cdb *ClientDB) TouchContentCache(cache *ContentCache) {
+	if cdb == nil || cdb.db == nil || cache == nil {
+		return
+	}
+	if tx := cdb.db.Model(cache).UpdateColumn("updated_at", time.Now()); tx.Error != nil {
+		log.Error("Failed to touch content cache: ", tx.Error)
+	}
+}
+
+// TrimContentCache removes the expired entries of the kind, and the least recently used ones beyond the limit
+func (cdb *ClientDB) TrimContentCache(kind string, limit int) (int64, error) {
+	if cdb == nil || cdb.db == nil {
+		return 0, nil
+	}
+
+	var removed int64
+	err := cdb.db.Transaction(func(tx *gorm.DB) error {
+		// a zero expiry means the entry never expires
+		result := tx.Unscoped().Where("kind = ? AND expires_at > ? AND expires_at < ?", kind, time.Time{}, time.Now()).Delete(&ContentCache{})
+		if result.Error != nil {
+			return result.Error
+		}
+		removed = result.RowsAffected
+		if limit <= 0 {
+			return nil
+		}
+
+		ids := []uint{}
+		result = tx.Model(&ContentCache{}).Where("kind = ?", kind).Order("updated_at desc").Offset(limit).Limit(-1).Pluck("id", &ids)
+		if result.Error != nil || len(ids) == 0 {
+			return result.Error
+		}
+		result = tx.Unscoped().Where("id IN ?", ids).Delete(&ContentCache{})
+		removed += result.RowsAffected
+		return result.Error
+	})
+	return removed, err
+}
+
+// parseDBTime parses the time returned by the aggregations of SQLite, which come back as text
+func parseDBTime(value string) time.Time {
+	for _, layout := range []string{"2006-01-02 15:04:05.999999999-07:00", time.RFC3339Nano, "2006-01-02 15:04:05"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
 func TruncateStr(str string, maxLen int) string {
 	if utf8.RuneCountInString(str) > maxLen {
 		// 如果字符串长度超过最大长度，则截取前maxLen个字符
@@ -0,0 +1,186 @@
+package clientdb
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOptionHistory(t *testing.T) {
+	assertions := require.New(t)
+
+	cdb, err := InitClientDB(filepath.Join(t.TempDir(), "xally.db"), false)
+	assertions.NoError(err)
+
+	for _, option := range []string{"hello", "web-summary https://a.com", "hello", "reset", "hello", "reset"} {
+		assertions.True(cdb.AddOptionHistory(&OptionHistory{Role: "expert", Option: option}))
+	}
+	assertions.True(cdb.AddOptionHistory(&OptionHistory{Role: "writer", Option: "draft"}))
+	assertions.False(cdb.AddOptionHistory(&OptionHistory{Role: "expert", Option: " "}))
+
+	entries, err := cdb.OptionEntries("expert")
+	assertions.NoError(err)
+	assertions.Len(entries, 3)
+	hits := map[string]int{}
+	for _, entry := range entries {
+		hits[entry.Option] = entry.Hits
+		assertions.WithinDuration(time.Now(), entry.LastUsed, time.Minute)
+	}
+	assertions.Equal(map[string]int{"hello": 3, "reset": 2, "web-summary https://a.com": 1}, hits)
+
+	// the most used one comes last for the up arrow
+	history, err := cdb.LoadOptionHistory("expert", 2)
+	assertions.NoError(err)
+	assertions.Equal([]string{"reset", "hello"}, history)
+
+	all, err := cdb.OptionEntries("")
+	assertions.NoError(err)
+	assertions.Len(all, 4)
+
+	removed, err := cdb.PruneOptionHistory(1)
+	assertions.NoError(err)
+	assertions.Equal(int64(2), removed)
+	history, err = cdb.LoadOptionHistory("expert", 0)
+	assertions.NoError(err)
+	assertions.Equal([]string{"hello"}, history)
+
+	entries, err = cdb.OptionEntries("expert")
+	assertions.NoError(err)
+	assertions.Equal(3, entries[0].Hits)
+}
+
+func TestRankOptionEntries(t *testing.T) {
+	assertions := require.New(t)
+
+	now := time.Now()
+	entries := []OptionEntry{
+		{Option: "old but frequent", Hits: 10, LastUsed: now.AddDate(0, -6, 0)},
+		{Option: "today", Hits: 1, LastUsed: now.Add(-time.Hour)},
+		{Option: "this week", Hits: 3, LastUsed: now.AddDate(0, 0, -3)},
+	}
+	assertions.Equal([]string{"old but frequent", "today", "this week"}, RankOptionEntries(entries, 0, now))
+	assertions.Equal([]string{"this week"}, RankOptionEntries(entries, 1, now))
+}
+
+func TestContentCache(t *testing.T) {
+	assertions := require.New(t)
+
+	cdb, err := InitClientDB(filepath.Join(t.TempDir(), "xally.db"), false)
+	assertions.NoError(err)
+
+	assertions.Nil(cdb.GetContentCache(CACHE_KIND_WEB, "https://a.com"))
+	assertions.True(cdb.SaveContentCache(&ContentCache{Kind: CACHE_KIND_WEB, Key: "https://a.com", ETag: `"v1"`, Content: []byte("<p>v1</p>")}))
+	assertions.True(cdb.SaveContentCache(&ContentCache{Kind: CACHE_KIND_FILE, Key: "/tmp/a.txt", Content: []byte("file")}))
+	assertions.True(cdb.SaveContentCache(&ContentCache{Kind: CACHE_KIND_ANSWER, Key: "hash", Content: []byte("answer")}))
+	assertions.False(cdb.SaveContentCache(nil))
+
+	// saving the same key again replaces the entry
+	first := cdb.GetContentCache(CACHE_KIND_WEB, "https://a.com")
+	assertions.NotNil(first)
+	assertions.True(cdb.SaveContentCache(&ContentCache{Kind: CACHE_KIND_WEB, Key: "https://a.com", ETag: `"v2"`, Content: []byte("<p>v2 page</p>")}))
+	entry := cdb.GetContentCache(CACHE_KIND_WEB, "https://a.com")
+	assertions.NotNil(entry)
+	assertions.Equal(first.ID, entry.ID)
+	assertions.Equal(`"v2"`, entry.ETag)
+	assertions.Equal([]byte("<p>v2 page</p>"), entry.Content)
+	assertions.Equal(len("<p>v2 page</p>"), entry.Size)
+
+	// the kind is part of the key
+	assertions.Nil(cdb.GetContentCache(CACHE_KIND_FILE, "https://a.com"))
+
+	records, err := cdb.ListContentCache()
+	assertions.NoError(err)
+	assertions.Len(records, 3)
+	kinds := []string{}
+	for _, record := range records {
+		kinds = append(kinds, record.Kind)
+		// listed without the contents
+		assertions.Empty(record.Content)
+		assertions.Positive(record.Size)
+	}
+	assertions.Equal([]string{CACHE_KIND_ANSWER, CACHE_KIND_FILE, CACHE_KIND_WEB}, kinds)
+
+	removed, err := cdb.ClearContentCache(CACHE_KIND_WEB)
+	assertions.NoError(err)
+	assertions.Equal(int64(1), removed)
+	assertions.Nil(cdb.GetContentCache(CACHE_KIND_WEB, "https://a.com"))
+	assertions.NotNil(cdb.GetContentCache(CACHE_KIND_FILE, "/tmp/a.txt"))
+
+	removed, err = cdb.ClearContentCache("")
+	assertions.NoError(err)
+	assertions.Equal(int64(2), removed)
+	records, err = cdb.ListContentCache()
+	assertions.NoError(err)
+	assertions.Empty(records)
+}
+
+func TestTrimContentCache(t *testing.T) {
+	assertions := require.New(t)
+
+	cdb, err := InitClientDB(filepath.Join(t.TempDir(), "xally.db"), false)
+	assertions.NoError(err)
+
+	now := time.Now()
+	for idx, key := range []string{"a", "b", "c", "d"} {
+		assertions.True(cdb.SaveContentCache(&ContentCache{Kind: CACHE_KIND_ANSWER, Key: key, Content: []byte(key), ExpiresAt: now.Add(time.Hour)}))
+		// keep the order of updated_at apart
+		time.Sleep(time.Duration(idx+1) * time.Millisecond)
+	}
+	assertions.True(cdb.SaveContentCache(&ContentCache{Kind: CACHE_KIND_ANSWER, Key: "old", ExpiresAt: now.Add(-time.Hour)}))
+	assertions.True(cdb.SaveContentCache(&ContentCache{Kind: CACHE_KIND_WEB, Key: "https://a.com", ExpiresAt: now.Add(-time.Hour)}))
+
+	// the oldest one is used again, so it outlives "b"
+	entry := cdb.GetContentCache(CACHE_KIND_ANSWER, "a")
+	assertions.NotNil(entry)
+	time.Sleep(5 * time.Millisecond)
+	cdb.TouchContentCache(entry)
+
+	removed, err := cdb.TrimContentCache(CACHE_KIND_ANSWER, 3)
+	assertions.NoError(err)
+	assertions.Equal(int64(2), removed)
+
+	assertions.Nil(cdb.GetContentCache(CACHE_KIND_ANSWER, "old"))
+	assertions.Nil(cdb.GetContentCache(CACHE_KIND_ANSWER, "b"))
+	for _, key := range []string{"a", "c", "d"} {
+		assertions.NotNil(cdb.GetContentCache(CACHE_KIND_ANSWER, key))
+	}
+	// other kinds are left alone
+	assertions.NotNil(cdb.GetContentCache(CACHE_KIND_WEB, "https://a.com"))
+}
+
+func TestVocabNotebook(t *testing.T) {
+	assertions := require.New(t)
+
+	cdb, err := InitClientDB(filepath.Join(t.TempDir(), "xally.db"), false)
+	assertions.NoError(err)
+
+	assertions.True(cdb.SaveVocabEntry(&VocabEntry{Word: "serendipity", Language: "en", Senses: "luck", Sentence: "pure serendipity"}))
+	assertions.True(cdb.SaveVocabEntry(&VocabEntry{Word: "serendipity", Language: "en", Senses: "happy accident"}))
+
+	entries, err := cdb.ListVocabEntries(0)
+	assertions.NoError(err)
+	assertions.Len(entries, 1)
+	assertions.Equal("happy accident", entries[0].Senses)
+	assertions.Equal("pure serendipity", entries[0].Sentence)
+	assertions.Equal(1, entries[0].Box)
+
+	now := time.Now()
+	due, err := cdb.DueVocabEntries(now, 0)
+	assertions.NoError(err)
+	assertions.Len(due, 1)
+
+	entry := &due[0]
+	entry.Review(true, now)
+	assertions.Equal(2, entry.Box)
+	assertions.True(cdb.UpdateVocabEntry(entry))
+	due, err = cdb.DueVocabEntries(now.AddDate(0, 0, 1), 0)
+	assertions.NoError(err)
+	assertions.Empty(due)
+
+	entry.Review(false, now)
+	assertions.Equal(1, entry.Box)
+	assertions.Equal(1, entry.Lapses)
+	assertions.Equal(2, entry.Reviews)
+}
@@ -0,0 +1,253 @@
+package secretstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"filippo.io/age"
+)
+
+// values in the YAML referring to the secrets in the store, e.g. secret://openai_api_key
+const SECRET_REF_PREFIX = "secret://"
+
+// environment variable of the passphrase, or an age identity (AGE-SECRET-KEY-1...)
+const ENV_SECRET_KEY = "XALLY_SECRET_KEY"
+
+// ErrNoKey is returned when neither the environment variable nor the prompt gives the key
+var ErrNoKey = errors.New("no key to unlock the secret store, set " + ENV_SECRET_KEY + " or run in a terminal")
+
+// KeyFunc asks for the passphrase, create is true when the store is about to be created
+type KeyFunc func(create bool) (string, error)
+
+// Store keeps the secrets in a file encrypted by age, with a scrypt passphrase or an X25519 identity
+type Store struct {
+	path string
+	ask  KeyFunc
+	// scrypt work factor (log2) to encrypt with, 0 for the default of age
+	WorkFactor int
+
+	key     string
+	secrets map[string]string
+	loaded  bool
+	mutex   sync.Mutex
+}
+
+// New creates the store on the file. The key comes from XALLY_SECRET_KEY, or ask if it is not set.
+func New(path string, ask KeyFunc) *Store {
+	return &Store{path: path, ask: ask}
+}
+
+func (s *Store) Path() string {
+	return s.path
+}
+
+// IsRef tells if the value refers to a secret, and returns the name of the secret
+func IsRef(value string) (string, bool) {
+	if strings.HasPrefix(value, SECRET_REF_PREFIX) {
+		return strings.TrimPrefix(value, SECRET_REF_PREFIX), true
+	}
+	return "", false
+}
+
+func Ref(name string) string {
+	return SECRET_REF_PREFIX + name
+}
+
+func (s *Store) Get(name string) (string, bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.load(); err != nil {
+		return "", false, err
+	}
+	value, ok := s.secrets[name]
+	return value, ok, nil
+}
+
+func (s *Store) Set(name string, value string) error {
+	if len(name) == 0 || strings.ContainsAny(name, " \t\r\n/") {
+		return fmt.Errorf("invalid secret name %q", name)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+	s.secrets[name] = value
+	return s.save()
+}
+
+// Remove deletes the secret, it returns false if there is no such secret
+func (s *Store) Remove(name string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.load(); err != nil {
+		return false, err
+	}
+	if _, ok := s.secrets[name]; !ok {
+		return false, nil
+	}
+	delete(s.secrets, name)
+	return true, s.save()
+}
+
+func (s *Store) Names() ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for name := range s.secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// load decrypts the store at the first access, a missing file is an empty store
+func (s *Store) load() error {
+	if s.loaded {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		s.secrets = map[string]string{}
+		s.loaded = true
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = s.unlock(false); err != nil {
+		return err
+	}
+	identity, err := s.identity()
+	if err != nil {
+		return err
+	}
+	reader, err := age.Decrypt(bytes.NewReader(data), identity)
+	if err != nil {
+		s.key = ""
+		return fmt.Errorf("failed to decrypt %s : %w", s.path, err)
+	}
+	plain, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+
+	secrets := map[string]string{}
+	if err = json.Unmarshal(plain, &secrets); err != nil {
+		return err
+	}
+	s.secrets = secrets
+	s.loaded = true
+	return nil
+}
+
+func (s *Store) save() error {
+	if err := s.unlock(true); err != nil {
+		return err
+	}
+	recipient, err := s.recipient()
+	if err != nil {
+		return err
+	}
+
+	plain, err := json.Marshal(s.secrets)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	writer, err := age.Encrypt(&buf, recipient)
+	if err != nil {
+		return err
+	}
+	if _, err = writer.Write(plain); err != nil {
+		return err
+	}
+	if err = writer.Close(); err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	// write into a temporary file first, so a failure never leaves a broken store
+	temp_file := s.path + ".tmp"
+	if err = os.WriteFile(temp_file, buf.Bytes(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(temp_file, s.path)
+}
+
+// unlock gets the key from the environment variable or asks for it once per session
+func (s *Store) unlock(create bool) error {
+	if len(s.key) > 0 {
+		return nil
+	}
+	if key := os.Getenv(ENV_SECRET_KEY); len(key) > 0 {
+		s.key = key
+		return nil
+	}
+	if s.ask == nil {
+		return ErrNoKey
+	}
+
+	if _, err := os.Stat(s.path); err == nil {
+		create = false
+	}
+	key, err := s.ask(create)
+	if err != nil {
+		return err
+	}
+	if len(key) == 0 {
+		return ErrNoKey
+	}
+	s.key = key
+	return nil
+}
+
+func (s *Store) identity() (age.Identity, error) {
+	if isAgeIdentity(s.key) {
+		return age.ParseX25519Identity(s.key)
+	}
+	return age.NewScryptIdentity(s.key)
+}
+
+func (s *Store) recipient() (age.Recipient, error) {
+	if isAgeIdentity(s.key) {
+		identity, err := age.ParseX25519Identity(s.key)
+		if err != nil {
+			return nil, err
+		}
+		return identity.Recipient(), nil
+	}
+
+	recipient, err := age.NewScryptRecipient(s.key)
+	if err != nil {
+		return nil, err
+	}
+	if s.WorkFactor > 0 {
+		recipient.SetWorkFactor(s.WorkFactor)
+	}
+	return recipient, nil
+}
+
+func isAgeIdentity(key string) bool {
+	return strings.HasPrefix(key, "AGE-SECRET-KEY-1")
+}
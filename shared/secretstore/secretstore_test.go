@@ -0,0 +1,74 @@
+package secretstore_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/robinmin/xally/shared/secretstore"
+	"github.com/stretchr/testify/require"
+)
+
+func newStore(path string, passphrase string) *secretstore.Store {
+	store := secretstore.New(path, func(create bool) (string, error) { return passphrase, nil })
+	store.WorkFactor = 10
+	return store
+}
+
+func TestStore(t *testing.T) {
+	assertions := require.New(t)
+	t.Setenv(secretstore.ENV_SECRET_KEY, "")
+
+	file_name := filepath.Join(t.TempDir(), "secrets.age")
+	store := newStore(file_name, "correct horse")
+	assertions.NoError(store.Set("openai_api_key", "sk-123"))
+	assertions.NoError(store.Set("app_token", "token"))
+	assertions.Error(store.Set("bad name", "x"))
+
+	info, err := os.Stat(file_name)
+	assertions.NoError(err)
+	assertions.Equal(os.FileMode(0600), info.Mode().Perm())
+	data, err := os.ReadFile(file_name)
+	assertions.NoError(err)
+	assertions.NotContains(string(data), "sk-123")
+
+	reopened := newStore(file_name, "correct horse")
+	value, found, err := reopened.Get("openai_api_key")
+	assertions.NoError(err)
+	assertions.True(found)
+	assertions.Equal("sk-123", value)
+
+	removed, err := reopened.Remove("app_token")
+	assertions.NoError(err)
+	assertions.True(removed)
+	names, err := newStore(file_name, "correct horse").Names()
+	assertions.NoError(err)
+	assertions.Equal([]string{"openai_api_key"}, names)
+
+	_, _, err = newStore(file_name, "wrong").Get("openai_api_key")
+	assertions.Error(err)
+	_, _, err = secretstore.New(file_name, nil).Get("openai_api_key")
+	assertions.ErrorIs(err, secretstore.ErrNoKey)
+}
+
+func TestStoreWithIdentity(t *testing.T) {
+	assertions := require.New(t)
+
+	identity, err := age.GenerateX25519Identity()
+	assertions.NoError(err)
+	t.Setenv(secretstore.ENV_SECRET_KEY, identity.String())
+
+	file_name := filepath.Join(t.TempDir(), "secrets.age")
+	assertions.NoError(secretstore.New(file_name, nil).Set("deepl_api_key", "dl-1"))
+	value, found, err := secretstore.New(file_name, nil).Get("deepl_api_key")
+	assertions.NoError(err)
+	assertions.True(found)
+	assertions.Equal("dl-1", value)
+
+	name, ok := secretstore.IsRef("secret://deepl_api_key")
+	assertions.True(ok)
+	assertions.Equal("deepl_api_key", name)
+	_, ok = secretstore.IsRef("sk-plain")
+	assertions.False(ok)
+}
@@ -0,0 +1,192 @@
+package translator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/robinmin/xally/shared/utility"
+)
+
+type DeepLTranslator struct {
+	api_key     string
+	endpoint    string
+	source_lang string
+	client      *http.Client
+
+	// glossary ids on DeepL, keyed by the glossary name
+	glossary_ids map[string]string
+	mutex        sync.Mutex
+}
+
+func NewDeepLTranslator(api_key string, endpoint string, glossary_source_lang string) *DeepLTranslator {
+	if len(api_key) == 0 {
+		api_key = os.Getenv("DEEPL_API_KEY")
+	}
+	return &DeepLTranslator{
+		api_key:      api_key,
+		endpoint:     strings.TrimRight(endpoint, "/"),
+		source_lang:  glossary_source_lang,
+		client:       utility.NewHTTPClient(0),
+		glossary_ids: map[string]string{},
+	}
+}
+
+func (*DeepLTranslator) Name() string {
+	return TRANSLATOR_DEEPL
+}
+
+func (t *DeepLTranslator) Translate(text string, target_lang string, glossary *Glossary) (string, error) {
+	if len(t.api_key) == 0 {
+		return "", ErrNotConfigured
+	}
+
+	values := url.Values{}
+	values.Set("text", text)
+	values.Set("target_lang", deeplTargetLang(target_lang))
+
+	// DeepL applies a glossary only with an explicit source language. The whole glossary is
+	// kept on DeepL, but only sent along when the text has any of its terms.
+	if !glossary.Filter(text).IsEmpty() && len(t.source_lang) > 0 && normalizeLang(t.source_lang) != normalizeLang(target_lang) {
+		glossary_id, err := t.ensureGlossary(glossary, target_lang)
+		if err != nil {
+			log.Error("Failed to create DeepL glossary, translate without it : ", err)
+		} else {
+			values.Set("source_lang", strings.ToUpper(normalizeLang(t.source_lang)))
+			values.Set("glossary_id", glossary_id)
+		}
+	}
+
+	var result struct {
+		Translations []struct {
+			Text string `json:"text"`
+		} `json:"translations"`
+	}
+	if err := t.request(http.MethodPost, "/translate", values, &result); err != nil {
+		return "", err
+	}
+	if len(result.Translations) == 0 {
+		return "", fmt.Errorf("empty response from DeepL")
+	}
+	return result.Translations[0].Text, nil
+}
+
+// Lookup is left to the other translators, DeepL has no dictionary API
+func (t *DeepLTranslator) Lookup(word string, target_lang string) (string, error) {
+	if len(t.api_key) == 0 {
+		return "", ErrNotConfigured
+	}
+	return "", ErrNotSupported
+}
+
+// ensureGlossary keeps one glossary for each language pair on DeepL, named with the hash
+// of its entries. The one of the current entries is looked up before creating it, and the
+// ones of the older entries are deleted, so the glossaries never pile up on the account.
+func (t *DeepLTranslator) ensureGlossary(glossary *Glossary, target_lang string) (string, error) {
+	source := normalizeLang(t.source_lang)
+	target := normalizeLang(target_lang)
+	prefix := "xally-" + source + "-" + target + "-"
+	name := prefix + glossary.Hash()[:12]
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if glossary_id, ok := t.glossary_ids[name]; ok {
+		return glossary_id, nil
+	}
+
+	var list struct {
+		Glossaries []struct {
+			GlossaryID string `json:"glossary_id"`
+			Name       string `json:"name"`
+		} `json:"glossaries"`
+	}
+	if err := t.request(http.MethodGet, "/glossaries", nil, &list); err != nil {
+		return "", err
+	}
+	glossary_id := ""
+	for _, item := range list.Glossaries {
+		switch {
+		case item.Name == name && len(glossary_id) == 0:
+			glossary_id = item.GlossaryID
+		case strings.HasPrefix(item.Name, prefix):
+			if err := t.request(http.MethodDelete, "/glossaries/"+url.PathEscape(item.GlossaryID), nil, nil); err != nil {
+				log.Error("Failed to delete the outdated DeepL glossary ", item.Name, " : ", err)
+			}
+		}
+	}
+
+	if len(glossary_id) == 0 {
+		values := url.Values{}
+		values.Set("name", name)
+		values.Set("source_lang", source)
+		values.Set("target_lang", target)
+		values.Set("entries", glossary.TSV())
+		values.Set("entries_format", "tsv")
+
+		var result struct {
+			GlossaryID string `json:"glossary_id"`
+		}
+		if err := t.request(http.MethodPost, "/glossaries", values, &result); err != nil {
+			return "", err
+		}
+		if len(result.GlossaryID) == 0 {
+			return "", fmt.Errorf("no glossary id from DeepL")
+		}
+		glossary_id = result.GlossaryID
+	}
+	t.glossary_ids[name] = glossary_id
+	return glossary_id, nil
+}
+
+// request sends the form values to DeepL, and decodes the response into val unless it is nil
+func (t *DeepLTranslator) request(method string, suffix string, values url.Values, val interface{}) error {
+	var body io.Reader
+	if values != nil {
+		body = strings.NewReader(values.Encode())
+	}
+	req, err := http.NewRequest(method, t.endpoint+suffix, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "DeepL-Auth-Key "+t.api_key)
+	if values != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("DeepL returns %d : %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if val == nil {
+		return nil
+	}
+	return json.Unmarshal(data, val)
+}
+
+// deeplTargetLang maps the language preference into the target language code of DeepL
+func deeplTargetLang(lang string) string {
+	switch code := normalizeLang(lang); code {
+	case "en":
+		return "EN-US"
+	case "pt":
+		return "PT-BR"
+	default:
+		return strings.ToUpper(code)
+	}
+}
@@ -0,0 +1,60 @@
+package translator
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DictTranslator looks up the words in a local CSV dictionary (word, meaning)
+type DictTranslator struct {
+	path    string
+	entries map[string]string
+	once    sync.Once
+}
+
+func NewDictTranslator(path string) *DictTranslator {
+	return &DictTranslator{path: path}
+}
+
+func (*DictTranslator) Name() string {
+	return TRANSLATOR_DICT
+}
+
+// Translate only works when the whole text is a word in the dictionary
+func (t *DictTranslator) Translate(text string, target_lang string, glossary *Glossary) (string, error) {
+	return t.Lookup(text, target_lang)
+}
+
+func (t *DictTranslator) Lookup(word string, target_lang string) (string, error) {
+	t.once.Do(t.load)
+	if len(t.entries) == 0 {
+		return "", ErrNotConfigured
+	}
+
+	if meaning, ok := t.entries[strings.ToLower(strings.TrimSpace(word))]; ok {
+		return meaning, nil
+	}
+	return "", ErrNotSupported
+}
+
+func (t *DictTranslator) load() {
+	t.entries = map[string]string{}
+	if len(t.path) == 0 {
+		return
+	}
+
+	entries, err := readCSVPairs(t.path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Error("Failed to load the local dictionary : ", err)
+		}
+		return
+	}
+	for _, entry := range entries {
+		t.entries[strings.ToLower(entry.Source)] = entry.Target
+	}
+}
@@ -0,0 +1,135 @@
+package translator
+
+import (
+	"crypto/sha1"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"strings"
+)
+
+type GlossaryEntry struct {
+	Source string
+	Target string
+}
+
+// Glossary keeps the terms translated in a fixed way, e.g. product names
+type Glossary struct {
+	Entries []GlossaryEntry
+}
+
+// LoadGlossary merges the CSV files (source term, target term) in order, the
+// later files win on the same source term. Missing files are skipped.
+func LoadGlossary(files ...string) (*Glossary, error) {
+	glossary := &Glossary{}
+	index := map[string]int{}
+
+	for _, file_name := range files {
+		if len(file_name) == 0 {
+			continue
+		}
+		entries, err := readCSVPairs(file_name)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return glossary, err
+		}
+
+		for _, entry := range entries {
+			key := strings.ToLower(entry.Source)
+			if idx, ok := index[key]; ok {
+				glossary.Entries[idx] = entry
+			} else {
+				index[key] = len(glossary.Entries)
+				glossary.Entries = append(glossary.Entries, entry)
+			}
+		}
+	}
+	return glossary, nil
+}
+
+func (glossary *Glossary) IsEmpty() bool {
+	return glossary == nil || len(glossary.Entries) == 0
+}
+
+// Filter returns the entries used in the text only
+func (glossary *Glossary) Filter(text string) *Glossary {
+	filtered := &Glossary{}
+	if glossary.IsEmpty() {
+		return filtered
+	}
+
+	lower_text := strings.ToLower(text)
+	for _, entry := range glossary.Entries {
+		if strings.Contains(lower_text, strings.ToLower(entry.Source)) {
+			filtered.Entries = append(filtered.Entries, entry)
+		}
+	}
+	return filtered
+}
+
+// TSV renders the entries in the format of DeepL glossary API
+func (glossary *Glossary) TSV() string {
+	var sb strings.Builder
+	for _, entry := range glossary.Entries {
+		sb.WriteString(entry.Source + "\t" + entry.Target + "\n")
+	}
+	return sb.String()
+}
+
+func (glossary *Glossary) Hash() string {
+	sum := sha1.Sum([]byte(glossary.TSV()))
+	return hex.EncodeToString(sum[:])
+}
+
+// readCSVPairs loads the first two columns of each row, an optional header like `source,target` is skipped
+func readCSVPairs(file_name string) ([]GlossaryEntry, error) {
+	file, err := os.Open(file_name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+
+	entries := []GlossaryEntry{}
+	for row := 0; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return entries, err
+		}
+		if len(record) < 2 {
+			continue
+		}
+
+		source := strings.TrimSpace(record[0])
+		target := strings.TrimSpace(record[1])
+		if row == 0 && isHeader(source) {
+			continue
+		}
+		// tabs and new lines are not allowed in the DeepL glossary
+		if len(source) == 0 || len(target) == 0 || strings.ContainsAny(source+target, "\t\r\n") {
+			continue
+		}
+		entries = append(entries, GlossaryEntry{Source: source, Target: target})
+	}
+	return entries, nil
+}
+
+func isHeader(column string) bool {
+	switch strings.ToLower(column) {
+	case "source", "term", "word":
+		return true
+	default:
+		return false
+	}
+}
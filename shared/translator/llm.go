@@ -0,0 +1,44 @@
+package translator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/robinmin/xally/config"
+)
+
+// LLMTranslator translates with the chat model, glossaries are injected into the prompt
+type LLMTranslator struct {
+	ask AskFunc
+}
+
+func NewLLMTranslator(ask AskFunc) *LLMTranslator {
+	return &LLMTranslator{ask: ask}
+}
+
+func (*LLMTranslator) Name() string {
+	return TRANSLATOR_LLM
+}
+
+func (t *LLMTranslator) Translate(text string, target_lang string, glossary *Glossary) (string, error) {
+	if t.ask == nil {
+		return "", ErrNotConfigured
+	}
+
+	system_prompt := fmt.Sprintf(config.Text("prompt_translator_translate"), languageName(target_lang))
+	if glossary = glossary.Filter(text); !glossary.IsEmpty() {
+		var sb strings.Builder
+		for _, entry := range glossary.Entries {
+			sb.WriteString("\n- " + entry.Source + " => " + entry.Target)
+		}
+		system_prompt = system_prompt + "\n" + config.Text("prompt_translator_glossary") + sb.String()
+	}
+	return t.ask(system_prompt, text)
+}
+
+func (t *LLMTranslator) Lookup(word string, target_lang string) (string, error) {
+	if t.ask == nil {
+		return "", ErrNotConfigured
+	}
+	return t.ask(fmt.Sprintf(config.Text("prompt_translator_lookup"), languageName(target_lang)), word)
+}
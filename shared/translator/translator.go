@@ -0,0 +1,130 @@
+package translator
+
+import (
+	"errors"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/robinmin/xally/config"
+)
+
+const (
+	TRANSLATOR_DEEPL = "deepl"
+	TRANSLATOR_LLM   = "llm"
+	TRANSLATOR_DICT  = "dict"
+)
+
+// ErrNotConfigured is returned by translators missing their API key, dictionary and so on
+var ErrNotConfigured = errors.New("translator is not configured")
+
+// ErrNotSupported is returned when a translator can not handle the request at all
+var ErrNotSupported = errors.New("not supported by the translator")
+
+var errEmptyResult = errors.New("empty result")
+
+// Translator translates text into the target language. target_lang is the
+// language preference of xally, e.g. CN, EN, JP or a locale like en_US.UTF-8.
+type Translator interface {
+	Name() string
+	Translate(text string, target_lang string, glossary *Glossary) (string, error)
+	Lookup(word string, target_lang string) (string, error)
+}
+
+// AskFunc sends the text to the model with the system prompt and returns the answer
+type AskFunc func(system_prompt string, text string) (string, error)
+
+type Options struct {
+	DeepLAPIKey    string
+	DeepLEndpoint  string
+	DictionaryPath string
+	// source language of the glossaries, DeepL needs it to apply a glossary
+	GlossarySourceLang string
+	Ask                AskFunc
+}
+
+// Chain tries the translators in order until one of them gives a non-blank result
+type Chain struct {
+	translators []Translator
+}
+
+func NewChain(names []string, opts *Options) *Chain {
+	chain := &Chain{}
+	for _, name := range names {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case TRANSLATOR_DEEPL:
+			chain.translators = append(chain.translators, NewDeepLTranslator(opts.DeepLAPIKey, opts.DeepLEndpoint, opts.GlossarySourceLang))
+		case TRANSLATOR_LLM:
+			chain.translators = append(chain.translators, NewLLMTranslator(opts.Ask))
+		case TRANSLATOR_DICT:
+			chain.translators = append(chain.translators, NewDictTranslator(opts.DictionaryPath))
+		default:
+			log.Error("Unknown translator : ", name)
+		}
+	}
+	return chain
+}
+
+func (chain *Chain) Translate(text string, target_lang string, glossary *Glossary) (string, error) {
+	return chain.run(func(t Translator) (string, error) {
+		return t.Translate(text, target_lang, glossary)
+	})
+}
+
+func (chain *Chain) Lookup(word string, target_lang string) (string, error) {
+	return chain.run(func(t Translator) (string, error) {
+		return t.Lookup(word, target_lang)
+	})
+}
+
+func (chain *Chain) run(fn func(t Translator) (string, error)) (string, error) {
+	failures := []string{}
+	configured := false
+	for _, t := range chain.translators {
+		result, err := fn(t)
+		if err == nil && len(strings.TrimSpace(result)) > 0 {
+			return result, nil
+		}
+		if err == nil {
+			err = errEmptyResult
+		}
+
+		if errors.Is(err, ErrNotConfigured) {
+			log.Debugf("Skip translator %s : %s", t.Name(), err.Error())
+			continue
+		}
+		configured = true
+		if errors.Is(err, ErrNotSupported) || errors.Is(err, errEmptyResult) {
+			log.Debugf("Skip translator %s : %s", t.Name(), err.Error())
+		} else {
+			log.Errorf("Translator %s failed : %s", t.Name(), err.Error())
+		}
+		failures = append(failures, t.Name()+": "+err.Error())
+	}
+
+	if !configured {
+		return "", ErrNotConfigured
+	}
+	return "", errors.New(strings.Join(failures, "; "))
+}
+
+// languageName maps the language preference into the English name of the language
+func languageName(lang string) string {
+	switch normalizeLang(lang) {
+	case "zh":
+		return "Chinese"
+	case "ja":
+		return "Japanese"
+	default:
+		return "English"
+	}
+}
+
+// normalizeLang maps the language preference into its primary language subtag, e.g. zh for zh_TW.UTF-8
+func normalizeLang(lang string) string {
+	tag := config.ParseLanguageTag(lang)
+	if len(tag) == 0 {
+		return config.DEFAULT_LANGUAGE
+	}
+	return strings.SplitN(tag, "-", 2)[0]
+}
@@ -0,0 +1,162 @@
+package translator_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/robinmin/xally/shared/translator"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, dir string, name string, content string) string {
+	file_name := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(file_name, []byte(content), 0644))
+	return file_name
+}
+
+func TestLoadGlossary(t *testing.T) {
+	assertions := require.New(t)
+
+	dir := t.TempDir()
+	global := writeFile(t, dir, "global.csv", "source,target\n# comment\nXally,艾莉\nprompt,提示词\n")
+	project := writeFile(t, dir, "project.csv", "xally, X-Ally\nbroken\n")
+
+	glossary, err := translator.LoadGlossary(global, filepath.Join(dir, "missing.csv"), project)
+	assertions.NoError(err)
+	assertions.Equal([]translator.GlossaryEntry{
+		{Source: "xally", Target: "X-Ally"},
+		{Source: "prompt", Target: "提示词"},
+	}, glossary.Entries)
+
+	filtered := glossary.Filter("Write a Prompt")
+	assertions.Equal("prompt\t提示词\n", filtered.TSV())
+	assertions.True(glossary.Filter("nothing").IsEmpty())
+}
+
+func TestChainFallback(t *testing.T) {
+	assertions := require.New(t)
+
+	dict := writeFile(t, t.TempDir(), "dict.csv", "word,meaning\nhello,你好\n")
+	var asked string
+	chain := translator.NewChain([]string{"dict", "llm"}, &translator.Options{
+		DictionaryPath: dict,
+		Ask: func(system_prompt string, text string) (string, error) {
+			asked = system_prompt
+			return "[llm] " + text, nil
+		},
+	})
+
+	msg, err := chain.Lookup("Hello", "CN")
+	assertions.NoError(err)
+	assertions.Equal("你好", msg)
+	assertions.Empty(asked)
+
+	glossary := &translator.Glossary{Entries: []translator.GlossaryEntry{{Source: "xally", Target: "X-Ally"}}}
+	msg, err = chain.Translate("use xally", "CN", glossary)
+	assertions.NoError(err)
+	assertions.Equal("[llm] use xally", msg)
+	assertions.Contains(asked, "- xally => X-Ally")
+
+	_, err = translator.NewChain([]string{"dict"}, &translator.Options{}).Translate("hello", "CN", nil)
+	assertions.True(errors.Is(err, translator.ErrNotConfigured))
+
+	failing := translator.NewChain([]string{"llm"}, &translator.Options{
+		Ask: func(string, string) (string, error) { return "", errors.New("boom") },
+	})
+	_, err = failing.Translate("hello", "CN", nil)
+	assertions.ErrorContains(err, "llm: boom")
+}
+
+func TestDeepLGlossary(t *testing.T) {
+	assertions := require.New(t)
+
+	created, deleted := []string{}, []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assertions.Equal("DeepL-Auth-Key secret", r.Header.Get("Authorization"))
+		assertions.NoError(r.ParseForm())
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/glossaries":
+			// the one of the older entries, and another language pair
+			list := `{"glossaries":[{"glossary_id":"g-old","name":"xally-en-zh-000000000000"},{"glossary_id":"g-ja","name":"xally-en-ja-000000000000"}`
+			for _, name := range created {
+				list += `,{"glossary_id":"g-1","name":"` + name + `"}`
+			}
+			w.Write([]byte(list + "]}"))
+		case r.Method == http.MethodDelete:
+			deleted = append(deleted, strings.TrimPrefix(r.URL.Path, "/glossaries/"))
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodPost && r.URL.Path == "/glossaries":
+			assertions.Equal("en", r.Form.Get("source_lang"))
+			assertions.Equal("zh", r.Form.Get("target_lang"))
+			// all the entries, not only the ones in the text
+			assertions.Equal("xally\t艾莉\nprompt\t提示词\n", r.Form.Get("entries"))
+			created = append(created, r.Form.Get("name"))
+			w.Write([]byte(`{"glossary_id":"g-1"}`))
+		case r.URL.Path == "/translate":
+			assertions.Equal("ZH", r.Form.Get("target_lang"))
+			if strings.Contains(r.Form.Get("text"), "xally") {
+				assertions.Equal("EN", r.Form.Get("source_lang"))
+				assertions.Equal("g-1", r.Form.Get("glossary_id"))
+			} else {
+				assertions.Empty(r.Form.Get("glossary_id"))
+			}
+			w.Write([]byte(`{"translations":[{"text":"译文"}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	glossary := &translator.Glossary{Entries: []translator.GlossaryEntry{{Source: "xally", Target: "艾莉"}, {Source: "prompt", Target: "提示词"}}}
+	deepl := translator.NewDeepLTranslator("secret", server.URL+"/", "EN")
+	for _, text := range []string{"hello xally", "hello again xally", "plain text"} {
+		msg, err := deepl.Translate(text, "CN", glossary)
+		assertions.NoError(err)
+		assertions.Equal("译文", msg)
+	}
+	assertions.Len(created, 1)
+	assertions.Equal([]string{"g-old"}, deleted)
+
+	// a new translator, e.g. after reloading the configuration, finds the glossary on DeepL
+	deepl = translator.NewDeepLTranslator("secret", server.URL+"/", "EN")
+	_, err := deepl.Translate("hello xally", "CN", glossary)
+	assertions.NoError(err)
+	assertions.Len(created, 1)
+
+	_, err = deepl.Lookup("hello", "CN")
+	assertions.True(errors.Is(err, translator.ErrNotSupported))
+}
+
+func TestChainSkipsEmptyResult(t *testing.T) {
+	assertions := require.New(t)
+
+	dict := writeFile(t, t.TempDir(), "dict.csv", "word,meaning\nhello,你好\n")
+	answer := ""
+	chain := translator.NewChain([]string{"deepl", "llm", "dict"}, &translator.Options{
+		DeepLAPIKey:    "secret",
+		DeepLEndpoint:  "http://127.0.0.1:0",
+		DictionaryPath: dict,
+		Ask: func(string, string) (string, error) {
+			return answer, nil
+		},
+	})
+
+	// DeepL can not look up, and the blank answer of the model falls to the dictionary
+	msg, err := chain.Lookup("hello", "CN")
+	assertions.NoError(err)
+	assertions.Equal("你好", msg)
+
+	answer = "hello: 你好，问候语"
+	msg, err = chain.Lookup("hello", "CN")
+	assertions.NoError(err)
+	assertions.Equal(answer, msg)
+
+	answer = "  "
+	_, err = chain.Lookup("world", "CN")
+	assertions.ErrorContains(err, "llm: empty result")
+}
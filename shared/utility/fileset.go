@@ -0,0 +1,265 @@
+package utility
+
+import (
+	"bufio"
+	"bytes"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// CollectFiles expands the given file names, directories and glob patterns
+// (including `**`) into a stable, de-duplicated list of regular files.
+// Directories and globs are walked in lexical order and respect .gitignore;
+// plain file names are always kept as they are.
+func CollectFiles(patterns []string) ([]string, error) {
+	files := []string{}
+	seen := map[string]bool{}
+
+	for _, pattern := range patterns {
+		var matched []string
+		var err error
+
+		if info, stat_err := os.Stat(pattern); stat_err == nil {
+			if info.IsDir() {
+				matched, err = walkFiles(pattern, nil)
+			} else {
+				matched = []string{pattern}
+			}
+		} else if hasGlobMeta(pattern) {
+			glob_pattern := filepath.ToSlash(filepath.Clean(pattern))
+			matched, err = walkFiles(globBase(glob_pattern), func(file_name string) bool {
+				return MatchGlob(glob_pattern, filepath.ToSlash(file_name))
+			})
+		} else {
+			err = stat_err
+		}
+		if err != nil {
+			return files, err
+		}
+
+		for _, file_name := range matched {
+			if !seen[file_name] {
+				seen[file_name] = true
+				files = append(files, file_name)
+			}
+		}
+	}
+	return files, nil
+}
+
+// MatchGlob reports whether name matches the slash separated pattern. On top
+// of path.Match it supports `**` to match zero or more path segments.
+func MatchGlob(pattern string, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern []string, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// collapse consecutive `**` and try every possible split point
+			for len(pattern) > 0 && pattern[0] == "**" {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], name[0]); err != nil || !ok {
+			return false
+		}
+		pattern = pattern[1:]
+		name = name[1:]
+	}
+	return len(name) == 0
+}
+
+// IsBinaryContent guesses whether data is binary by looking for NUL bytes in the leading part
+func IsBinaryContent(data []byte) bool {
+	if len(data) > 8000 {
+		data = data[:8000]
+	}
+	return bytes.IndexByte(data, 0) >= 0
+}
+
+// rough bytes of a token in English text and code, to keep the contents within the token budgets
+const BYTES_PER_TOKEN = 4
+
+// EstimateTokens roughly counts the tokens of size bytes of text
+func EstimateTokens(size int) int {
+	return (size + BYTES_PER_TOKEN - 1) / BYTES_PER_TOKEN
+}
+
+func hasGlobMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// globBase returns the longest leading directory of pattern without any glob meta characters
+func globBase(pattern string) string {
+	segments := strings.Split(pattern, "/")
+	base := []string{}
+	for _, segment := range segments[:len(segments)-1] {
+		if hasGlobMeta(segment) {
+			break
+		}
+		base = append(base, segment)
+	}
+	if len(base) == 0 {
+		return "."
+	}
+	if len(base) == 1 && base[0] == "" {
+		return "/"
+	}
+	return strings.Join(base, "/")
+}
+
+func walkFiles(root string, filter func(file_name string) bool) ([]string, error) {
+	files := []string{}
+	ignore := newIgnoreMatcher(root)
+
+	err := filepath.WalkDir(root, func(file_name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			if file_name != root && (entry.Name() == ".git" || ignore.Match(file_name, true)) {
+				return filepath.SkipDir
+			}
+			ignore.loadDir(file_name)
+			return nil
+		}
+
+		if !entry.Type().IsRegular() || ignore.Match(file_name, false) {
+			return nil
+		}
+		if filter == nil || filter(file_name) {
+			files = append(files, file_name)
+		}
+		return nil
+	})
+	return files, err
+}
+
+type ignoreRule struct {
+	base     string
+	pattern  string
+	negate   bool
+	dir_only bool
+	anchored bool
+}
+
+// ignoreMatcher implements the commonly used subset of the .gitignore rules
+type ignoreMatcher struct {
+	rules  []ignoreRule
+	loaded map[string]bool
+}
+
+func newIgnoreMatcher(root string) *ignoreMatcher {
+	matcher := &ignoreMatcher{loaded: map[string]bool{}}
+
+	abs_root, err := filepath.Abs(root)
+	if err != nil {
+		return matcher
+	}
+
+	// load .gitignore files from the enclosing repository down to the root
+	if _, err := os.Stat(filepath.Join(abs_root, ".git")); err == nil {
+		return matcher
+	}
+	parents := []string{}
+	for dir := filepath.Dir(abs_root); dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		parents = append([]string{dir}, parents...)
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			for _, parent := range parents {
+				matcher.loadDir(parent)
+			}
+			break
+		}
+	}
+	return matcher
+}
+
+func (m *ignoreMatcher) loadDir(dir string) {
+	abs_dir, err := filepath.Abs(dir)
+	if err != nil || m.loaded[abs_dir] {
+		return
+	}
+	m.loaded[abs_dir] = true
+
+	file, err := os.Open(filepath.Join(abs_dir, ".gitignore"))
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		rule := ignoreRule{base: abs_dir}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dir_only = true
+			line = strings.TrimRight(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			rule.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		rule.pattern = line
+		m.rules = append(m.rules, rule)
+	}
+}
+
+func (m *ignoreMatcher) Match(file_name string, is_dir bool) bool {
+	abs_name, err := filepath.Abs(file_name)
+	if err != nil {
+		return false
+	}
+
+	ignored := false
+	for _, rule := range m.rules {
+		if rule.dir_only && !is_dir {
+			continue
+		}
+
+		rel, err := filepath.Rel(rule.base, abs_name)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+
+		var matched bool
+		if rule.anchored {
+			matched = MatchGlob(rule.pattern, rel)
+		} else {
+			matched = MatchGlob(rule.pattern, path.Base(rel))
+		}
+		if matched {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
@@ -0,0 +1,59 @@
+package utility_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/robinmin/xally/shared/utility"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchGlob(t *testing.T) {
+	assertions := require.New(t)
+
+	assertions.True(utility.MatchGlob("cmd/**/*.go", "cmd/main.go"))
+	assertions.True(utility.MatchGlob("cmd/**/*.go", "cmd/client/service/plugin.go"))
+	assertions.False(utility.MatchGlob("cmd/**/*.go", "config/config.go"))
+	assertions.False(utility.MatchGlob("*.go", "cmd/main.go"))
+	assertions.True(utility.MatchGlob("**", "a/b/c"))
+}
+
+func TestCollectFiles(t *testing.T) {
+	assertions := require.New(t)
+
+	root := t.TempDir()
+	for _, name := range []string{".git/HEAD", "b.go", "a.go", "sub/c.go", "sub/d.txt", "build/e.go", "sub/keep.log", "sub/drop.log"} {
+		full_name := filepath.Join(root, name)
+		assertions.NoError(os.MkdirAll(filepath.Dir(full_name), 0755))
+		assertions.NoError(os.WriteFile(full_name, []byte(name), 0644))
+	}
+	assertions.NoError(os.WriteFile(filepath.Join(root, ".gitignore"), []byte("build/\n*.log\n!keep.log\n"), 0644))
+
+	files, err := utility.CollectFiles([]string{root})
+	assertions.NoError(err)
+	assertions.Equal([]string{
+		filepath.Join(root, ".gitignore"),
+		filepath.Join(root, "a.go"),
+		filepath.Join(root, "b.go"),
+		filepath.Join(root, "sub/c.go"),
+		filepath.Join(root, "sub/d.txt"),
+		filepath.Join(root, "sub/keep.log"),
+	}, files)
+
+	files, err = utility.CollectFiles([]string{filepath.Join(root, "**/*.go"), filepath.Join(root, "a.go")})
+	assertions.NoError(err)
+	assertions.Equal([]string{
+		filepath.Join(root, "a.go"),
+		filepath.Join(root, "b.go"),
+		filepath.Join(root, "sub/c.go"),
+	}, files)
+}
+
+func TestEstimateTokens(t *testing.T) {
+	assertions := require.New(t)
+
+	assertions.Equal(0, utility.EstimateTokens(0))
+	assertions.Equal(1, utility.EstimateTokens(3))
+	assertions.Equal(750, utility.EstimateTokens(3000))
+}
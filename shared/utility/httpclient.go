@@ -0,0 +1,136 @@
+package utility
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// NetworkSettings is how the outbound HTTP requests reach the internet, shared by the client and the server
+type NetworkSettings struct {
+	// http, https or socks5 URL of the proxy, the HTTP(S)_PROXY environment variables if empty
+	ProxyURL string
+	// hosts, domains (.example.com), IPs and CIDRs going direct, besides NO_PROXY
+	NoProxy []string
+	// PEM file of extra root certificates, e.g. of the TLS intercepting proxy
+	CABundle string
+}
+
+var (
+	network_mutex     sync.RWMutex
+	network_transport http.RoundTripper = http.DefaultTransport
+	replay_transport  *ReplayTransport
+
+	// HTTPTransport sends the requests through the transport set by SetupNetwork, so the
+	// clients created before a configuration reload follow the new settings as well
+	HTTPTransport http.RoundTripper = sharedTransport{replayable: true}
+)
+
+// sharedTransport goes through the replay set by SetupReplay if replayable
+type sharedTransport struct {
+	replayable bool
+}
+
+func (t sharedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	network_mutex.RLock()
+	transport := network_transport
+	replay := replay_transport
+	network_mutex.RUnlock()
+
+	if t.replayable && replay != nil {
+		return replay.RoundTrip(req)
+	}
+	return transport.RoundTrip(req)
+}
+
+// SetupReplay records all outbound requests of HTTPTransport into the folder, or serves them from it
+func SetupReplay(mode ReplayMode, dir string) error {
+	replay, err := NewReplayTransport(mode, dir, sharedTransport{})
+	if err != nil {
+		return err
+	}
+
+	network_mutex.Lock()
+	defer network_mutex.Unlock()
+	replay_transport = replay
+	return nil
+}
+
+// SetupNetwork applies the settings to all outbound HTTP requests, and keeps the current ones on error
+func SetupNetwork(settings NetworkSettings) error {
+	transport, err := NewTransport(settings)
+	if err != nil {
+		return err
+	}
+
+	network_mutex.Lock()
+	defer network_mutex.Unlock()
+	if old, ok := network_transport.(*http.Transport); ok && old != http.DefaultTransport {
+		old.CloseIdleConnections()
+	}
+	network_transport = transport
+	return nil
+}
+
+// NewTransport builds a transport with the proxy and the extra root certificates
+func NewTransport(settings NetworkSettings) (*http.Transport, error) {
+	proxy_cfg := httpproxy.FromEnvironment()
+	if len(settings.ProxyURL) > 0 {
+		proxy_url, err := url.Parse(settings.ProxyURL)
+		if err != nil || len(proxy_url.Host) == 0 {
+			return nil, fmt.Errorf("invalid proxy URL %q", settings.ProxyURL)
+		}
+		switch proxy_url.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, fmt.Errorf("unsupported proxy scheme %q, expect http, https or socks5", proxy_url.Scheme)
+		}
+		proxy_cfg.HTTPProxy = settings.ProxyURL
+		proxy_cfg.HTTPSProxy = settings.ProxyURL
+	}
+	no_proxy := []string{}
+	if len(proxy_cfg.NoProxy) > 0 {
+		no_proxy = append(no_proxy, proxy_cfg.NoProxy)
+	}
+	for _, item := range settings.NoProxy {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			no_proxy = append(no_proxy, item)
+		}
+	}
+	proxy_cfg.NoProxy = strings.Join(no_proxy, ",")
+	proxy_func := proxy_cfg.ProxyFunc()
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		return proxy_func(req.URL)
+	}
+
+	if len(settings.CABundle) > 0 {
+		pem, err := os.ReadFile(settings.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in CA bundle %s", settings.CABundle)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+	return transport, nil
+}
+
+// NewHTTPClient creates a client on the shared transport, no timeout if zero
+func NewHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{Transport: HTTPTransport, Timeout: timeout}
+}
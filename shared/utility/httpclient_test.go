@@ -0,0 +1,72 @@
+package utility
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTransportProxy(t *testing.T) {
+	assertions := require.New(t)
+	for _, name := range []string{"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY", "http_proxy", "https_proxy", "no_proxy"} {
+		t.Setenv(name, "")
+	}
+	t.Setenv("NO_PROXY", "env.example.com")
+
+	transport, err := NewTransport(NetworkSettings{
+		ProxyURL: "socks5://proxy.corp:1080",
+		NoProxy:  []string{".internal.corp", "10.0.0.0/8"},
+	})
+	assertions.NoError(err)
+
+	proxy_of := func(raw_url string) string {
+		req_url, _ := url.Parse(raw_url)
+		proxy_url, err := transport.Proxy(&http.Request{URL: req_url})
+		assertions.NoError(err)
+		if proxy_url == nil {
+			return ""
+		}
+		return proxy_url.String()
+	}
+	assertions.Equal("socks5://proxy.corp:1080", proxy_of("https://api.openai.com/v1/models"))
+	assertions.Equal("socks5://proxy.corp:1080", proxy_of("http://example.com/"))
+	assertions.Equal("", proxy_of("https://wiki.internal.corp/"))
+	assertions.Equal("", proxy_of("http://10.1.2.3/"))
+	assertions.Equal("", proxy_of("https://env.example.com/"))
+
+	_, err = NewTransport(NetworkSettings{ProxyURL: "ftp://proxy.corp"})
+	assertions.Error(err)
+	_, err = NewTransport(NetworkSettings{CABundle: filepath.Join(t.TempDir(), "missing.pem")})
+	assertions.Error(err)
+}
+
+func TestNewTransportCABundle(t *testing.T) {
+	assertions := require.New(t)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	// unknown authority without the bundle
+	transport, err := NewTransport(NetworkSettings{})
+	assertions.NoError(err)
+	_, err = (&http.Client{Transport: transport}).Get(server.URL)
+	assertions.Error(err)
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	assertions.NoError(os.WriteFile(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600))
+	assertions.NoError(SetupNetwork(NetworkSettings{CABundle: bundle}))
+	defer SetupNetwork(NetworkSettings{})
+
+	resp, err := NewHTTPClient(0).Get(server.URL)
+	assertions.NoError(err)
+	resp.Body.Close()
+	assertions.Equal(http.StatusOK, resp.StatusCode)
+}
@@ -0,0 +1,207 @@
+package utility
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+// the class/id heuristics below follow the ones used by Mozilla's Readability
+var (
+	rx_unlikely_candidates = regexp.MustCompile(`(?i)-ad-|ai2html|banner|breadcrumbs|combx|comment|community|consent|cookie|cover-wrap|disqus|extra|footer|gdpr|header|legends|menu|newsletter|related|remark|replies|rss|share|shoutbox|sidebar|skyscraper|social|sponsor|subscribe|supplemental|ad-break|agegate|pagination|pager|popup|modal|yom-remote`)
+	rx_maybe_candidate     = regexp.MustCompile(`(?i)and|article|body|column|content|main|shadow`)
+	rx_positive            = regexp.MustCompile(`(?i)article|body|content|entry|hentry|h-entry|main|page|post|text|blog|story`)
+	rx_negative            = regexp.MustCompile(`(?i)-ad-|hidden|banner|combx|comment|com-|contact|foot|footer|footnote|gdpr|masthead|media|meta|outbrain|promo|related|scroll|share|shoutbox|sidebar|skyscraper|sponsor|shopping|tags|tool|widget|cookie|nav`)
+)
+
+// minimal length of text to treat a semantic container (article, main) as the main content
+const min_article_text_len = 200
+
+// DecodeHTML converts the raw page into UTF-8, honouring the charset in the
+// Content-Type header first and then the BOM or <meta> declarations
+func DecodeHTML(body []byte, content_type string) (string, error) {
+	reader, err := charset.NewReader(bytes.NewReader(body), content_type)
+	if err != nil {
+		return string(body), err
+	}
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return string(body), err
+	}
+	return string(data), nil
+}
+
+// ExtractMainContent drops the boilerplate (navigation, banners, scripts,
+// footers and so on) and returns the HTML of the main article only. Code
+// blocks and tables inside the article are kept as they are.
+func ExtractMainContent(html_str string) (string, error) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html_str))
+	if err != nil {
+		return html_str, err
+	}
+
+	doc.Find("script,style,noscript,iframe,svg,canvas,form,button,input,select,textarea,template,link,meta,object,embed,dialog").Remove()
+	doc.Find("[role=navigation],[role=banner],[role=contentinfo],[role=complementary],[role=dialog],[aria-hidden=true]").Remove()
+	doc.Find("nav,aside").Remove()
+	doc.Find("header,footer").Each(func(_ int, s *goquery.Selection) {
+		// keep the headers of the article itself, it usually contains the title
+		if s.ParentsFiltered("article,main").Length() == 0 {
+			s.Remove()
+		}
+	})
+	doc.Find("body *").Each(func(_ int, s *goquery.Selection) {
+		if isUnlikelyCandidate(s) {
+			s.Remove()
+		}
+	})
+
+	top := findSemanticContainer(doc)
+	if top == nil {
+		top = findTopCandidate(doc)
+	}
+	if top == nil {
+		top = doc.Find("body").First()
+	}
+
+	return goquery.OuterHtml(top)
+}
+
+// StripHyperLinks replaces all hyper-links with their own text
+func StripHyperLinks(html_str string) (string, error) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html_str))
+	if err != nil {
+		return html_str, err
+	}
+
+	doc.Find("a").Each(func(_ int, s *goquery.Selection) {
+		// code blocks are kept untouched to avoid messing up the formatting
+		if s.ParentsFiltered("pre,code").Length() == 0 {
+			s.ReplaceWithSelection(s.Contents())
+		}
+	})
+	return doc.Html()
+}
+
+func isUnlikelyCandidate(s *goquery.Selection) bool {
+	switch goquery.NodeName(s) {
+	case "body", "article", "main", "pre", "code", "table", "thead", "tbody", "tr", "td", "th", "a":
+		return false
+	}
+
+	class_and_id := s.AttrOr("class", "") + " " + s.AttrOr("id", "")
+	if strings.TrimSpace(class_and_id) == "" {
+		return false
+	}
+	if !rx_unlikely_candidates.MatchString(class_and_id) || rx_maybe_candidate.MatchString(class_and_id) {
+		return false
+	}
+
+	// never drop any code block or table together with its container
+	return s.Find("pre,table").Length() == 0 && s.ParentsFiltered("article,main,pre,table").Length() == 0
+}
+
+func findSemanticContainer(doc *goquery.Document) *goquery.Selection {
+	var best *goquery.Selection
+	best_len := 0
+
+	doc.Find("article,main,[role=main],[itemprop=articleBody]").Each(func(_ int, s *goquery.Selection) {
+		text_len := len(strings.TrimSpace(s.Text()))
+		if text_len > best_len {
+			best = s
+			best_len = text_len
+		}
+	})
+	if best_len < min_article_text_len {
+		return nil
+	}
+	return best
+}
+
+func findTopCandidate(doc *goquery.Document) *goquery.Selection {
+	scores := map[*html.Node]float64{}
+	candidates := []*goquery.Selection{}
+
+	add_score := func(s *goquery.Selection, score float64) {
+		if s.Length() == 0 || goquery.NodeName(s) == "html" {
+			return
+		}
+		node := s.Get(0)
+		if _, ok := scores[node]; !ok {
+			scores[node] = initialScore(s)
+			candidates = append(candidates, s)
+		}
+		scores[node] += score
+	}
+
+	doc.Find("p,pre,td,blockquote,section,h2,h3").Each(func(_ int, s *goquery.Selection) {
+		text := strings.TrimSpace(s.Text())
+		if len(text) < 25 {
+			return
+		}
+
+		score := 1.0 + float64(strings.Count(text, ",")+strings.Count(text, "，"))
+		score += math.Min(float64(len(text))/100.0, 3.0)
+
+		add_score(s.Parent(), score)
+		add_score(s.Parent().Parent(), score/2)
+	})
+
+	var top *goquery.Selection
+	top_score := 0.0
+	for _, s := range candidates {
+		score := scores[s.Get(0)] * (1 - linkDensity(s))
+		if top == nil || score > top_score {
+			top = s
+			top_score = score
+		}
+	}
+	return top
+}
+
+func initialScore(s *goquery.Selection) float64 {
+	var score float64
+	switch goquery.NodeName(s) {
+	case "div":
+		score = 5
+	case "pre", "td", "blockquote":
+		score = 3
+	case "address", "ol", "ul", "dl", "dd", "dt", "li", "form":
+		score = -3
+	case "h1", "h2", "h3", "h4", "h5", "h6", "th":
+		score = -5
+	}
+
+	for _, attr := range []string{"class", "id"} {
+		value := s.AttrOr(attr, "")
+		if value == "" {
+			continue
+		}
+		if rx_negative.MatchString(value) {
+			score -= 25
+		}
+		if rx_positive.MatchString(value) {
+			score += 25
+		}
+	}
+	return score
+}
+
+func linkDensity(s *goquery.Selection) float64 {
+	text_len := len(strings.TrimSpace(s.Text()))
+	if text_len == 0 {
+		return 0
+	}
+
+	link_len := 0
+	s.Find("a").Each(func(_ int, a *goquery.Selection) {
+		link_len += len(strings.TrimSpace(a.Text()))
+	})
+	return float64(link_len) / float64(text_len)
+}
@@ -0,0 +1,52 @@
+package utility_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/robinmin/xally/shared/utility"
+	"github.com/stretchr/testify/require"
+)
+
+const sample_page = `<html><head><title>Demo</title><script>var tracking = 1;</script></head>
+<body>
+<nav><a href="/">Home</a> | <a href="/blog">Blog</a></nav>
+<div class="cookie-banner">We use cookies to improve your experience, please accept them all.</div>
+<div id="content" class="post">
+  <h1>Release notes</h1>
+  <p>This release brings a brand new plugin system, better caching, and a lot of fixes for the command line client.</p>
+  <p>Read the <a href="/docs">documentation</a> for details, examples, and the full list of supported commands.</p>
+  <pre><code>xally -c "web-summary https://example.com"</code></pre>
+  <table><tr><th>Command</th><th>Usage</th></tr><tr><td>web-summary</td><td>summarize a page</td></tr></table>
+</div>
+<div class="sidebar"><p>Related posts, trending topics, and other things nobody reads at all.</p></div>
+<footer>Copyright 2023, all rights reserved by whoever wrote this page.</footer>
+</body></html>`
+
+func TestExtractMainContent(t *testing.T) {
+	assertions := require.New(t)
+
+	content, err := utility.ExtractMainContent(sample_page)
+	assertions.NoError(err)
+	assertions.Contains(content, "brand new plugin system")
+	assertions.Contains(content, `<pre><code>xally -c &#34;web-summary https://example.com&#34;</code></pre>`)
+	assertions.Contains(content, "<td>web-summary</td>")
+	assertions.NotContains(content, "tracking")
+	assertions.NotContains(content, "cookies")
+	assertions.NotContains(content, "Related posts")
+	assertions.NotContains(content, "Copyright")
+
+	content, err = utility.StripHyperLinks(content)
+	assertions.NoError(err)
+	assertions.NotContains(content, "<a ")
+	assertions.Contains(content, "Read the documentation for details")
+}
+
+func TestDecodeHTML(t *testing.T) {
+	assertions := require.New(t)
+
+	page := []byte("<html><head><meta charset=\"iso-8859-1\"></head><body>caf\xe9</body></html>")
+	content, err := utility.DecodeHTML(page, "text/html")
+	assertions.NoError(err)
+	assertions.True(strings.Contains(content, "café"))
+}
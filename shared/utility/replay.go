@@ -0,0 +1,279 @@
+package utility
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/robinmin/xally/config"
+)
+
+type ReplayMode int
+
+const (
+	REPLAY_RECORD ReplayMode = iota + 1
+	REPLAY_SERVE
+)
+
+// ErrNoFixture fails the request missing in the fixtures during replay, never retried
+var ErrNoFixture = errors.New("replay: no fixture")
+
+// request bodies larger than this are kept as their hash only, e.g. audio uploads
+const FIXTURE_BODY_LIMIT = 64 * 1024
+
+// response headers not worth keeping in the fixtures, or secret
+var replay_skipped_headers = []string{
+	"Date", "Set-Cookie", "Content-Length", "Connection", "Alt-Svc", "Strict-Transport-Security",
+	"Cf-Ray", "Cf-Cache-Status", "X-Request-Id", "Openai-Processing-Ms", config.PROXY_TOKEN_NAME,
+}
+
+// Fixture is one recorded request and its response
+type Fixture struct {
+	Request struct {
+		Method string `json:"method"`
+		// path and the sorted query, without the host of the API so any endpoint or relay matches
+		Path        string `json:"path"`
+		ContentType string `json:"content_type,omitempty"`
+		Body        string `json:"body,omitempty"`
+	} `json:"request"`
+	Response struct {
+		Status int               `json:"status"`
+		Header map[string]string `json:"header,omitempty"`
+		Body   string            `json:"body"`
+		// the body is in base64 as it is not text, e.g. an image
+		Base64 bool `json:"base64,omitempty"`
+	} `json:"response"`
+}
+
+// ReplayTransport stores the interactions as fixture files in Dir, or serves them back.
+// Identical requests are numbered in order, so a session replays the same way each time.
+type ReplayTransport struct {
+	Mode ReplayMode
+	Dir  string
+	// where the recorded requests go
+	Base http.RoundTripper
+
+	mutex sync.Mutex
+	seen  map[string]int
+}
+
+func NewReplayTransport(mode ReplayMode, dir string, base http.RoundTripper) (*ReplayTransport, error) {
+	if mode == REPLAY_RECORD {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	} else if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("no fixture folder %s", dir)
+	}
+	return &ReplayTransport{Mode: mode, Dir: dir, Base: base, seen: map[string]int{}}, nil
+}
+
+func (t *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	path := normalizedPath(req)
+	content_type := req.Header.Get("Content-Type")
+	norm_body := normalizeBody(content_type, body)
+	key := fixtureKey(req.Method, path, norm_body)
+
+	t.mutex.Lock()
+	seq := t.seen[key]
+	t.seen[key] = seq + 1
+	t.mutex.Unlock()
+
+	if t.Mode == REPLAY_SERVE {
+		return t.serve(req, path, key, seq)
+	}
+
+	resp, err := t.Base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	resp_body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(resp_body))
+
+	fixture := &Fixture{}
+	fixture.Request.Method = req.Method
+	fixture.Request.Path = path
+	fixture.Request.ContentType = content_type
+	fixture.Request.Body = norm_body
+	if len(norm_body) > FIXTURE_BODY_LIMIT || !utf8.ValidString(norm_body) {
+		fixture.Request.Body = "sha256:" + key
+	}
+	fixture.Response.Status = resp.StatusCode
+	fixture.Response.Header = map[string]string{}
+	for name := range resp.Header {
+		if !containsFold(replay_skipped_headers, name) {
+			fixture.Response.Header[name] = resp.Header.Get(name)
+		}
+	}
+	fixture.Response.Body = string(resp_body)
+	if !utf8.Valid(resp_body) {
+		fixture.Response.Body = base64.StdEncoding.EncodeToString(resp_body)
+		fixture.Response.Base64 = true
+	}
+
+	data, err := json.MarshalIndent(fixture, "", "  ")
+	if err == nil {
+		err = os.WriteFile(filepath.Join(t.Dir, fixtureName(req.Method, path, key, seq)), data, 0600)
+	}
+	if err != nil {
+		log.Error("Failed to record the fixture of ", req.Method, " ", path, " : ", err)
+	}
+	return resp, nil
+}
+
+// serve answers with the fixture of the same request, the last one if it is asked more times than recorded
+func (t *ReplayTransport) serve(req *http.Request, path string, key string, seq int) (*http.Response, error) {
+	var data []byte
+	var err error
+	for idx := seq; idx >= 0; idx-- {
+		if data, err = os.ReadFile(filepath.Join(t.Dir, fixtureName(req.Method, path, key, idx))); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		err = fmt.Errorf("%w for %s %s (key %s) in %s", ErrNoFixture, req.Method, path, key, t.Dir)
+		log.Error(err)
+		return nil, err
+	}
+
+	fixture := &Fixture{}
+	if err = json.Unmarshal(data, fixture); err != nil {
+		return nil, fmt.Errorf("replay: invalid fixture for %s %s : %w", req.Method, path, err)
+	}
+	body := []byte(fixture.Response.Body)
+	if fixture.Response.Base64 {
+		if body, err = base64.StdEncoding.DecodeString(fixture.Response.Body); err != nil {
+			return nil, fmt.Errorf("replay: invalid fixture for %s %s : %w", req.Method, path, err)
+		}
+	}
+	resp := &http.Response{
+		Status:        fmt.Sprintf("%d %s", fixture.Response.Status, http.StatusText(fixture.Response.Status)),
+		StatusCode:    fixture.Response.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+	for name, value := range fixture.Response.Header {
+		resp.Header.Set(name, value)
+	}
+	return resp, nil
+}
+
+// readRequestBody reads the body and puts it back for sending
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// base of the OpenAI API in the fixtures, whichever endpoint or relay is configured
+const REPLAY_API_BASE = "/v1"
+
+func normalizedPath(req *http.Request) string {
+	path := apiPath(req.URL)
+	query := req.URL.Query()
+	if len(query) == 0 {
+		return path
+	}
+	return path + "?" + query.Encode()
+}
+
+// apiPath drops the host of the OpenAI endpoint or relay and replaces its base with
+// REPLAY_API_BASE, so the same fixtures answer any of them. The other sites keep their
+// hosts, and the requests received by the server have none.
+func apiPath(req_url *url.URL) string {
+	if len(req_url.Host) == 0 {
+		return req_url.Path
+	}
+	bases := []string{"https://api.openai.com/v1"}
+	if config.MyConfig != nil {
+		bases = append(bases, config.MyConfig.System.APIEndpointOpenai)
+	}
+	for _, base := range bases {
+		base_url, err := url.Parse(strings.TrimRight(base, "/"))
+		if err != nil || !strings.EqualFold(base_url.Host, req_url.Host) {
+			continue
+		}
+		if path := strings.TrimPrefix(req_url.Path, base_url.Path); len(path) < len(req_url.Path) || len(base_url.Path) == 0 {
+			return REPLAY_API_BASE + path
+		}
+		return req_url.Path
+	}
+	return req_url.Host + req_url.Path
+}
+
+// normalizeBody sorts the keys of JSON, and fixes the random boundary of multipart
+func normalizeBody(content_type string, body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err == nil {
+		if data, err := json.Marshal(value); err == nil {
+			return string(data)
+		}
+	}
+	if media_type, params, err := mime.ParseMediaType(content_type); err == nil && strings.HasPrefix(media_type, "multipart/") && len(params["boundary"]) > 0 {
+		return strings.ReplaceAll(string(body), params["boundary"], "BOUNDARY")
+	}
+	return string(body)
+}
+
+func fixtureKey(method string, path string, body string) string {
+	sum := sha256.Sum256([]byte(method + " " + path + "\n" + body))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+var rx_fixture_name = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+func fixtureName(method string, path string, key string, seq int) string {
+	if idx := strings.Index(path, "?"); idx >= 0 {
+		path = path[:idx]
+	}
+	slug := strings.Trim(rx_fixture_name.ReplaceAllString(path, "-"), "-")
+	return fmt.Sprintf("%s_%s_%s_%03d.json", strings.ToLower(method), slug, key, seq)
+}
+
+func containsFold(items []string, name string) bool {
+	for _, item := range items {
+		if strings.EqualFold(item, name) {
+			return true
+		}
+	}
+	return false
+}
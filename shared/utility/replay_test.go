@@ -0,0 +1,114 @@
+package utility
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/robinmin/xally/config"
+)
+
+func TestReplayTransport(t *testing.T) {
+	assertions := require.New(t)
+	dir := t.TempDir()
+
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set(config.PROXY_TOKEN_NAME, "refreshed-secret")
+		fmt.Fprintf(w, `{"answer":%d}`, atomic.AddInt32(&hits, 1))
+	}))
+	defer server.Close()
+
+	send := func(transport http.RoundTripper, method string, url string, body string) (string, error) {
+		req, _ := http.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer sk-live")
+		resp, err := (&http.Client{Transport: transport}).Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return resp.Header.Get("Content-Type") + " " + string(data), nil
+	}
+
+	cfg := config.UseTestConfig(t)
+	cfg.System.APIEndpointOpenai = server.URL + "/v1"
+	recorder, err := NewReplayTransport(REPLAY_RECORD, dir, http.DefaultTransport)
+	assertions.NoError(err)
+	for _, expected := range []string{`{"answer":1}`, `{"answer":2}`} {
+		answer, err := send(recorder, "POST", server.URL+"/v1/chat/completions", `{"model":"gpt-4","n":1}`)
+		assertions.NoError(err)
+		assertions.Equal("application/json "+expected, answer)
+	}
+	_, err = send(recorder, "GET", server.URL+"/v1/models", "")
+	assertions.NoError(err)
+
+	files, _ := os.ReadDir(dir)
+	assertions.Len(files, 3)
+	for _, file := range files {
+		data, _ := os.ReadFile(dir + "/" + file.Name())
+		assertions.NotContains(string(data), "secret")
+		assertions.NotContains(string(data), "sk-live")
+	}
+
+	// another endpoint, the keys in another order, the answers in the same order
+	cfg.System.APIEndpointOpenai = "http://relay.local/v1"
+	player, err := NewReplayTransport(REPLAY_SERVE, dir, nil)
+	assertions.NoError(err)
+	for _, expected := range []string{`{"answer":1}`, `{"answer":2}`, `{"answer":2}`} {
+		answer, err := send(player, "POST", "http://relay.local/v1/chat/completions", `{"n":1, "model":"gpt-4"}`)
+		assertions.NoError(err)
+		assertions.Equal("application/json "+expected, answer)
+	}
+	assertions.Equal(int32(3), hits)
+
+	_, err = send(player, "POST", "http://relay.local/v1/chat/completions", `{"model":"gpt-3.5-turbo"}`)
+	assertions.True(errors.Is(err, ErrNoFixture))
+	assertions.False(Retryable(httptest.NewRequest("GET", "/v1/models", nil), nil, err))
+}
+
+func TestReplayHosts(t *testing.T) {
+	assertions := require.New(t)
+	dir := t.TempDir()
+	config.UseTestConfig(t)
+
+	sites := []*httptest.Server{}
+	for _, name := range []string{"a", "b"} {
+		page := "page of " + name
+		site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(page))
+		}))
+		defer site.Close()
+		sites = append(sites, site)
+	}
+
+	get := func(transport http.RoundTripper, url string) string {
+		resp, err := (&http.Client{Transport: transport}).Get(url)
+		assertions.NoError(err)
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return string(data)
+	}
+
+	recorder, err := NewReplayTransport(REPLAY_RECORD, dir, http.DefaultTransport)
+	assertions.NoError(err)
+	assertions.Equal("page of a", get(recorder, sites[0].URL+"/"))
+	assertions.Equal("page of b", get(recorder, sites[1].URL+"/"))
+	files, _ := os.ReadDir(dir)
+	assertions.Len(files, 2)
+
+	// the same path of other sites is told apart
+	player, err := NewReplayTransport(REPLAY_SERVE, dir, nil)
+	assertions.NoError(err)
+	assertions.Equal("page of b", get(player, sites[1].URL+"/"))
+	assertions.Equal("page of a", get(player, sites[0].URL+"/"))
+}
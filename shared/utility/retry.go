@@ -0,0 +1,225 @@
+package utility
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// RetryPolicy is how the failed HTTP requests are sent again, shared by the client, the
+// plugins and the server proxy. It waits as the server asks by Retry-After or the
+// x-ratelimit-* headers of OpenAI, otherwise backs off exponentially with jitter.
+type RetryPolicy struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	// longest wait between the attempts, the server asking for longer gets no retry
+	MaxDelay time.Duration
+	// called before waiting for the next attempt, e.g. to tell the user
+	OnRetry func(delay time.Duration, reason string)
+	// retry the requests never sent only, as the relay in between retries the others
+	NeverSentOnly bool
+}
+
+var DefaultRetryPolicy = &RetryPolicy{
+	MaxRetries: 3,
+	BaseDelay:  time.Second,
+	MaxDelay:   30 * time.Second,
+}
+
+// WithRetries copies the policy with the given retries and base delay
+func (p *RetryPolicy) WithRetries(retries int, base_delay time.Duration) *RetryPolicy {
+	policy := *p
+	policy.MaxRetries = retries
+	policy.BaseDelay = base_delay
+	return &policy
+}
+
+// ViaRelay copies the policy for the requests going through a relay retrying by itself,
+// e.g. xally_server, so the attempts are not multiplied
+func (p *RetryPolicy) ViaRelay() *RetryPolicy {
+	policy := *p
+	policy.NeverSentOnly = true
+	return &policy
+}
+
+// Do sends the request with the client, retrying it by the policy
+func (p *RetryPolicy) Do(client *http.Client, req *http.Request) (*http.Response, error) {
+	return p.run(req, client.Do)
+}
+
+// RetryTransport retries the requests sent through Base by Policy, e.g. for a reverse proxy
+type RetryTransport struct {
+	Base   http.RoundTripper
+	Policy *RetryPolicy
+}
+
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.Policy.run(req, t.Base.RoundTrip)
+}
+
+func (p *RetryPolicy) run(req *http.Request, send func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	attempt_req := req
+	for attempt := 0; ; attempt++ {
+		resp, err := send(attempt_req)
+		if attempt >= p.MaxRetries || !Retryable(req, resp, err) || (p.NeverSentOnly && !neverSent(req, err)) {
+			return resp, err
+		}
+		delay, ok := p.Delay(attempt, resp)
+		if !ok {
+			return resp, err
+		}
+		next_req, ok := rewindRequest(req)
+		if !ok {
+			return resp, err
+		}
+
+		reason := retryReason(resp, err)
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+			resp.Body.Close()
+		}
+		log.Warn(fmt.Sprintf("Retry %s %s in %v (%d/%d) : %s", req.Method, req.URL.Redacted(), delay, attempt+1, p.MaxRetries, reason))
+		if p.OnRetry != nil {
+			p.OnRetry(delay, reason)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+		attempt_req = next_req
+	}
+}
+
+// Retryable tells whether the request can be sent again. The requests declined by the
+// server (429, 503) or never sent (dial errors) are always safe to retry, the others only
+// if idempotent, i.e. by the method or with an Idempotency-Key header.
+func Retryable(req *http.Request, resp *http.Response, err error) bool {
+	if err != nil {
+		if req.Context().Err() != nil || errors.Is(err, ErrNoFixture) {
+			return false
+		}
+		return neverSent(req, err) || isIdempotent(req)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusGatewayTimeout:
+		return isIdempotent(req)
+	}
+	return false
+}
+
+// neverSent tells if the request failed before reaching the server, i.e. on dialing
+func neverSent(req *http.Request, err error) bool {
+	var op_err *net.OpError
+	return err != nil && req.Context().Err() == nil && errors.As(err, &op_err) && op_err.Op == "dial"
+}
+
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return len(req.Header.Get("Idempotency-Key")) > 0
+}
+
+// Delay is the wait before the next attempt, false if the server asks for longer than MaxDelay
+func (p *RetryPolicy) Delay(attempt int, resp *http.Response) (time.Duration, bool) {
+	if wait, ok := serverDelay(resp); ok {
+		return wait, wait <= p.MaxDelay
+	}
+
+	delay := p.BaseDelay
+	for idx := 0; idx < attempt && delay < p.MaxDelay; idx++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	// equal jitter, half fixed and half random
+	if half := int64(delay / 2); half > 0 {
+		delay = time.Duration(half + rand.Int63n(half+1))
+	}
+	return delay, true
+}
+
+// serverDelay reads the wait asked by the server from Retry-After, or from the reset time
+// of the exhausted OpenAI rate limits
+func serverDelay(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	if value := resp.Header.Get("Retry-After-Ms"); len(value) > 0 {
+		if ms, err := strconv.ParseFloat(value, 64); err == nil && ms >= 0 {
+			return time.Duration(ms * float64(time.Millisecond)), true
+		}
+	}
+	if value := resp.Header.Get("Retry-After"); len(value) > 0 {
+		if secs, err := strconv.Atoi(strings.TrimSpace(value)); err == nil && secs >= 0 {
+			return time.Duration(secs) * time.Second, true
+		}
+		if at, err := http.ParseTime(value); err == nil {
+			if wait := time.Until(at); wait > 0 {
+				return wait, true
+			}
+			return 0, true
+		}
+	}
+
+	if resp.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+	var wait time.Duration
+	found := false
+	for _, limit := range []string{"requests", "tokens"} {
+		if resp.Header.Get("X-Ratelimit-Remaining-"+limit) != "0" {
+			continue
+		}
+		reset, err := time.ParseDuration(resp.Header.Get("X-Ratelimit-Reset-" + limit))
+		if err != nil {
+			continue
+		}
+		if !found || reset > wait {
+			wait = reset
+		}
+		found = true
+	}
+	return wait, found
+}
+
+// rewindRequest makes the request for the next attempt, false if its body can't be sent again
+func rewindRequest(req *http.Request) (*http.Request, bool) {
+	next_req := req.Clone(req.Context())
+	if req.Body == nil || req.Body == http.NoBody {
+		return next_req, true
+	}
+	if req.GetBody == nil {
+		return nil, false
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, false
+	}
+	next_req.Body = body
+	return next_req, true
+}
+
+func retryReason(resp *http.Response, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return resp.Status
+}
@@ -0,0 +1,149 @@
+package utility
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	assertions := require.New(t)
+
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&hits, 1) {
+		case 1:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.Header().Set("X-Ratelimit-Remaining-Requests", "0")
+			w.Header().Set("X-Ratelimit-Reset-Requests", "20ms")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.Write([]byte("ok"))
+		}
+	}))
+	defer server.Close()
+
+	delays := []time.Duration{}
+	policy := &RetryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond, MaxDelay: time.Second, OnRetry: func(delay time.Duration, reason string) {
+		delays = append(delays, delay)
+	}}
+
+	// the body is sent again on each attempt
+	req, _ := http.NewRequest(http.MethodPost, server.URL, strings.NewReader(`{"model":"gpt-3.5-turbo"}`))
+	resp, err := policy.Do(http.DefaultClient, req)
+	assertions.NoError(err)
+	resp.Body.Close()
+	assertions.Equal(http.StatusOK, resp.StatusCode)
+	assertions.Equal(int32(3), hits)
+	assertions.Equal([]time.Duration{0, 20 * time.Millisecond}, delays)
+}
+
+func TestRetryTransport(t *testing.T) {
+	assertions := require.New(t)
+
+	var hits int32
+	bodies := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if atomic.AddInt32(&hits, 1) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	policy := &RetryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond, MaxDelay: time.Second}
+	send := func(transport http.RoundTripper) int {
+		// as the body rewound by the proxy
+		body := `{"model":"gpt-3.5-turbo"}`
+		req, _ := http.NewRequest(http.MethodPost, server.URL, strings.NewReader(body))
+		req.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(strings.NewReader(body)), nil }
+		resp, err := transport.RoundTrip(req)
+		assertions.NoError(err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	assertions.Equal(http.StatusOK, send(&RetryTransport{Base: http.DefaultTransport, Policy: policy}))
+	assertions.Equal([]string{`{"model":"gpt-3.5-turbo"}`, `{"model":"gpt-3.5-turbo"}`}, bodies)
+
+	// behind a relay only the requests never sent are retried
+	atomic.StoreInt32(&hits, 0)
+	assertions.Equal(http.StatusServiceUnavailable, send(&RetryTransport{Base: http.DefaultTransport, Policy: policy.ViaRelay()}))
+	assertions.Equal(int32(1), atomic.LoadInt32(&hits))
+}
+
+func TestRetryable(t *testing.T) {
+	assertions := require.New(t)
+
+	post, _ := http.NewRequest(http.MethodPost, "https://api.openai.com/v1/chat/completions", nil)
+	get, _ := http.NewRequest(http.MethodGet, "https://api.openai.com/v1/models", nil)
+	status := func(code int) *http.Response { return &http.Response{StatusCode: code, Header: http.Header{}} }
+
+	assertions.True(Retryable(post, status(http.StatusTooManyRequests), nil))
+	assertions.False(Retryable(post, status(http.StatusBadGateway), nil))
+	assertions.True(Retryable(get, status(http.StatusBadGateway), nil))
+	assertions.False(Retryable(get, status(http.StatusNotFound), nil))
+
+	post.Header.Set("Idempotency-Key", "abc")
+	assertions.True(Retryable(post, status(http.StatusInternalServerError), nil))
+
+	// the server asking for too long gets no retry
+	policy := &RetryPolicy{MaxRetries: 3, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+	resp := status(http.StatusTooManyRequests)
+	resp.Header.Set("Retry-After", "60")
+	_, ok := policy.Delay(0, resp)
+	assertions.False(ok)
+
+	for attempt := 0; attempt < 6; attempt++ {
+		delay, ok := policy.Delay(attempt, status(http.StatusBadGateway))
+		assertions.True(ok)
+		assertions.LessOrEqual(delay, policy.MaxDelay)
+		assertions.GreaterOrEqual(delay, policy.BaseDelay/2)
+	}
+}
+
+func TestFetchURLWithRetry(t *testing.T) {
+	assertions := require.New(t)
+
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			atomic.AddInt32(&hits, 1)
+			http.NotFound(w, r)
+			return
+		}
+		if atomic.AddInt32(&hits, 1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	// waits milliseconds between the attempts and keeps the normal timeout
+	started := time.Now()
+	code, body, err := FetchURLWithRetry("GET", server.URL, "", nil, 3, 10*time.Millisecond)
+	assertions.NoError(err)
+	assertions.Equal(http.StatusOK, code)
+	assertions.Equal("ok", body)
+	assertions.Less(time.Since(started), time.Second)
+
+	// no retry on 404
+	atomic.StoreInt32(&hits, 0)
+	code, _, err = FetchURLWithRetry("GET", server.URL+"/missing", "", nil, 3, 10*time.Millisecond)
+	assertions.Error(err)
+	assertions.Equal(http.StatusNotFound, code)
+	assertions.Equal(int32(1), hits)
+}
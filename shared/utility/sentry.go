@@ -49,7 +49,8 @@ const sentry_event_level = log.InfoLevel
 // InitSentry 初始化sentry
 func InitSentry(dsn string, is_client bool) error {
 	err := sentry.Init(sentry.ClientOptions{
-		Dsn: dsn,
+		Dsn:           dsn,
+		HTTPTransport: sharedTransport{}, // never recorded or replayed
 		// Set TracesSampleRate to 1.0 to capture 100%
 		// of transactions for performance monitoring.
 		// We recommend adjusting this value in production,
@@ -1,12 +1,12 @@
 package utility
 
 import (
+	"bufio"
 	"bytes"
 	"crypto/tls"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
@@ -17,6 +17,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/c-bata/go-prompt"
 	"github.com/charmbracelet/glamour"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
@@ -65,16 +66,20 @@ func NewLog(log_path string, name string, level string) *LogFile {
 
 		log.SetOutput(logger.FileHandle)
 		// log.SetFormatter(&log.JSONFormatter{})
-		var level_int log.Level
-		if level_int, err = log.ParseLevel(level); err == nil {
-			log.SetLevel(level_int)
-		} else {
-			log.SetLevel(log.DebugLevel)
-		}
+		SetLogLevel(level)
 	}
 	return logger
 }
 
+// SetLogLevel changes the log level, an invalid level falls back to debug
+func SetLogLevel(level string) {
+	if level_int, err := log.ParseLevel(level); err == nil {
+		log.SetLevel(level_int)
+	} else {
+		log.SetLevel(log.DebugLevel)
+	}
+}
+
 func (lf *LogFile) Close() {
 	if lf.FileHandle != nil {
 		lf.FileHandle.Close()
@@ -89,141 +94,121 @@ func EchoInfo(msg string) {
 	}
 }
 
-func GetCurrPath() string {
-	file, _ := exec.LookPath(os.Args[0])
-	path, _ := filepath.Abs(file)
-	index := strings.LastIndex(path, string(os.PathSeparator))
-	ret := path[:index]
-	return ret
-}
-
-// 翻译函数，接受要翻译的文本和目标语言代码，返回翻译结果和错误信息
-func Translate(text string, lang string) (string, error) {
-	msg := ""
-
-	// 设置DeepL API的URL和API密钥
-	api_key := config.MyConfig.System.DeeplApiKey
-	if api_key == "" {
-		api_key = os.Getenv("DEEPL_API_KEY")
-		if api_key == "" {
-			msg = config.Text("error_no_deepl_key")
-			return msg, nil
-		}
-	}
-	api_url := config.MyConfig.System.APIEndpointDeepl + "/translate"
-
-	// 构建HTTP请求
-	values := url.Values{}
-	values.Set("auth_key", api_key)
-	values.Set("text", text)
-	values.Set("target_lang", lang)
-	req, err := http.NewRequest("POST", api_url,
-		ioutil.NopCloser(strings.NewReader(values.Encode())))
-	if err != nil {
-		msg = "Failed to create HTTP request object: " + err.Error()
-		return msg, err
-	}
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+// ReadLine shows the question and reads one line from the terminal
+func ReadLine(question string) string {
+	fmt.Print(question)
 
-	// 发送HTTP请求并解析响应
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		msg = "Failed to do HTTP request: " + err.Error()
-		return msg, err
-	}
-	defer resp.Body.Close()
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	return strings.TrimSpace(answer)
+}
 
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		msg = "Failed to read HTTP response body: " + err.Error()
-		return msg, err
+// Confirm asks a yes/no question on the terminal, anything but yes means no
+func Confirm(question string) bool {
+	switch strings.ToLower(ReadLine(question + " [y/N] ")) {
+	case "y", "yes":
+		return true
+	default:
+		return false
 	}
+}
 
-	// 解析响应并提取翻译结果
-	var result struct {
-		Translations []struct {
-			Text string `json:"text"`
-		} `json:"translations"`
-	}
-	err = json.Unmarshal(body, &result)
-	if err != nil {
-		msg = "Failed to unmarshal HTTP response body: " + err.Error()
-		return msg, err
+// ReadPassword shows the question and reads one line from the terminal without echoing it
+func ReadPassword(question string) (passwd string, err error) {
+	defer func() {
+		// the parser panics without a terminal
+		if r := recover(); r != nil {
+			err = fmt.Errorf("no terminal to read from : %v", r)
+		}
+	}()
+
+	fmt.Print(question)
+	parser := prompt.NewStandardInputParser()
+	if err = parser.Setup(); err != nil {
+		return "", err
+	}
+	defer func() {
+		parser.TearDown()
+		fmt.Println()
+	}()
+
+	input := []rune{}
+	for {
+		// the parser reads in non-blocking mode
+		data, read_err := parser.Read()
+		if read_err != nil || len(data) == 0 {
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+		for _, r := range string(data) {
+			switch {
+			case r == '\r' || r == '\n':
+				return string(input), nil
+			case r == 3 || r == 4: // Ctrl+C, Ctrl+D
+				return "", errors.New("interrupted")
+			case r == 8 || r == 127: // Backspace
+				if len(input) > 0 {
+					input = input[:len(input)-1]
+				}
+			case r >= 32:
+				input = append(input, r)
+			}
+		}
 	}
+}
 
-	return result.Translations[0].Text, nil
+// AskSecretKey asks for the passphrase of the secret store, twice if it is about to be created
+func AskSecretKey(create bool) (string, error) {
+	return AskSecretKeyBy(ReadPassword)(create)
 }
 
-// 查询字典函数，接受要查询的单词和目标语言代码，返回查询结果和错误信息
-func Lookup(text string, lang string) (string, error) {
-	msg := ""
+// AskSecretKeyBy asks for the passphrase with read_password, twice for a new store
+func AskSecretKeyBy(read_password func(question string) (string, error)) func(create bool) (string, error) {
+	return func(create bool) (string, error) {
+		if !create {
+			return read_password(config.Text("tips_secret_passphrase"))
+		}
 
-	// 设置DeepL API的URL和API密钥
-	api_key := config.MyConfig.System.DeeplApiKey
-	if api_key == "" {
-		api_key = os.Getenv("DEEPL_API_KEY")
-		if api_key == "" {
-			msg = config.Text("error_no_deepl_key")
-			return msg, nil
+		passwd, err := read_password(config.Text("tips_secret_passphrase_new"))
+		if err != nil {
+			return "", err
 		}
+		confirmed, err := read_password(config.Text("tips_secret_passphrase_confirm"))
+		if err != nil {
+			return "", err
+		}
+		if passwd != confirmed {
+			return "", errors.New(config.Text("tips_secret_passphrase_mismatch"))
+		}
+		return passwd, nil
 	}
-	api_url := config.MyConfig.System.APIEndpointDeepl + "/lexicon"
-
-	// 构建HTTP请求
-	values := url.Values{}
-	values.Set("auth_key", api_key)
-	values.Set("text", text)
-	values.Set("target_lang", lang)
-	req, err := http.NewRequest("POST", api_url,
-		ioutil.NopCloser(strings.NewReader(values.Encode())))
-	if err != nil {
-		msg = "Failed to create HTTP request object: " + err.Error()
-		return msg, err
-	}
-
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+}
 
-	// 发送HTTP请求并解析响应
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		msg = "Failed to do HTTP request: " + err.Error()
-		return msg, err
-	}
-	defer resp.Body.Close()
+func GetCurrPath() string {
+	file, _ := exec.LookPath(os.Args[0])
+	path, _ := filepath.Abs(file)
+	index := strings.LastIndex(path, string(os.PathSeparator))
+	ret := path[:index]
+	return ret
+}
 
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		msg = "Failed to read HTTP response body: " + err.Error()
-		return msg, err
-	}
+func FetchURL(verb string, url string, payload string, headers map[string]string) (int, string, error) {
+	return fetchURL(verb, url, payload, headers, DefaultRetryPolicy)
+}
 
-	// 解析响应并提取查询结果
-	var result struct {
-		Lexemes []struct {
-			Lemma string `json:"lemma"`
-			Pos   string `json:"pos"`
-			Sense string `json:"sense"`
-		} `json:"lexemes"`
-	}
-	err = json.Unmarshal(body, &result)
-	if err != nil {
-		msg = "Failed to unmarshal HTTP response body: " + err.Error()
-		return msg, err
+// FetchURLWithRetry makes up to retries attempts, waiting retryInterval at first and longer later.
+// Anything but 200 is an error.
+func FetchURLWithRetry(verb string, url string, payload string, headers map[string]string, retries int, retryInterval time.Duration) (int, string, error) {
+	if retries < 1 {
+		retries = 1
 	}
-
-	// 构建查询结果字符串
-	var sb strings.Builder
-	for _, lexeme := range result.Lexemes {
-		sb.WriteString(fmt.Sprintf("%s (%s): %s\n", lexeme.Lemma,
-			lexeme.Pos, lexeme.Sense))
+	resp_code, resp_body, err := fetchURL(verb, url, payload, headers, DefaultRetryPolicy.WithRetries(retries-1, retryInterval))
+	if err == nil && resp_code != http.StatusOK {
+		err = fmt.Errorf("failed to load URL %s after %d attempts: status code %d", url, retries, resp_code)
 	}
-
-	return sb.String(), nil
+	return resp_code, resp_body, err
 }
 
-func FetchURL(verb string, url string, payload string, headers map[string]string) (int, string, error) {
+func fetchURL(verb string, url string, payload string, headers map[string]string, policy *RetryPolicy) (int, string, error) {
 	resp_code := http.StatusRequestTimeout
 	msg := ""
 	resp_body := ""
@@ -237,37 +222,14 @@ func FetchURL(verb string, url string, payload string, headers map[string]string
 	}
 
 	// 设置HTTP请求头
-	if headers != nil && len(headers) > 0 {
-		for key, value := range headers {
-			req.Header.Set(key, value)
-		}
-	}
-	// set the http headers if not specified
-	acceptType := req.Header.Get("Accept")
-	if acceptType == "" {
-		req.Header.Set("Accept", "application/json; charset=utf-8")
-	}
-	acceptLang := req.Header.Get("Accept-Language")
-	if acceptLang == "" {
-		req.Header.Set("Accept-Language", "application/json; charset=utf-8")
-	}
-	contentType := req.Header.Get("Content-Type")
-	if contentType == "" {
-		req.Header.Set("Content-Type", config.GetAcceptLanguage())
-	}
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/111.0.0.0 Safari/537.36")
+	setRequestHeaders(req, headers)
 
 	// 创建HTTP客户端
-	client := &http.Client{
-		Timeout: 10 * time.Second,
-	}
+	client := NewHTTPClient(10 * time.Second)
 
-	resp, err := client.Do(req)
-	if resp != nil {
-		resp_code = resp.StatusCode
-	}
+	resp, err := policy.Do(client, req)
 	if err != nil || resp == nil {
-		msg = fmt.Sprintf("failed to send HTTP request: %v", err.Error())
+		msg = fmt.Sprintf("failed to send HTTP request: %v", err)
 		log.Error(msg)
 		return resp_code, resp_body, err
 	}
@@ -279,29 +241,71 @@ func FetchURL(verb string, url string, payload string, headers map[string]string
 		if err != nil {
 			msg = fmt.Sprintf("failed to read response body: %v", err.Error())
 			log.Error(msg)
-		} else {
-			resp_body = string(bodyBytes)
+			return resp_code, resp_body, err
 		}
+		resp_body = string(bodyBytes)
 	}
 
 	// 返回响应状态码、响应体和错误信息
-	return resp_code, resp_body, err
+	return resp_code, resp_body, nil
 }
 
-func FetchURLWithRetry(verb string, url string, payload string, headers map[string]string, retries int, retryInterval time.Duration) (int, string, error) {
-	resp_code := http.StatusRequestTimeout
-	msg := ""
-	resp_body := ""
+// WebPage holds a fetched web page together with the headers needed to decode and revalidate it
+type WebPage struct {
+	URL          string
+	StatusCode   int
+	ContentType  string
+	ETag         string
+	LastModified string
+	Body         []byte
+}
 
-	// 创建HTTP请求
-	req, err := http.NewRequest(verb, url, bytes.NewBuffer([]byte(payload)))
+// FetchWebPage GETs url_str and keeps the raw body and the relevant response
+// headers. Both 200 and 304 (for conditional requests) are treated as success.
+func FetchWebPage(url_str string, headers map[string]string, retries int, retryInterval time.Duration) (*WebPage, error) {
+	page := &WebPage{URL: url_str, StatusCode: http.StatusRequestTimeout}
+
+	req, err := http.NewRequest("GET", url_str, nil)
 	if err != nil {
-		msg = fmt.Sprintf("failed to create HTTP request: %v", err.Error())
-		log.Error(msg)
-		return resp_code, resp_body, err
+		log.Error(fmt.Sprintf("failed to create HTTP request: %v", err.Error()))
+		return page, err
+	}
+	if _, ok := headers["Accept"]; !ok {
+		req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
 	}
+	if _, ok := headers["Accept-Language"]; !ok {
+		req.Header.Set("Accept-Language", config.GetAcceptLanguage())
+	}
+	setRequestHeaders(req, headers)
 
-	// 设置HTTP请求头
+	client := NewHTTPClient(10 * time.Second)
+	if retries < 1 {
+		retries = 1
+	}
+	resp, err := DefaultRetryPolicy.WithRetries(retries-1, retryInterval).Do(client, req)
+	if err != nil {
+		log.Error(fmt.Sprintf("failed to send HTTP request: %v", err.Error()))
+		return page, err
+	}
+	defer resp.Body.Close()
+
+	page.StatusCode = resp.StatusCode
+	page.ContentType = resp.Header.Get("Content-Type")
+	page.ETag = resp.Header.Get("ETag")
+	page.LastModified = resp.Header.Get("Last-Modified")
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return page, nil
+	case http.StatusOK:
+		if page.Body, err = io.ReadAll(resp.Body); err != nil {
+			log.Error(fmt.Sprintf("failed to read response body: %v", err.Error()))
+		}
+		return page, err
+	}
+	return page, fmt.Errorf("failed to load URL %s: status code %d", url_str, resp.StatusCode)
+}
+
+func setRequestHeaders(req *http.Request, headers map[string]string) {
 	if headers != nil && len(headers) > 0 {
 		for key, value := range headers {
 			req.Header.Set(key, value)
@@ -314,44 +318,13 @@ func FetchURLWithRetry(verb string, url string, payload string, headers map[stri
 	}
 	acceptLang := req.Header.Get("Accept-Language")
 	if acceptLang == "" {
-		req.Header.Set("Accept-Language", "application/json; charset=utf-8")
+		req.Header.Set("Accept-Language", config.GetAcceptLanguage())
 	}
 	contentType := req.Header.Get("Content-Type")
-	if contentType == "" {
-		req.Header.Set("Content-Type", config.GetAcceptLanguage())
+	if contentType == "" && req.ContentLength > 0 {
+		req.Header.Set("Content-Type", "application/json; charset=utf-8")
 	}
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/111.0.0.0 Safari/537.36")
-
-	// 创建HTTP客户端
-	client := &http.Client{
-		Timeout: retryInterval * time.Second,
-	}
-
-	var resp *http.Response
-	for i := 0; i < retries; i++ {
-		resp, err = client.Do(req)
-		if resp != nil {
-			resp_code = resp.StatusCode
-		}
-		if err == nil && resp.StatusCode == http.StatusOK {
-			defer resp.Body.Close()
-
-			bodyBytes, err := io.ReadAll(resp.Body)
-			if err != nil {
-				msg = fmt.Sprintf("failed to read response body: %v", err.Error())
-				log.Error(msg)
-			} else {
-				resp_body = string(bodyBytes)
-				// 返回响应状态码、响应体和错误信息
-				return resp_code, resp_body, nil
-			}
-		}
-		time.Sleep(retryInterval)
-	}
-	if err != nil {
-		return resp_code, "", err
-	}
-	return resp_code, "", fmt.Errorf("failed to load URL %s after %d retries: status code %d", url, retries, resp.StatusCode)
 }
 
 func SendEmail(to, subject, body string) error {